@@ -2,17 +2,18 @@ package main
 
 import (
 	"context"
+	"dftbopt-mcp/go-service/internal/api"
+	"dftbopt-mcp/go-service/internal/parser"
+	"dftbopt-mcp/go-service/internal/types"
 	"flag"
 	"fmt"
+	"github.com/gin-gonic/gin"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
 	"time"
-	"dftbopt-mcp/go-service/internal/api"
-	"dftbopt-mcp/go-service/internal/types"
-	"github.com/gin-gonic/gin"
 )
 
 func main() {
@@ -25,6 +26,8 @@ func main() {
 		timeout     = flag.Int("timeout", 300, "Calculation timeout in seconds")
 		debug       = flag.Bool("debug", false, "Enable debug mode")
 		cleanup     = flag.Bool("cleanup", false, "Enable automatic cleanup of old files")
+		disorder    = flag.String("disorder-policy", "reject", "Default disorder policy: reject or highest_occupancy")
+		skDir       = flag.String("sk-dir", "", "Root directory of the Slater-Koster parameter sets for DFTB and DFTB3")
 	)
 	flag.Parse()
 
@@ -37,11 +40,13 @@ func main() {
 
 	// Create server configuration
 	config := &types.ServerConfig{
-		Port:        *port,
-		WorkDir:     *workDir,
-		DFTBPath:    *dftbPath,
-		MaxRequests: *maxRequests,
-		Timeout:     *timeout,
+		Port:           *port,
+		WorkDir:        *workDir,
+		DFTBPath:       *dftbPath,
+		MaxRequests:    *maxRequests,
+		Timeout:        *timeout,
+		DisorderPolicy: *disorder,
+		SKDir:          *skDir,
 	}
 
 	// Create working directory if it doesn't exist
@@ -54,7 +59,7 @@ func main() {
 
 	// Create Gin router
 	router := gin.New()
-	
+
 	// Register routes
 	apiHandler.RegisterRoutes(router)
 
@@ -67,6 +72,8 @@ func main() {
 		log.Printf("Calculation timeout: %d seconds", config.Timeout)
 		log.Printf("Debug mode: %v", *debug)
 		log.Printf("Automatic cleanup: %v", *cleanup)
+		log.Printf("Default disorder policy: %s", config.DisorderPolicy)
+		log.Printf("Slater-Koster parameter root: %s", config.SKDir)
 
 		if err := router.Run(fmt.Sprintf(":%d", config.Port)); err != nil {
 			log.Fatalf("Failed to start server: %v", err)
@@ -120,7 +127,7 @@ func cleanupOldFiles(workDir string, maxAge time.Duration) error {
 	for _, entry := range entries {
 		if entry.IsDir() {
 			dirPath := filepath.Join(workDir, entry.Name())
-			
+
 			// Get directory info
 			info, err := entry.Info()
 			if err != nil {
@@ -193,6 +200,15 @@ func validateConfig(config *types.ServerConfig) error {
 		return fmt.Errorf("timeout must be positive")
 	}
 
+	if !parser.IsValidDisorderPolicy(config.DisorderPolicy) {
+		return fmt.Errorf("invalid disorder policy: %s", config.DisorderPolicy)
+	}
+
+	// The group policy needs a disorder group, which only a request can name
+	if config.DisorderPolicy == parser.DisorderPolicyGroup {
+		return fmt.Errorf("disorder policy %s cannot be the server default; requests select it together with disorder_group", parser.DisorderPolicyGroup)
+	}
+
 	// Check if DFTB+ executable exists
 	if _, err := os.Stat(config.DFTBPath); os.IsNotExist(err) {
 		return fmt.Errorf("DFTB+ executable not found at: %s", config.DFTBPath)
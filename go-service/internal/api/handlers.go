@@ -1,13 +1,13 @@
 package api
 
 import (
-	"fmt"
-	"net/http"
-	"time"
 	"dftbopt-mcp/go-service/internal/dftb"
 	"dftbopt-mcp/go-service/internal/types"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"net/http"
+	"time"
 )
 
 // APIHandler handles HTTP API requests
@@ -28,16 +28,20 @@ func NewAPIHandler(config *types.ServerConfig) *APIHandler {
 func (h *APIHandler) RegisterRoutes(router *gin.Engine) {
 	// Health check
 	router.GET("/health", h.healthCheck)
-	
+
 	// Service info
 	router.GET("/info", h.getServiceInfo)
-	
+
 	// Optimization endpoint
 	router.POST("/api/v1/optimize", h.optimizeStructure)
-	
+
 	// Status check endpoint
 	router.GET("/api/v1/status/:requestID", h.getStatus)
-	
+
+	// Optimization trajectory endpoints
+	router.GET("/api/v1/trajectory/:requestID", h.getTrajectory)
+	router.GET("/api/v1/trajectory/:requestID/extxyz", h.downloadTrajectory)
+
 	// Middleware
 	router.Use(h.corsMiddleware())
 	router.Use(h.requestIDMiddleware())
@@ -63,8 +67,23 @@ func (h *APIHandler) getServiceInfo(c *gin.Context) {
 			"geometry_optimization",
 			"gfn1_xtb",
 			"gfn2_xtb",
+			"dftb",
+			"dftb3",
 			"cif_input",
 			"cif_output",
+			"extxyz_input",
+			"extxyz_output",
+			"poscar_input",
+			"poscar_output",
+			"optimization_trajectory",
+			"band_gap",
+			"density_of_states",
+			"stress_tensor",
+			"cell_change",
+			"structure_comparison",
+			"kpoint_sampling",
+			"lattice_relaxation",
+			"atom_constraints",
 		},
 	}
 	c.JSON(http.StatusOK, response)
@@ -73,63 +92,63 @@ func (h *APIHandler) getServiceInfo(c *gin.Context) {
 // optimizeStructure handles optimization requests
 func (h *APIHandler) optimizeStructure(c *gin.Context) {
 	var request types.OptimizationRequest
-	
+
 	// Bind JSON request
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request format",
+			"error":   "Invalid request format",
 			"details": err.Error(),
 		})
 		return
 	}
-	
+
 	// Generate request ID if not provided
 	if request.RequestID == "" {
 		request.RequestID = uuid.New().String()
 	}
-	
+
 	// Validate request
 	if err := h.dftbRunner.ValidateRequest(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request parameters",
+			"error":   "Invalid request parameters",
 			"details": err.Error(),
 		})
 		return
 	}
-	
+
 	// Run optimization (in a real implementation, this should be async)
 	response, err := h.dftbRunner.RunOptimization(&request)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Optimization failed",
+			"error":   "Optimization failed",
 			"details": err.Error(),
 		})
 		return
 	}
-	
+
 	c.JSON(http.StatusOK, response)
 }
 
 // getStatus returns the status of a calculation
 func (h *APIHandler) getStatus(c *gin.Context) {
 	requestID := c.Param("requestID")
-	
+
 	if requestID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Request ID is required",
 		})
 		return
 	}
-	
+
 	status, err := h.dftbRunner.GetStatus(requestID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to get status",
+			"error":   "Failed to get status",
 			"details": err.Error(),
 		})
 		return
 	}
-	
+
 	c.JSON(http.StatusOK, gin.H{
 		"request_id": requestID,
 		"status":     status,
@@ -137,18 +156,54 @@ func (h *APIHandler) getStatus(c *gin.Context) {
 	})
 }
 
+// getTrajectory returns the energy and largest force of every geometry
+// step of a job, with coordinates when ?coordinates=true
+func (h *APIHandler) getTrajectory(c *gin.Context) {
+	requestID := c.Param("requestID")
+	includeCoordinates := c.Query("coordinates") == "true"
+
+	trajectory, err := h.dftbRunner.GetTrajectory(requestID, includeCoordinates)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Trajectory not available",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, trajectory)
+}
+
+// downloadTrajectory returns the trajectory of a job as a multi-frame
+// extended XYZ file
+func (h *APIHandler) downloadTrajectory(c *gin.Context) {
+	requestID := c.Param("requestID")
+
+	content, err := h.dftbRunner.GetTrajectoryExtXYZ(requestID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Trajectory not available",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", requestID+"_trajectory.extxyz"))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(content))
+}
+
 // corsMiddleware handles CORS headers
 func (h *APIHandler) corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization")
-		
+
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusOK)
 			return
 		}
-		
+
 		c.Next()
 	}
 }
@@ -160,10 +215,10 @@ func (h *APIHandler) requestIDMiddleware() gin.HandlerFunc {
 		if requestID == "" {
 			requestID = uuid.New().String()
 		}
-		
+
 		c.Header("X-Request-ID", requestID)
 		c.Set("requestID", requestID)
-		
+
 		c.Next()
 	}
 }
@@ -172,12 +227,12 @@ func (h *APIHandler) requestIDMiddleware() gin.HandlerFunc {
 func (h *APIHandler) loggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
-		
+
 		c.Next()
-		
+
 		duration := time.Since(start)
 		requestID, _ := c.Get("requestID")
-		
+
 		gin.DefaultWriter.Write([]byte(fmt.Sprintf(
 			"[%s] %s %s %s %d %v\n",
 			time.Now().Format(time.RFC3339),
@@ -193,10 +248,10 @@ func (h *APIHandler) loggingMiddleware() gin.HandlerFunc {
 // errorResponse creates a standardized error response
 func (h *APIHandler) errorResponse(c *gin.Context, statusCode int, message string, details interface{}) {
 	c.JSON(statusCode, gin.H{
-		"error":   message,
-		"details": details,
+		"error":      message,
+		"details":    details,
 		"request_id": c.GetString("requestID"),
-		"timestamp": time.Now().Format(time.RFC3339),
+		"timestamp":  time.Now().Format(time.RFC3339),
 	})
 }
 
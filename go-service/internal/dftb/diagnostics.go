@@ -0,0 +1,217 @@
+package dftb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// Machine-readable codes of failed DFTB+ calculations
+const (
+	ErrorCodeExecutableNotFound = "executable_not_found"
+	ErrorCodeTimeout            = "timeout"
+	ErrorCodeKilled             = "killed"
+	ErrorCodeOutOfMemory        = "out_of_memory"
+	ErrorCodeSCCNotConverged    = "scc_not_converged"
+	ErrorCodeMissingParameters  = "missing_parameters"
+	ErrorCodeUnsupportedMethod  = "unsupported_method"
+	ErrorCodeInvalidInput       = "invalid_input"
+	ErrorCodeInvalidGeometry    = "invalid_geometry"
+	ErrorCodeMissingOutput      = "missing_output"
+	ErrorCodeUnknown            = "unknown_error"
+)
+
+// stderrFile holds the standard error of the DFTB+ run in the job directory
+const stderrFile = "stderr.log"
+
+// CalculationError is a classified DFTB+ failure
+type CalculationError struct {
+	Code    string // One of the ErrorCode constants
+	Message string // Human readable description, usually the DFTB+ message
+	Hint    string // Suggested remediation
+}
+
+// Error implements the error interface
+func (e *CalculationError) Error() string {
+	return e.Message
+}
+
+// diagnosticPattern maps a DFTB+ message to an error or warning code
+type diagnosticPattern struct {
+	code    string
+	pattern *regexp.Regexp
+	hint    string
+}
+
+// errorCatalogue lists known fatal DFTB+ messages; the first match wins
+var errorCatalogue = []diagnosticPattern{
+	{
+		code:    ErrorCodeSCCNotConverged,
+		pattern: regexp.MustCompile(`(?i)SCC (is )?NOT converged`),
+		hint:    "increase MaxSCCIterations, lower the mixing parameter or add an electronic temperature; strained or charged structures often need a better starting geometry",
+	},
+	{
+		code:    ErrorCodeMissingParameters,
+		pattern: regexp.MustCompile(`(?i)(slater-koster|\.skf|parameter file|missing .*parameters?|no .*parameters? (found|available) for)`),
+		hint:    "the Slater-Koster set has no parameters for one of the elements; choose a parameter_set that covers every element of the structure, or an xTB method",
+	},
+	{
+		code:    ErrorCodeUnsupportedMethod,
+		pattern: regexp.MustCompile(`(?i)(xtb|tblite).*(not (available|compiled|supported|enabled))|compiled without .*(xtb|tblite)`),
+		hint:    "the DFTB+ executable was built without tblite; install a DFTB+ build with xTB support or point --dftb-path at one",
+	},
+	{
+		code:    ErrorCodeInvalidGeometry,
+		pattern: regexp.MustCompile(`(?i)(atoms? .*too close|too close to each other|overlapping atoms|coinciding atoms|invalid (geometry|lattice)|lattice vectors .*(singular|linearly dependent))`),
+		hint:    "check the input structure for overlapping or duplicated atoms, unresolved disorder and a valid cell",
+	},
+	{
+		code:    ErrorCodeOutOfMemory,
+		pattern: regexp.MustCompile(`(?i)(out of memory|cannot allocate memory|allocation (failed|error)|failed to allocate)`),
+		hint:    "the structure is too large for the available memory; reduce the system size or run on a machine with more memory",
+	},
+	{
+		code:    ErrorCodeInvalidInput,
+		pattern: regexp.MustCompile(`(?i)(unknown (keyword|method|child)|invalid (child|value|node|keyword)|unprocessed node|parsing error|syntax error|unexpected (end|token))`),
+		hint:    "DFTB+ rejected the generated dftb_in.hsd; the installed DFTB+ version may not support one of the requested options",
+	},
+}
+
+// warningCatalogue lists known non-fatal DFTB+ messages worth surfacing.
+// Geometry non-convergence is not listed; assessConvergence reports it with
+// the step limit and the final force.
+var warningCatalogue = []diagnosticPattern{
+	{
+		code:    ErrorCodeSCCNotConverged,
+		pattern: regexp.MustCompile(`(?i)SCC (is )?NOT converged`),
+		hint:    "at least one geometry step ended with an unconverged SCC; energies and forces of those steps are unreliable",
+	},
+	{
+		code:    "small_distance",
+		pattern: regexp.MustCompile(`(?i)(atoms? .*too close|distance .* (is )?(very )?small)`),
+		hint:    "two atoms came unusually close during the optimization; check the final structure",
+	},
+}
+
+// errorMessageLine matches the "-> message" lines following an ERROR! banner
+var errorMessageLine = regexp.MustCompile(`^\s*->\s*(.+)$`)
+
+// classifyFailure turns the error of a DFTB+ run into a CalculationError by
+// matching the ERROR! messages and standard error captured in the job
+// directory against the catalogue of known failures
+func classifyFailure(workDir string, runErr error) *CalculationError {
+	stdout, stderr := readLog(workDir, stdoutFile), readLog(workDir, stderrFile)
+	messages := append(errorMessages(stdout), errorMessages(stderr)...)
+	candidates := append(append([]string{}, messages...), stderr...)
+
+	for _, entry := range errorCatalogue {
+		if line := matchLine(candidates, entry.pattern); line != "" {
+			return &CalculationError{
+				Code:    entry.code,
+				Message: fmt.Sprintf("DFTB+ calculation failed: %s", line),
+				Hint:    entry.hint,
+			}
+		}
+	}
+
+	message := fmt.Sprintf("DFTB+ calculation failed: %v", runErr)
+	if len(messages) > 0 {
+		message = fmt.Sprintf("%s: %s", message, strings.Join(messages, "; "))
+	} else if line := lastLine(stderr); line != "" {
+		message = fmt.Sprintf("%s: %s", message, line)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			if status.Signal() == syscall.SIGKILL {
+				return &CalculationError{
+					Code:    ErrorCodeOutOfMemory,
+					Message: message,
+					Hint:    "DFTB+ was killed, most likely by the out-of-memory killer; reduce the system size or run on a machine with more memory",
+				}
+			}
+			return &CalculationError{
+				Code:    ErrorCodeKilled,
+				Message: message,
+				Hint:    fmt.Sprintf("DFTB+ was terminated by signal %v; check the server logs and %s in the job directory", status.Signal(), stderrFile),
+			}
+		}
+	}
+
+	return &CalculationError{
+		Code:    ErrorCodeUnknown,
+		Message: message,
+		Hint:    fmt.Sprintf("inspect %s and %s in the job directory", stdoutFile, stderrFile),
+	}
+}
+
+// scanWarnings returns the codes and hints of the known warnings found in the
+// output of a completed DFTB+ run
+func scanWarnings(workDir string) []string {
+	logs := append(readLog(workDir, stderrFile), readLog(workDir, stdoutFile)...)
+
+	var warnings []string
+	for _, entry := range warningCatalogue {
+		if matchLine(logs, entry.pattern) != "" {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", entry.code, entry.hint))
+		}
+	}
+	return warnings
+}
+
+// readLog reads the lines of a log file in the job directory; a missing
+// file reads as empty
+func readLog(workDir, name string) []string {
+	content, err := os.ReadFile(filepath.Join(workDir, name))
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(content), "\n")
+}
+
+// matchLine returns the first line matching the pattern, trimmed of the
+// "->" prefix DFTB+ puts in front of its messages
+func matchLine(lines []string, pattern *regexp.Regexp) string {
+	for _, line := range lines {
+		if pattern.MatchString(line) {
+			if m := errorMessageLine.FindStringSubmatch(line); m != nil {
+				return strings.TrimSpace(m[1])
+			}
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+// errorMessages collects the "->" messages following ERROR! banners
+func errorMessages(lines []string) []string {
+	var messages []string
+	inError := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(line), "ERROR!"):
+			inError = true
+		case inError && errorMessageLine.MatchString(line):
+			messages = append(messages, strings.TrimSpace(errorMessageLine.FindStringSubmatch(line)[1]))
+		default:
+			inError = false
+		}
+	}
+	return messages
+}
+
+// lastLine returns the last non-empty line
+func lastLine(lines []string) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if trimmed := strings.TrimSpace(lines[i]); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
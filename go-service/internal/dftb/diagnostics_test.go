@@ -0,0 +1,207 @@
+package dftb
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestErrorCatalogue(t *testing.T) {
+	tests := []struct {
+		line string
+		code string
+	}{
+		{"-> SCC is NOT converged, maximal SCC iterations exceeded", ErrorCodeSCCNotConverged},
+		{"-> Could not open file '/opt/sk/mio-1-1/Zn-Zn.skf' for direct reading", ErrorCodeMissingParameters},
+		{"-> No parameters available for element Xe", ErrorCodeMissingParameters},
+		{"-> Program has been compiled without tblite support", ErrorCodeUnsupportedMethod},
+		{"-> xTB Hamiltonian not available in this binary", ErrorCodeUnsupportedMethod},
+		{"-> Atoms 1 and 2 are too close to each other!", ErrorCodeInvalidGeometry},
+		{"-> Lattice vectors are linearly dependent", ErrorCodeInvalidGeometry},
+		{"Operating system error: Cannot allocate memory", ErrorCodeOutOfMemory},
+		{"-> Unknown child 'Filling'", ErrorCodeInvalidInput},
+		{"-> Invalid value for MaxSteps", ErrorCodeInvalidInput},
+		{"-> Unprocessed node 'Foo'", ErrorCodeInvalidInput},
+		{"Geometry converged", ""},
+	}
+	for _, tt := range tests {
+		code := ""
+		for _, entry := range errorCatalogue {
+			if entry.pattern.MatchString(tt.line) {
+				code = entry.code
+				break
+			}
+		}
+		if code != tt.code {
+			t.Errorf("%q: got code %q, want %q", tt.line, code, tt.code)
+		}
+	}
+}
+
+func TestWarningCatalogue(t *testing.T) {
+	tests := []struct {
+		stdout string
+		codes  []string
+	}{
+		{"WARNING!\n-> SCC is NOT converged, maximal SCC iterations exceeded\n", []string{ErrorCodeSCCNotConverged}},
+		{"WARNING!\n-> Atoms 3 and 7 are too close\n", []string{"small_distance"}},
+		{"WARNING!\n-> Interatomic distance 0.42 is very small\n-> SCC NOT converged\n", []string{ErrorCodeSCCNotConverged, "small_distance"}},
+		// Geometry non-convergence is reported by assessConvergence
+		{"Geometry did NOT converge\n", nil},
+	}
+	for _, tt := range tests {
+		workDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(workDir, stdoutFile), []byte(tt.stdout), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var codes []string
+		for _, warning := range scanWarnings(workDir) {
+			codes = append(codes, strings.SplitN(warning, ":", 2)[0])
+		}
+		if !reflect.DeepEqual(codes, tt.codes) {
+			t.Errorf("%q: got warnings %v, want %v", tt.stdout, codes, tt.codes)
+		}
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	lines := strings.Split(`Geometry step: 3
+-> not an error message
+ERROR!
+-> Atoms 1 and 2 are too close to each other!
+->   Check the geometry
+Total Energy: -1.0 H
+ERROR!
+
+-> after a blank line`, "\n")
+
+	want := []string{"Atoms 1 and 2 are too close to each other!", "Check the geometry"}
+	if got := errorMessages(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// exitError runs a shell command and returns its exit error
+func exitError(t *testing.T, command string) error {
+	t.Helper()
+	err := exec.Command("sh", "-c", command).Run()
+	if err == nil {
+		t.Fatalf("%q did not fail", command)
+	}
+	return err
+}
+
+func TestClassifyFailure(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	tests := []struct {
+		name    string
+		stdout  string
+		stderr  string
+		runErr  error
+		code    string
+		message string
+	}{
+		{
+			name:    "SCC not converged",
+			stdout:  "Geometry step: 12\n\nERROR!\n-> SCC is NOT converged, maximal SCC iterations exceeded\n",
+			runErr:  exitError(t, "exit 1"),
+			code:    ErrorCodeSCCNotConverged,
+			message: "DFTB+ calculation failed: SCC is NOT converged, maximal SCC iterations exceeded",
+		},
+		{
+			name:    "missing Slater-Koster file",
+			stdout:  "ERROR!\n-> Could not open file '/opt/sk/mio-1-1/Zn-Zn.skf' for direct reading\n",
+			runErr:  exitError(t, "exit 1"),
+			code:    ErrorCodeMissingParameters,
+			message: "Zn-Zn.skf",
+		},
+		{
+			name:    "invalid input",
+			stdout:  "ERROR!\n-> Unknown child 'Filling'\nPath: dftb_in/Hamiltonian/DFTB\n",
+			runErr:  exitError(t, "exit 1"),
+			code:    ErrorCodeInvalidInput,
+			message: "Unknown child 'Filling'",
+		},
+		{
+			// The first catalogue entry wins over later messages
+			name:    "several messages",
+			stdout:  "ERROR!\n-> Atoms 1 and 2 are too close to each other!\n",
+			stderr:  "ERROR!\n-> SCC is NOT converged\n",
+			runErr:  exitError(t, "exit 1"),
+			code:    ErrorCodeSCCNotConverged,
+			message: "SCC is NOT converged",
+		},
+		{
+			name:    "out of memory on stderr",
+			stderr:  "Operating system error: Cannot allocate memory\nAllocation would exceed memory limit\n",
+			runErr:  exitError(t, "exit 2"),
+			code:    ErrorCodeOutOfMemory,
+			message: "Cannot allocate memory",
+		},
+		{
+			name:    "killed by the out-of-memory killer",
+			stdout:  "Geometry step: 40\n",
+			runErr:  exitError(t, "kill -KILL $$"),
+			code:    ErrorCodeOutOfMemory,
+			message: "signal: killed",
+		},
+		{
+			name:    "terminated",
+			runErr:  exitError(t, "kill -TERM $$"),
+			code:    ErrorCodeKilled,
+			message: "signal: terminated",
+		},
+		{
+			name:    "unknown ERROR! message",
+			stdout:  "ERROR!\n-> Something unexpected\n",
+			runErr:  exitError(t, "exit 1"),
+			code:    ErrorCodeUnknown,
+			message: "DFTB+ calculation failed: exit status 1: Something unexpected",
+		},
+		{
+			name:    "last line of stderr",
+			stderr:  "forrtl: severe (174): SIGSEGV\nImage PC Routine\n\n",
+			runErr:  exitError(t, "exit 174"),
+			code:    ErrorCodeUnknown,
+			message: "exit status 174: Image PC Routine",
+		},
+		{
+			name:    "no logs",
+			runErr:  errors.New("broken pipe"),
+			code:    ErrorCodeUnknown,
+			message: "DFTB+ calculation failed: broken pipe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			for name, content := range map[string]string{stdoutFile: tt.stdout, stderrFile: tt.stderr} {
+				if content == "" {
+					continue
+				}
+				if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			failure := classifyFailure(workDir, tt.runErr)
+			if failure.Code != tt.code || !strings.Contains(failure.Message, tt.message) {
+				t.Errorf("got %s: %q, want %s containing %q", failure.Code, failure.Message, tt.code, tt.message)
+			}
+			if failure.Hint == "" {
+				t.Errorf("no hint for %s", failure.Code)
+			}
+			// Slater-Koster files are chosen by parameter set, not by method
+			if failure.Code == ErrorCodeMissingParameters && !strings.Contains(failure.Hint, "parameter_set") {
+				t.Errorf("hint does not point at parameter_set: %s", failure.Hint)
+			}
+		})
+	}
+}
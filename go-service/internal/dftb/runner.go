@@ -1,81 +1,243 @@
 package dftb
 
 import (
+	"dftbopt-mcp/go-service/internal/hsd"
+	"dftbopt-mcp/go-service/internal/parser"
+	"dftbopt-mcp/go-service/internal/skparams"
+	"dftbopt-mcp/go-service/internal/types"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
-	"dftbopt-mcp/go-service/internal/parser"
-	"dftbopt-mcp/go-service/internal/types"
 )
 
 // DFTBRunner handles DFTB+ calculations
 type DFTBRunner struct {
-	config      *types.ServerConfig
-	cifParser   *parser.CIFParser
-	workDir     string
+	config       *types.ServerConfig
+	cifParser    *parser.CIFParser
+	cifWriter    *parser.CIFWriter
+	xyzParser    *parser.ExtXYZParser
+	xyzWriter    *parser.ExtXYZWriter
+	poscarParser *parser.POSCARParser
+	poscarWriter *parser.POSCARWriter
+	genWriter    *parser.GenWriter
+	genParser    *parser.GenParser
+	hsdWriter    *hsd.Writer
+	outputParser *parser.DFTBOutputParser
+	workDir      string
 }
 
 // NewDFTBRunner creates a new DFTB+ runner instance
 func NewDFTBRunner(config *types.ServerConfig) *DFTBRunner {
 	return &DFTBRunner{
-		config:    config,
-		cifParser: parser.NewCIFParser(),
-		workDir:   config.WorkDir,
+		config:       config,
+		cifParser:    parser.NewCIFParser(),
+		cifWriter:    parser.NewCIFWriter(),
+		xyzParser:    parser.NewExtXYZParser(),
+		xyzWriter:    parser.NewExtXYZWriter(),
+		poscarParser: parser.NewPOSCARParser(),
+		poscarWriter: parser.NewPOSCARWriter(),
+		genWriter:    parser.NewGenWriter(),
+		genParser:    parser.NewGenParser(),
+		hsdWriter:    hsd.NewWriter(),
+		outputParser: parser.NewDFTBOutputParser(),
+		workDir:      config.WorkDir,
 	}
 }
 
 // RunOptimization runs DFTB+ geometry optimization
 func (r *DFTBRunner) RunOptimization(request *types.OptimizationRequest) (*types.OptimizationResponse, error) {
-	// Create working directory for this request
-	requestDir := filepath.Join(r.workDir, request.RequestID)
-	if err := os.MkdirAll(requestDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create request directory: %v", err)
+	// Parse the structure file
+	cif, err := r.parseStructure(request)
+	if err != nil {
+		return r.createErrorResponse(request.RequestID, err)
+	}
+
+	if request.Batch {
+		return r.runBatch(request, cif)
 	}
 
-	// Parse CIF file
-	cif, err := r.cifParser.ParseFromBase64(request.StructureFile)
+	// Select the data block to optimize
+	cif, err = r.cifParser.SelectDataBlock(cif, request.DataBlock, request.DataBlockIndex)
 	if err != nil {
-		return r.createErrorResponse(request.RequestID, fmt.Errorf("failed to parse CIF file: %v", err))
+		return r.createErrorResponse(request.RequestID, err)
 	}
 
-	// Convert to DFTB+ input format
-	dftbInput, err := r.cifParser.ToDFTBInput(cif, request.Method, request.Fmax)
+	return r.runStructure(request.RequestID, request, cif)
+}
+
+// parseStructure decodes and parses the structure file in its input format.
+// Every format is read into a CIFFile with one data block per structure.
+func (r *DFTBRunner) parseStructure(request *types.OptimizationRequest) (*types.CIFFile, error) {
+	switch request.InputFormat {
+	case "", parser.FormatCIF:
+		cif, err := r.cifParser.ParseFromBase64(request.StructureFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CIF file: %v", err)
+		}
+		return cif, nil
+	case parser.FormatExtXYZ:
+		cif, err := r.xyzParser.ParseFromBase64(request.StructureFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse extended XYZ file: %v", err)
+		}
+		return cif, nil
+	case parser.FormatPOSCAR:
+		cif, err := r.poscarParser.ParseFromBase64(request.StructureFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse POSCAR file: %v", err)
+		}
+		return cif, nil
+	}
+	return nil, fmt.Errorf("unsupported input format: %s", request.InputFormat)
+}
+
+// runBatch optimizes every data block of a CIF as its own job. Each job runs
+// in its own directory named after the request ID and the data block.
+func (r *DFTBRunner) runBatch(request *types.OptimizationRequest, cif *types.CIFFile) (*types.OptimizationResponse, error) {
+	response := &types.OptimizationResponse{
+		RequestID: request.RequestID,
+	}
+
+	succeeded := 0
+	for _, blockCIF := range r.cifParser.SplitDataBlocks(cif) {
+		jobID := request.RequestID + "_" + sanitizeJobName(blockCIF.DataBlock.Name)
+
+		result, err := r.runStructure(jobID, request, blockCIF)
+		if err != nil {
+			result, _ = r.createBlockErrorResponse(jobID, blockCIF.DataBlock.Name, err)
+		}
+		if result.Status == "success" {
+			succeeded++
+		}
+
+		response.Results = append(response.Results, *result)
+	}
+
+	switch succeeded {
+	case len(response.Results):
+		response.Status = "success"
+	case 0:
+		response.Status = "error"
+		response.ErrorMessage = "all data blocks failed to optimize"
+	default:
+		response.Status = "partial"
+		response.ErrorMessage = fmt.Sprintf("%d of %d data blocks failed to optimize",
+			len(response.Results)-succeeded, len(response.Results))
+	}
+
+	return response, nil
+}
+
+// sanitizeJobName replaces characters that are unsafe in directory names
+func sanitizeJobName(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.' {
+			return c
+		}
+		return '_'
+	}, name)
+}
+
+// runStructure runs the optimization of a single CIF data block as job jobID
+func (r *DFTBRunner) runStructure(jobID string, request *types.OptimizationRequest, cif *types.CIFFile) (*types.OptimizationResponse, error) {
+	// Create working directory for this job
+	requestDir := filepath.Join(r.workDir, jobID)
+	if err := os.MkdirAll(requestDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create request directory: %v", err)
+	}
+
+	blockName := cif.DataBlock.Name
+
+	// Build the DFTB+ input from the data block
+	cif, dftbInput, err := r.prepareInput(request, cif)
 	if err != nil {
-		return r.createErrorResponse(request.RequestID, fmt.Errorf("failed to convert to DFTB+ input: %v", err))
+		return r.createBlockErrorResponse(jobID, blockName, err)
 	}
 
 	// Generate DFTB+ input files
 	if err := r.generateInputFiles(requestDir, dftbInput); err != nil {
-		return r.createErrorResponse(request.RequestID, fmt.Errorf("failed to generate input files: %v", err))
+		return r.createBlockErrorResponse(jobID, blockName, fmt.Errorf("failed to generate input files: %v", err))
 	}
 
 	// Run DFTB+ calculation
-	outputPath, err := r.runDFTBCalculation(requestDir, request.RequestID)
-	if err != nil {
-		return r.createErrorResponse(request.RequestID, fmt.Errorf("DFTB+ calculation failed: %v", err))
+	if _, err := r.runDFTBCalculation(requestDir, jobID); err != nil {
+		return r.createBlockErrorResponse(jobID, blockName, err)
 	}
 
 	// Parse DFTB+ output
-	parsedData, err := r.parseDFTBOutput(outputPath)
+	parsedData, err := r.parseDFTBOutput(requestDir)
+	if err != nil {
+		return r.createBlockErrorResponse(jobID, blockName, fmt.Errorf("failed to parse DFTB+ output: %v", err))
+	}
+	r.assessConvergence(requestDir, dftbInput, parsedData)
+	parsedData.KPoints = dftbInput.KPoints
+	parsedData.Summary.Warnings = append(parsedData.Summary.Warnings, scanWarnings(requestDir)...)
+	r.parseElectronicStructure(requestDir, request, parsedData)
+	r.assignAtomLabels(parsedData, cif)
+
+	// Read the final geometry written by DFTB+
+	finalGeometry, err := r.readFinalGeometry(requestDir, dftbInput)
+	if err != nil {
+		return r.createBlockErrorResponse(jobID, blockName, fmt.Errorf("failed to read optimized geometry: %v", err))
+	}
+
+	// Report how the cell changed
+	if dftbInput.Geometry.Periodic && finalGeometry.Periodic {
+		change, err := parser.CompareCells(dftbInput.Geometry.LatticeVectors, finalGeometry.LatticeVectors)
+		if err != nil {
+			parsedData.Summary.Warnings = append(parsedData.Summary.Warnings, fmt.Sprintf("cell change unavailable: %v", err))
+		} else {
+			parsedData.CellChange = change
+		}
+	}
+
+	// Compare the optimized geometry with the input
+	labels := make([]string, len(cif.DataBlock.AtomSites))
+	for i, site := range cif.DataBlock.AtomSites {
+		labels[i] = site.Label
+	}
+	comparison, err := parser.CompareGeometries(&dftbInput.Geometry, finalGeometry, labels)
 	if err != nil {
-		return r.createErrorResponse(request.RequestID, fmt.Errorf("failed to parse DFTB+ output: %v", err))
+		parsedData.Summary.Warnings = append(parsedData.Summary.Warnings, fmt.Sprintf("structure comparison unavailable: %v", err))
+	} else {
+		parsedData.StructureComparison = comparison
+		if comparison.ConnectivityChanged {
+			parsedData.Summary.Warnings = append(parsedData.Summary.Warnings, fmt.Sprintf(
+				"connectivity changed during the optimization: %d bonds formed, %d bonds broken", len(comparison.BondsFormed), len(comparison.BondsBroken)))
+		}
+	}
+
+	// Store the trajectory with the job; a missing trajectory does not fail it
+	if err := r.saveTrajectory(requestDir, jobID, dftbInput, finalGeometry); err != nil {
+		parsedData.Summary.Warnings = append(parsedData.Summary.Warnings, fmt.Sprintf("trajectory unavailable: %v", err))
+	}
+
+	// Build the optimized structure
+	optimized, err := r.optimizedStructure(cif, finalGeometry)
+	if err != nil {
+		return r.createBlockErrorResponse(jobID, blockName, fmt.Errorf("failed to build optimized structure: %v", err))
+	}
+	if request.IncludeCIFCharges {
+		r.embedCharges(optimized, parsedData)
 	}
 
 	// Generate optimized CIF file
-	optimizedCIFPath, err := r.generateOptimizedCIF(requestDir, cif, parsedData)
+	optimizedCIFPath, err := r.generateOptimizedCIF(requestDir, request, dftbInput, optimized, parsedData)
 	if err != nil {
-		return r.createErrorResponse(request.RequestID, fmt.Errorf("failed to generate optimized CIF: %v", err))
+		return r.createBlockErrorResponse(jobID, blockName, fmt.Errorf("failed to generate optimized CIF: %v", err))
 	}
 
 	// Read optimized CIF content and encode as base64
 	optimizedCIFContent, err := r.cifParser.ReadFromFile(optimizedCIFPath)
 	if err != nil {
-		return r.createErrorResponse(request.RequestID, fmt.Errorf("failed to read optimized CIF: %v", err))
+		return r.createBlockErrorResponse(jobID, blockName, fmt.Errorf("failed to read optimized CIF: %v", err))
 	}
 
 	// Clean up working directory (optional)
@@ -83,28 +245,114 @@ func (r *DFTBRunner) RunOptimization(request *types.OptimizationRequest) (*types
 	//     fmt.Printf("Warning: failed to clean up request directory: %v\n", err)
 	// }
 
-	return &types.OptimizationResponse{
-		Status:        "success",
-		RequestID:     request.RequestID,
-		ParsedData:    parsedData,
-		OutputCIFPath: base64.StdEncoding.EncodeToString([]byte(optimizedCIFContent)),
-	}, nil
+	response := &types.OptimizationResponse{
+		Status:              "success",
+		RequestID:           jobID,
+		DataBlock:           blockName,
+		ParsedData:          parsedData,
+		ConnectivityChanged: parsedData.StructureComparison != nil && parsedData.StructureComparison.ConnectivityChanged,
+		OutputCIFPath:       base64.StdEncoding.EncodeToString([]byte(optimizedCIFContent)),
+	}
+
+	// Optional additional output format
+	if request.OutputFormat != "" && request.OutputFormat != parser.FormatCIF {
+		content, err := r.generateOptimizedOutput(requestDir, request.OutputFormat, optimized, parsedData)
+		if err != nil {
+			return r.createBlockErrorResponse(jobID, blockName, fmt.Errorf("failed to generate optimized %s output: %v", request.OutputFormat, err))
+		}
+		response.OutputFormat = request.OutputFormat
+		response.OutputStructure = base64.StdEncoding.EncodeToString([]byte(content))
+	}
+
+	return response, nil
+}
+
+// prepareInput resolves disorder, expands symmetry and applies the
+// constraints of a data block, then builds its DFTB+ input with the cell
+// relaxation, k-points and Hamiltonian of the request. It returns the
+// expanded structure along with the input.
+func (r *DFTBRunner) prepareInput(request *types.OptimizationRequest, cif *types.CIFFile) (*types.CIFFile, *types.DFTBInput, error) {
+	// Resolve disorder before the structure is expanded
+	cif, err := r.cifParser.ApplyDisorderPolicy(cif, r.disorderPolicy(request), request.DisorderGroup)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve disorder: %v", err)
+	}
+
+	// Expand the asymmetric unit to the full P1 cell
+	cif, err = r.cifParser.ExpandSymmetry(cif)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply symmetry operations: %v", err)
+	}
+
+	// Fix the atoms selected by the constraints
+	cif, err = r.cifParser.ApplyConstraints(cif, request.Constraints)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply constraints: %v", err)
+	}
+
+	// Convert to DFTB+ input format
+	dftbInput, err := r.cifParser.ToDFTBInput(cif, request.Method, request.Fmax)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert to DFTB+ input: %v", err)
+	}
+
+	// Relax the cell if requested
+	if request.LatticeOpt {
+		dftbInput.Options.LatticeOpt = true
+		dftbInput.Options.LatticeMode = request.LatticeMode
+		if dftbInput.Options.LatticeMode == "" {
+			dftbInput.Options.LatticeMode = parser.LatticeModeFull
+		}
+		dftbInput.Options.PressureGPa = request.PressureGPa
+	}
+
+	// Sample the Brillouin zone of periodic systems
+	if dftbInput.Geometry.Periodic {
+		if dftbInput.KPoints, err = parser.GenerateKPoints(dftbInput.Geometry.LatticeVectors, request.KPoints); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate k-points: %v", err)
+		}
+	}
+
+	// Select the Slater-Koster parameters of SK-based methods
+	if err := r.configureHamiltonian(request, dftbInput); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure the Hamiltonian: %v", err)
+	}
+
+	return cif, dftbInput, nil
+}
+
+// disorderPolicy returns the disorder policy of a request, falling back to
+// the server default and then to rejecting disordered structures
+func (r *DFTBRunner) disorderPolicy(request *types.OptimizationRequest) string {
+	if request.DisorderPolicy != "" {
+		return request.DisorderPolicy
+	}
+	if r.config.DisorderPolicy != "" {
+		return r.config.DisorderPolicy
+	}
+	return parser.DisorderPolicyReject
 }
 
 // generateInputFiles generates DFTB+ input files
 func (r *DFTBRunner) generateInputFiles(workDir string, input *types.DFTBInput) error {
 	// Generate dftb_in.hsd input file
-	inputContent := r.generateDFTBInputContent(input)
+	inputContent, err := r.generateDFTBInputContent(input)
+	if err != nil {
+		return fmt.Errorf("failed to build input file: %v", err)
+	}
 	inputPath := filepath.Join(workDir, "dftb_in.hsd")
-	
+
 	if err := os.WriteFile(inputPath, []byte(inputContent), 0644); err != nil {
 		return fmt.Errorf("failed to write input file: %v", err)
 	}
 
 	// Generate geometry file (gen format)
-	geometryContent := r.generateGeometryContent(input)
+	geometryContent, err := r.generateGeometryContent(input)
+	if err != nil {
+		return err
+	}
 	geometryPath := filepath.Join(workDir, "geometry.gen")
-	
+
 	if err := os.WriteFile(geometryPath, []byte(geometryContent), 0644); err != nil {
 		return fmt.Errorf("failed to write geometry file: %v", err)
 	}
@@ -113,91 +361,272 @@ func (r *DFTBRunner) generateInputFiles(workDir string, input *types.DFTBInput)
 }
 
 // generateDFTBInputContent generates DFTB+ input file content
-func (r *DFTBRunner) generateDFTBInputContent(input *types.DFTBInput) string {
-	var content strings.Builder
+func (r *DFTBRunner) generateDFTBInputContent(input *types.DFTBInput) (string, error) {
+	driver, err := r.driverBlock(input)
+	if err != nil {
+		return "", err
+	}
 
-	content.WriteString("Geometry = GenFormat {\n")
-	content.WriteString("  <<< geometry.gen\n")
-	content.WriteString("}\n\n")
+	document := hsd.NewDocument(
+		hsd.NewTypedBlock("Geometry", "GenFormat", hsd.Include("geometry.gen")),
+		r.hamiltonianBlock(input),
+		driver,
+		hsd.NewBlock("Analysis",
+			hsd.NewProperty("CalculateForces", hsd.Bool(input.Analysis.Forces)),
+			hsd.NewProperty("WriteBandOut", hsd.Bool(true)),
+		),
+		hsd.NewBlock("Options",
+			hsd.NewProperty("WriteDetailedOut", hsd.Bool(true)),
+			hsd.NewProperty("WriteResultsTag", hsd.Bool(true)),
+		),
+	)
 
-	content.WriteString("Hamiltonian = " + input.Hamiltonian.Method + " {\n")
-	content.WriteString("  MaxAngularMomentum {\n")
-	
-	// Add max angular momentum for each element
+	return r.hsdWriter.Write(document)
+}
+
+// hamiltonianBlock builds the xTB Hamiltonian, or the DFTB Hamiltonian with
+// its Slater-Koster files and DFTB3 options for SK-based methods
+func (r *DFTBRunner) hamiltonianBlock(input *types.DFTBInput) *hsd.Block {
+	hamiltonian := &input.Hamiltonian
+	if !skparams.IsSKMethod(hamiltonian.Method) {
+		block := hsd.NewTypedBlock("Hamiltonian", "xTB",
+			hsd.NewProperty("Method", hsd.String(hamiltonian.Method)),
+		)
+		if input.KPoints != nil {
+			block.Add(kPointsBlock(input.KPoints))
+		}
+		return block
+	}
+
+	momenta := hsd.NewBlock("MaxAngularMomentum")
 	for _, element := range input.Geometry.Elements {
-		switch element {
-		case "H":
-			content.WriteString("    H = s\n")
-		case "C", "N", "O", "F":
-			content.WriteString("    " + element + " = p\n")
-		case "Si", "P", "S", "Cl":
-			content.WriteString("    " + element + " = d\n")
-		default:
-			content.WriteString("    " + element + " = p\n")
-		}
-	}
-	
-	content.WriteString("  }\n")
-	content.WriteString("}\n\n")
-
-	content.WriteString("Driver = GeometryOptimization {\n")
-	content.WriteString("  Convergence = Grad {\n")
-	content.WriteString("    MaxForceComponent = " + fmt.Sprintf("%.6f", input.Options.Fmax) + "\n")
-	content.WriteString("  }\n")
-	content.WriteString("  MaxSteps = 1000\n")
-	content.WriteString("  MovedAtoms = 1:-1\n")
-	content.WriteString("}\n\n")
-
-	content.WriteString("Analysis = {\n")
-	if input.Analysis.Forces {
-		content.WriteString("  CalculateForces = Yes\n")
-	}
-	content.WriteString("  PrintEigenvalues = Yes\n")
-	content.WriteString("  PrintBandStructure = No\n")
-	content.WriteString("}\n\n")
-
-	content.WriteString("Options {\n")
-	content.WriteString("  WriteDetailedOut = Yes\n")
-	content.WriteString("  WriteResultsTag = Yes\n")
-	content.WriteString("}\n")
-
-	return content.String()
-}
-
-// generateGeometryContent generates geometry file content in gen format
-func (r *DFTBRunner) generateGeometryContent(input *types.DFTBInput) string {
-	var content strings.Builder
-
-	// Header: number of atoms, periodic (F), element types
-	content.WriteString(fmt.Sprintf("%d F\n", len(input.Geometry.Coordinates)))
-	
-	// Element types
-	content.WriteString(strings.Join(input.Geometry.Elements, " ") + "\n")
-	
-	// Coordinates
-	for i, coord := range input.Geometry.Coordinates {
-		elementIndex := i % len(input.Geometry.Elements)
-		element := input.Geometry.Elements[elementIndex]
-		content.WriteString(fmt.Sprintf("%s %12.8f %12.8f %12.8f\n", element, coord[0], coord[1], coord[2]))
-	}
-
-	return content.String()
-}
-
-// runDFTBCalculation runs the DFTB+ calculation
+		momenta.Add(hsd.NewProperty(element, hsd.String(hamiltonian.MaxAngularMomentum[element])))
+	}
+
+	block := hsd.NewTypedBlock("Hamiltonian", "DFTB",
+		hsd.NewProperty("SCC", hsd.Bool(true)),
+		momenta,
+		hsd.NewTypedBlock("SlaterKosterFiles", "Type2FileNames",
+			hsd.NewProperty("Prefix", hsd.String(hamiltonian.SlaterKosterPrefix)),
+			hsd.NewProperty("Separator", hsd.String(hamiltonian.SlaterKosterSeparator)),
+			hsd.NewProperty("Suffix", hsd.String(hamiltonian.SlaterKosterSuffix)),
+		),
+	)
+
+	if input.KPoints != nil {
+		block.Add(kPointsBlock(input.KPoints))
+	}
+
+	if hamiltonian.Method == skparams.MethodDFTB3 {
+		// Without the full expansion only the on-site third-order terms are kept
+		if hamiltonian.ThirdOrderFull {
+			block.Add(hsd.NewProperty("ThirdOrderFull", hsd.Bool(true)))
+		} else {
+			block.Add(hsd.NewProperty("ThirdOrder", hsd.Bool(true)))
+		}
+		derivs := hsd.NewBlock("HubbardDerivs")
+		for _, element := range input.Geometry.Elements {
+			derivs.Add(hsd.NewProperty(element, hsd.Float(hamiltonian.HubbardDerivs[element])))
+		}
+		block.Add(derivs)
+		if hamiltonian.DampXH {
+			block.Add(hsd.NewTypedBlock("HCorrection", "Damping",
+				hsd.NewProperty("Exponent", hsd.Float(hamiltonian.DampXHExponent)),
+			))
+		}
+	}
+
+	return block
+}
+
+// kPointsBlock writes a k-point grid as a supercell folding: the diagonal
+// folding matrix followed by the shift
+func kPointsBlock(sampling *types.KPointSampling) *hsd.Block {
+	block := hsd.NewTypedBlock("KPointsAndWeights", "SupercellFolding")
+	for k := 0; k < 3; k++ {
+		row := hsd.NewRow(hsd.Int(0), hsd.Int(0), hsd.Int(0))
+		row[k] = hsd.Int(sampling.Grid[k])
+		block.Add(row)
+	}
+	return block.Add(hsd.NewRow(hsd.Float(sampling.Shift[0]), hsd.Float(sampling.Shift[1]), hsd.Float(sampling.Shift[2])))
+}
+
+// driverBlock builds the GeometryOptimization driver, which stops once the
+// largest force component falls below fmax. Geometries of every step are
+// appended to geo_end.xyz for the trajectory. Variable-cell runs also relax
+// the lattice under the external pressure.
+func (r *DFTBRunner) driverBlock(input *types.DFTBInput) (*hsd.Block, error) {
+	driver := hsd.NewTypedBlock("Driver", "GeometryOptimization",
+		hsd.NewTypedBlock("Convergence", "Grad",
+			hsd.NewProperty("MaxForceComponent", hsd.Float(input.Options.Fmax)),
+		),
+		hsd.NewProperty("MaxSteps", hsd.Int(input.Options.MaxSteps)),
+		hsd.NewProperty("AppendGeometries", hsd.Bool(true)),
+	)
+
+	if input.Options.LatticeOpt {
+		driver.Add(hsd.NewProperty("LatticeOpt", hsd.Bool(true)))
+		switch input.Options.LatticeMode {
+		case parser.LatticeModeIsotropic:
+			driver.Add(hsd.NewProperty("Isotropic", hsd.Bool(true)))
+		case parser.LatticeModeFixedAngles:
+			driver.Add(hsd.NewProperty("FixAngles", hsd.Bool(true)))
+		}
+		if input.Options.PressureGPa != 0 {
+			driver.Add(hsd.NewProperty("Pressure", hsd.Float(input.Options.PressureGPa*1e9)).WithModifier("Pa"))
+		}
+	}
+
+	moved, constraints, err := r.movedAtoms(input)
+	if err != nil {
+		return nil, err
+	}
+	driver.Add(hsd.NewProperty("MovedAtoms", moved))
+	if len(constraints) > 0 {
+		driver.Add(hsd.NewBlock("Constraints", constraints...))
+	}
+
+	return driver, nil
+}
+
+// movedAtoms returns the MovedAtoms selection and the Constraints lines for
+// the fixed axes of the geometry. Atoms fixed along every axis are left out
+// of MovedAtoms; partially fixed atoms are constrained along each fixed
+// Cartesian axis, and along the reciprocal vector of each fixed lattice axis
+// so that the fractional coordinate stays put.
+func (r *DFTBRunner) movedAtoms(input *types.DFTBInput) (hsd.Value, []hsd.Node, error) {
+	if len(input.Geometry.FixedAxes) == 0 {
+		return hsd.Word("1:-1"), nil, nil
+	}
+
+	var inverse [3][3]float64
+	for _, fixed := range input.Geometry.FixedLatticeAxes {
+		if fixed != [3]bool{} {
+			var err error
+			if inverse, err = parser.InvertLattice(input.Geometry.LatticeVectors); err != nil {
+				return nil, nil, fmt.Errorf("invalid lattice vectors: %v", err)
+			}
+			break
+		}
+	}
+
+	var moved hsd.List
+	var constraints []hsd.Node
+	for i, fixed := range input.Geometry.FixedAxes {
+		var fixedLattice [3]bool
+		if i < len(input.Geometry.FixedLatticeAxes) {
+			fixedLattice = input.Geometry.FixedLatticeAxes[i]
+		}
+		if fixed == [3]bool{true, true, true} || fixedLattice == [3]bool{true, true, true} {
+			continue
+		}
+		moved = append(moved, hsd.Int(i+1))
+		for k := 0; k < 3; k++ {
+			if fixed[k] {
+				axis := hsd.List{hsd.Float(0), hsd.Float(0), hsd.Float(0)}
+				axis[k] = hsd.Float(1)
+				constraints = append(constraints, hsd.NewRow(append(hsd.List{hsd.Int(i + 1)}, axis...)...))
+			}
+			if fixedLattice[k] {
+				direction := parser.ReciprocalDirection(inverse, k)
+				constraints = append(constraints, hsd.NewRow(hsd.Int(i+1), hsd.Float(direction[0]), hsd.Float(direction[1]), hsd.Float(direction[2])))
+			}
+		}
+	}
+
+	return moved, constraints, nil
+}
+
+// configureHamiltonian fills the Slater-Koster settings of SK-based methods
+// from the parameter set registry; xTB methods need none
+func (r *DFTBRunner) configureHamiltonian(request *types.OptimizationRequest, input *types.DFTBInput) error {
+	if !skparams.IsSKMethod(request.Method) {
+		return nil
+	}
+
+	registry, err := skparams.NewRegistry(r.config.SKDir)
+	if err != nil {
+		return err
+	}
+	set, err := registry.Resolve(request.ParameterSet, request.Method, input.Geometry.Elements)
+	if err != nil {
+		return err
+	}
+
+	hamiltonian := &input.Hamiltonian
+	hamiltonian.ParameterSet = set.Name
+	hamiltonian.SlaterKosterPrefix = registry.Directory(set) + string(filepath.Separator)
+	hamiltonian.SlaterKosterSeparator = set.Separator
+	hamiltonian.SlaterKosterSuffix = set.Suffix
+	hamiltonian.MaxAngularMomentum = make(map[string]string)
+	for _, element := range input.Geometry.Elements {
+		hamiltonian.MaxAngularMomentum[element] = set.Elements[element].MaxAngularMomentum
+	}
+
+	if request.Method == skparams.MethodDFTB3 {
+		hamiltonian.HubbardDerivs = make(map[string]float64)
+		for _, element := range input.Geometry.Elements {
+			hamiltonian.HubbardDerivs[element] = *set.Elements[element].HubbardDerivative
+		}
+		hamiltonian.ThirdOrderFull = request.ThirdOrderFull == nil || *request.ThirdOrderFull
+		hamiltonian.DampXH = set.DampXHExponent > 0
+		if request.DampXH != nil {
+			if *request.DampXH && set.DampXHExponent <= 0 {
+				return fmt.Errorf("parameter set %s defines no X-H damping exponent", set.Name)
+			}
+			hamiltonian.DampXH = *request.DampXH
+		}
+		hamiltonian.DampXHExponent = set.DampXHExponent
+	}
+
+	return nil
+}
+
+// generateGeometryContent generates geometry file content in gen format.
+// Periodic structures use fractional coordinates, molecules the cluster mode.
+func (r *DFTBRunner) generateGeometryContent(input *types.DFTBInput) (string, error) {
+	mode := parser.GenCluster
+	if input.Geometry.Periodic {
+		mode = parser.GenFractional
+	}
+
+	return r.genWriter.Write(&input.Geometry, mode)
+}
+
+// runDFTBCalculation runs the DFTB+ calculation. Standard output and error
+// are kept in the job directory; failures are returned as a classified
+// *CalculationError.
 func (r *DFTBRunner) runDFTBCalculation(workDir, requestID string) (string, error) {
 	// Check if DFTB+ executable exists
 	if _, err := os.Stat(r.config.DFTBPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("DFTB+ executable not found at: %s", r.config.DFTBPath)
+		return "", &CalculationError{
+			Code:    ErrorCodeExecutableNotFound,
+			Message: fmt.Sprintf("DFTB+ executable not found at: %s", r.config.DFTBPath),
+			Hint:    "install DFTB+ or start the server with --dftb-path pointing at the dftb+ executable",
+		}
 	}
 
-	// Prepare command
+	// Prepare command; standard output holds the per-step energies and forces
 	cmd := exec.Command(r.config.DFTBPath)
 	cmd.Dir = workDir
-	
+
+	stdout, err := os.Create(filepath.Join(workDir, stdoutFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", stdoutFile, err)
+	}
+	defer stdout.Close()
+	cmd.Stdout = stdout
+
+	stderr, err := os.Create(filepath.Join(workDir, stderrFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", stderrFile, err)
+	}
+	defer stderr.Close()
+	cmd.Stderr = stderr
+
 	// Set timeout
 	timeout := time.Duration(r.config.Timeout) * time.Second
-	
+
 	// Run the command
 	done := make(chan error, 1)
 	go func() {
@@ -210,130 +639,372 @@ func (r *DFTBRunner) runDFTBCalculation(workDir, requestID string) (string, erro
 		if cmd.Process != nil {
 			cmd.Process.Kill()
 		}
-		return "", fmt.Errorf("DFTB+ calculation timed out after %d seconds", r.config.Timeout)
+		return "", &CalculationError{
+			Code:    ErrorCodeTimeout,
+			Message: fmt.Sprintf("DFTB+ calculation timed out after %d seconds", r.config.Timeout),
+			Hint:    "raise the server timeout, loosen fmax or start from a pre-relaxed structure",
+		}
 	case err := <-done:
 		if err != nil {
-			return "", fmt.Errorf("DFTB+ calculation failed: %v", err)
+			return "", classifyFailure(workDir, err)
 		}
 	}
 
 	// Check for output files
 	outputPath := filepath.Join(workDir, "dftb_out.hsd")
 	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("DFTB+ output file not found")
+		return "", &CalculationError{
+			Code:    ErrorCodeMissingOutput,
+			Message: "DFTB+ output file not found",
+			Hint:    fmt.Sprintf("DFTB+ exited without writing its output; inspect %s and %s in the job directory", stdoutFile, stderrFile),
+		}
 	}
 
 	return outputPath, nil
 }
 
-// parseDFTBOutput parses DFTB+ output file
-func (r *DFTBRunner) parseDFTBOutput(outputPath string) (map[string]interface{}, error) {
-	content, err := os.ReadFile(outputPath)
+// parseDFTBOutput parses detailed.out and, when present, results.tag from
+// the job directory
+func (r *DFTBRunner) parseDFTBOutput(workDir string) (*types.DFTBOutput, error) {
+	detailed, err := os.ReadFile(filepath.Join(workDir, "detailed.out"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read output file: %v", err)
+		return nil, fmt.Errorf("failed to read detailed.out: %v", err)
 	}
 
-	// Simple parsing (in a real implementation, you would need more sophisticated parsing)
-	result := make(map[string]interface{})
-	
-	// Parse basic information
-	result["summary"] = map[string]interface{}{
-		"warnings":           []string{},
-		"convergence_status": "converged",
-		"calculation_status": "completed",
+	output := parser.NewDFTBOutput()
+	if err := r.outputParser.ParseDetailedOut(string(detailed), output); err != nil {
+		return nil, err
 	}
-	
-	result["convergence_info"] = map[string]interface{}{
-		"scc_converged": true,
+
+	if content, err := os.ReadFile(filepath.Join(workDir, "results.tag")); err == nil {
+		entries, err := r.outputParser.ParseResultsTag(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse results.tag: %v", err)
+		}
+		r.outputParser.ApplyResultsTag(entries, output)
 	}
-	
-	// Parse energies (simplified)
-	result["energies_eV"] = map[string]float64{
-		"total": -100.0, // Placeholder value
+
+	if _, ok := output.EnergiesHartree["total"]; !ok {
+		return nil, fmt.Errorf("no total energy found in the DFTB+ output")
+	}
+
+	output.Summary.CalculationStatus = "completed"
+
+	return output, nil
+}
+
+// assessConvergence decides from the standard output and the final forces
+// whether the geometry driver reached the force criterion, stopped at
+// MaxSteps or ended with an unconverged SCC, and sets the convergence status
+func (r *DFTBRunner) assessConvergence(workDir string, input *types.DFTBInput, output *types.DFTBOutput) {
+	info := &output.ConvergenceInfo
+	info.MaxSteps = input.Options.MaxSteps
+	info.ForceCriterionEVA = input.Options.Fmax
+
+	stdout, err := os.ReadFile(filepath.Join(workDir, stdoutFile))
+	converged, seen := false, false
+	if err == nil {
+		converged, seen = r.outputParser.ParseGeometryConvergence(string(stdout))
 	}
-	
-	result["energies_hartree"] = map[string]float64{
-		"total": -3.6749, // Placeholder value (converted from eV)
+	if !seen {
+		// Fall back to the final forces when the driver left no verdict
+		converged = len(output.Atoms) > 0 && output.Forces.MaxComponentEVA <= input.Options.Fmax
+		output.Summary.Warnings = append(output.Summary.Warnings, "no geometry convergence message found in the DFTB+ output; convergence judged from the final forces")
 	}
+	info.GeometryConverged = converged
+	info.MaxStepsReached = !converged && info.MaxSteps > 0 && info.GeometrySteps > info.MaxSteps
 
-	// Parse electronic properties (simplified)
-	result["electronic_properties"] = map[string]interface{}{
-		"fermi_level_eV": -5.0,
-		"total_charge":   0.0,
-		"dipole_moment_debye": map[string]float64{
-			"x": 0.0,
-			"y": 0.0,
-			"z": 0.0,
-		},
+	switch {
+	case !info.SCCConverged:
+		output.Summary.ConvergenceStatus = "scc_not_converged"
+		output.Summary.Warnings = append(output.Summary.Warnings, "the final SCC cycle did not converge; energies, forces and geometry are unreliable")
+	case !info.GeometryConverged:
+		output.Summary.ConvergenceStatus = "not_converged"
+		if info.MaxStepsReached {
+			output.Summary.Warnings = append(output.Summary.Warnings, fmt.Sprintf("geometry optimization stopped after MaxSteps = %d without reaching fmax = %g eV/Angstrom (final max force component %.4f eV/Angstrom)", info.MaxSteps, input.Options.Fmax, output.Forces.MaxComponentEVA))
+		} else {
+			output.Summary.Warnings = append(output.Summary.Warnings, fmt.Sprintf("geometry optimization did not reach fmax = %g eV/Angstrom (final max force component %.4f eV/Angstrom)", input.Options.Fmax, output.Forces.MaxComponentEVA))
+		}
+	default:
+		output.Summary.ConvergenceStatus = "converged"
+	}
+}
+
+// parseElectronicStructure reads the eigenvalue spectrum from band.out and
+// adds the density of states when requested. Problems are reported as
+// warnings since the optimization itself succeeded.
+func (r *DFTBRunner) parseElectronicStructure(workDir string, request *types.OptimizationRequest, output *types.DFTBOutput) {
+	content, err := os.ReadFile(filepath.Join(workDir, "band.out"))
+	if err != nil {
+		output.Summary.Warnings = append(output.Summary.Warnings, "band.out not found; no eigenvalues reported")
+		return
+	}
+
+	structure, err := r.outputParser.ParseBandOut(string(content))
+	if err != nil {
+		output.Summary.Warnings = append(output.Summary.Warnings, fmt.Sprintf("failed to parse band.out: %v", err))
+		return
+	}
+
+	if request.DOS {
+		dos, err := r.outputParser.BroadenedDOS(structure, request.DOSBroadening)
+		if err != nil {
+			output.Summary.Warnings = append(output.Summary.Warnings, fmt.Sprintf("density of states not computed: %v", err))
+		} else {
+			structure.DOS = dos
+		}
+	}
+
+	output.ElectronicStructure = structure
+}
+
+// assignAtomLabels maps the per-atom results onto the atom sites, which are
+// in the same order as the atoms of the DFTB+ geometry
+func (r *DFTBRunner) assignAtomLabels(output *types.DFTBOutput, cif *types.CIFFile) {
+	if len(output.Atoms) == 0 {
+		return
+	}
+
+	sites := cif.DataBlock.AtomSites
+	if len(output.Atoms) != len(sites) {
+		output.Summary.Warnings = append(output.Summary.Warnings, fmt.Sprintf(
+			"per-atom results cover %d atoms but the structure has %d; they are not reported", len(output.Atoms), len(sites)))
+		output.Atoms = nil
+		return
+	}
+
+	for i, site := range sites {
+		output.Atoms[i].Label = site.Label
+		output.Atoms[i].Element = site.Element
+	}
+}
+
+// embedCharges stores the Mulliken charges on the atom sites so that the
+// CIF writer adds an _atom_site_charge column
+func (r *DFTBRunner) embedCharges(optimized *types.CIFFile, output *types.DFTBOutput) {
+	sites := optimized.DataBlock.AtomSites
+	if len(output.Atoms) != len(sites) {
+		return
+	}
+
+	for i := range sites {
+		charge := output.Atoms[i].MullikenCharge
+		sites[i].Charge = &charge
+	}
+	optimized.DataBlocks = []types.CIFDataBlock{optimized.DataBlock}
+}
+
+// readFinalGeometry reads the last geometry of the optimization from
+// geo_end.gen, falling back to geo_end.xyz. The XYZ file carries no cell, so
+// periodic geometries read from it keep the input lattice.
+func (r *DFTBRunner) readFinalGeometry(workDir string, input *types.DFTBInput) (*types.DFTBGeometry, error) {
+	if content, err := os.ReadFile(filepath.Join(workDir, "geo_end.gen")); err == nil {
+		return r.genParser.ParseFromString(string(content))
+	}
+
+	// geo_end.xyz holds no lattice, so it cannot describe a relaxed cell
+	if input.Options.LatticeOpt {
+		return nil, fmt.Errorf("geo_end.gen with the relaxed lattice was not written")
+	}
+
+	content, err := os.ReadFile(filepath.Join(workDir, "geo_end.xyz"))
+	if err != nil {
+		return nil, fmt.Errorf("neither geo_end.gen nor geo_end.xyz was written")
+	}
+
+	geometry, err := r.genParser.ParseXYZ(string(content))
+	if err != nil {
+		return nil, err
 	}
+	geometry.Periodic = input.Geometry.Periodic
+	geometry.Origin = input.Geometry.Origin
+	geometry.LatticeVectors = input.Geometry.LatticeVectors
 
-	return result, nil
+	return geometry, nil
+}
+
+// optimizedStructure builds the optimized structure from the original atom
+// sites and the final DFTB+ geometry, taking over the relaxed lattice of
+// periodic structures
+func (r *DFTBRunner) optimizedStructure(originalCIF *types.CIFFile, final *types.DFTBGeometry) (*types.CIFFile, error) {
+	sites := originalCIF.DataBlock.AtomSites
+	if len(final.Coordinates) != len(sites) {
+		return nil, fmt.Errorf("final geometry has %d atoms, expected %d", len(final.Coordinates), len(sites))
+	}
+
+	// Computed values carry no experimental uncertainties, and the bond and
+	// angle lists of the input describe the old geometry
+	optimized := &types.CIFFile{DataBlock: originalCIF.DataBlock}
+	optimized.DataBlock.Uncertainties = nil
+	parser.DropGeometryLists(&optimized.DataBlock)
+	optimized.DataBlock.AtomSites = make([]types.AtomSite, len(sites))
+
+	positions := make([][3]float64, len(sites))
+	for i, atom := range sites {
+		species := final.Species[i]
+		if species < 0 || species >= len(final.Elements) || !strings.EqualFold(final.Elements[species], atom.Element) {
+			return nil, fmt.Errorf("atom %d of the final geometry does not match atom site %s", i+1, atom.Label)
+		}
+
+		coord := final.Coordinates[i]
+		positions[i] = [3]float64{coord[0] - final.Origin[0], coord[1] - final.Origin[1], coord[2] - final.Origin[2]}
+
+		atom.Uncertainties = nil
+		optimized.DataBlock.AtomSites[i] = atom
+	}
+
+	var lattice *[3][3]float64
+	if final.Periodic {
+		lattice = &final.LatticeVectors
+	}
+	if err := parser.SetStructureFromCartesian(&optimized.DataBlock, lattice, positions); err != nil {
+		return nil, err
+	}
+	optimized.DataBlocks = []types.CIFDataBlock{optimized.DataBlock}
+
+	return optimized, nil
 }
 
 // generateOptimizedCIF generates optimized CIF file
-func (r *DFTBRunner) generateOptimizedCIF(workDir string, originalCIF *types.CIFFile, parsedData map[string]interface{}) (string, error) {
-	// In a real implementation, you would parse the optimized coordinates from DFTB+ output
-	// For now, we'll create a simple optimized CIF based on the original structure
-	
-	var content strings.Builder
-	
-	content.WriteString("data_" + originalCIF.DataBlock.Name + "_optimized\n")
-	content.WriteString("# Optimized structure from DFTB+\n")
-	content.WriteString("_audit_creation_method            'DFTB+ geometry optimization'\n")
-	content.WriteString("_audit_creation_date               '" + time.Now().Format("2006-01-02") + "'\n")
-	content.WriteString("\n")
-	
-	// Cell parameters (unchanged for this example)
-	for key, value := range originalCIF.DataBlock.CellLength {
-		content.WriteString(fmt.Sprintf("%s %8.6f\n", key, value))
-	}
-	
-	for key, value := range originalCIF.DataBlock.CellAngle {
-		content.WriteString(fmt.Sprintf("%s %8.6f\n", key, value))
-	}
-	
-	content.WriteString("\n")
-	content.WriteString("loop_\n")
-	content.WriteString("_atom_site_label\n")
-	content.WriteString("_atom_site_type_symbol\n")
-	content.WriteString("_atom_site_fract_x\n")
-	content.WriteString("_atom_site_fract_y\n")
-	content.WriteString("_atom_site_fract_z\n")
-	content.WriteString("_atom_site_U_iso_or_equiv\n")
-	
-	// Atom sites (slightly modified for this example)
-	for i, atom := range originalCIF.DataBlock.AtomSites {
-		// Apply small random displacement to simulate optimization
-		displacement := 0.001
-		optimizedX := atom.FractX + displacement*float64(i+1)
-		optimizedY := atom.FractY + displacement*float64(i+2)
-		optimizedZ := atom.FractZ + displacement*float64(i+3)
-		
-		uIso := atom.UIsoOrEquiv
-		if uIso == 0 {
-			uIso = 0.01
-		}
-		
-		content.WriteString(fmt.Sprintf("%s %s %12.8f %12.8f %12.8f %8.6f\n",
-			atom.Label, atom.TypeSymbol, optimizedX, optimizedY, optimizedZ, uIso))
-	}
-	
+func (r *DFTBRunner) generateOptimizedCIF(workDir string, request *types.OptimizationRequest, input *types.DFTBInput, optimized *types.CIFFile, parsedData *types.DFTBOutput) (string, error) {
+	options := &parser.CIFWriteOptions{
+		BlockName: optimized.DataBlock.Name + "_optimized",
+		Provenance: []parser.CIFItem{
+			{Tag: "_audit_creation_method", Value: "DFTB+ geometry optimization"},
+			{Tag: "_audit_creation_date", Value: time.Now().Format("2006-01-02")},
+			{Tag: "_computing_structure_refinement", Value: "DFTB+ (" + request.Method + ")"},
+			{Tag: "_dftbopt_source_data_block", Value: optimized.DataBlock.Name},
+			{Tag: "_dftbopt_method", Value: request.Method},
+			{Tag: "_dftbopt_fmax_eV_A", Value: strconv.FormatFloat(request.Fmax, 'g', -1, 64)},
+			{Tag: "_dftbopt_convergence_status", Value: parsedData.Summary.ConvergenceStatus},
+		},
+	}
+
+	if input.Options.LatticeOpt {
+		options.Provenance = append(options.Provenance,
+			parser.CIFItem{Tag: "_dftbopt_lattice_mode", Value: input.Options.LatticeMode},
+			parser.CIFItem{Tag: "_dftbopt_pressure_GPa", Value: strconv.FormatFloat(input.Options.PressureGPa, 'g', -1, 64)},
+		)
+	}
+
+	if input.Hamiltonian.ParameterSet != "" {
+		options.Provenance = append(options.Provenance, parser.CIFItem{Tag: "_dftbopt_parameter_set", Value: input.Hamiltonian.ParameterSet})
+	}
+
+	if request.IncludeCIFProperties {
+		options.ExtraLoops = append(options.ExtraLoops, r.energyLoop(parsedData))
+	}
+
+	content, err := r.cifWriter.Write(optimized, options)
+	if err != nil {
+		return "", err
+	}
+
 	// Write to file
 	optimizedPath := filepath.Join(workDir, "optimized.cif")
-	if err := os.WriteFile(optimizedPath, []byte(content.String()), 0644); err != nil {
+	if err := os.WriteFile(optimizedPath, []byte(content), 0644); err != nil {
 		return "", fmt.Errorf("failed to write optimized CIF: %v", err)
 	}
-	
+
 	return optimizedPath, nil
 }
 
-// createErrorResponse creates an error response
+// generateOptimizedOutput writes the optimized structure in a non-CIF output
+// format and returns the file content
+func (r *DFTBRunner) generateOptimizedOutput(workDir, format string, optimized *types.CIFFile, parsedData *types.DFTBOutput) (string, error) {
+	switch format {
+	case parser.FormatExtXYZ:
+		return r.generateOptimizedExtXYZ(workDir, optimized, parsedData)
+	case parser.FormatPOSCAR:
+		content, err := r.poscarWriter.Write(optimized, optimized.DataBlock.Name+" optimized with DFTB+")
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(workDir, "CONTCAR"), []byte(content), 0644); err != nil {
+			return "", fmt.Errorf("failed to write optimized POSCAR: %v", err)
+		}
+		return content, nil
+	}
+	return "", fmt.Errorf("unsupported output format: %s", format)
+}
+
+// generateOptimizedExtXYZ writes the optimized structure as extended XYZ,
+// adding per-atom forces and charges as property columns when the output
+// provides them, and returns the file content
+func (r *DFTBRunner) generateOptimizedExtXYZ(workDir string, optimized *types.CIFFile, parsedData *types.DFTBOutput) (string, error) {
+	frame, err := r.xyzWriter.FrameFromCIF(optimized)
+	if err != nil {
+		return "", err
+	}
+	frame.Info = []parser.CIFItem{{Tag: "name", Value: optimized.DataBlock.Name + "_optimized"}}
+
+	if total, ok := parsedData.EnergiesEV["total"]; ok {
+		frame.Info = append(frame.Info, parser.CIFItem{Tag: "energy", Value: strconv.FormatFloat(total, 'f', 8, 64)})
+	}
+
+	if len(parsedData.Atoms) == len(frame.Species) {
+		forces := parser.ExtXYZProperty{Name: "forces"}
+		charges := parser.ExtXYZProperty{Name: "charges"}
+		for _, atom := range parsedData.Atoms {
+			forces.Values = append(forces.Values, []float64{atom.ForceEVA[0], atom.ForceEVA[1], atom.ForceEVA[2]})
+			charges.Values = append(charges.Values, []float64{atom.MullikenCharge})
+		}
+		frame.Properties = append(frame.Properties, forces, charges)
+	}
+
+	content, err := r.xyzWriter.Write(frame)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(filepath.Join(workDir, "optimized.extxyz"), []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write optimized extended XYZ: %v", err)
+	}
+
+	return content, nil
+}
+
+// energyLoop builds a custom CIF loop of the computed energies
+func (r *DFTBRunner) energyLoop(parsedData *types.DFTBOutput) types.CIFLoop {
+	loop := types.CIFLoop{Tags: []string{"_dftbopt_energy_term", "_dftbopt_energy_eV"}}
+
+	energies := parsedData.EnergiesEV
+	terms := make([]string, 0, len(energies))
+	for term := range energies {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	for _, term := range terms {
+		loop.Rows = append(loop.Rows, []string{term, strconv.FormatFloat(energies[term], 'f', 6, 64)})
+	}
+
+	return loop
+}
+
+// createErrorResponse creates an error response. Classified DFTB+ failures
+// also carry their error code and remediation hint.
 func (r *DFTBRunner) createErrorResponse(requestID string, err error) (*types.OptimizationResponse, error) {
-	return &types.OptimizationResponse{
+	response := &types.OptimizationResponse{
 		Status:       "error",
 		RequestID:    requestID,
 		ErrorMessage: err.Error(),
-	}, nil
+	}
+
+	var calcErr *CalculationError
+	if errors.As(err, &calcErr) {
+		response.ErrorCode = calcErr.Code
+		response.RemediationHint = calcErr.Hint
+	}
+
+	return response, nil
+}
+
+// createBlockErrorResponse creates an error response for a data block job
+func (r *DFTBRunner) createBlockErrorResponse(jobID, blockName string, err error) (*types.OptimizationResponse, error) {
+	response, _ := r.createErrorResponse(jobID, err)
+	response.DataBlock = blockName
+	return response, nil
 }
 
 // ValidateRequest validates the optimization request
@@ -341,43 +1012,190 @@ func (r *DFTBRunner) ValidateRequest(request *types.OptimizationRequest) error {
 	if request.RequestID == "" {
 		return fmt.Errorf("request ID is required")
 	}
-	
+
 	if request.StructureFile == "" {
 		return fmt.Errorf("structure file is required")
 	}
-	
-	if request.Method != "GFN1-xTB" && request.Method != "GFN2-xTB" {
+
+	if request.Method != "GFN1-xTB" && request.Method != "GFN2-xTB" && !skparams.IsSKMethod(request.Method) {
 		return fmt.Errorf("invalid method: %s", request.Method)
 	}
-	
+
+	if request.ParameterSet != "" && !skparams.IsSKMethod(request.Method) {
+		return fmt.Errorf("parameter_set requires the %s or %s method", skparams.MethodDFTB, skparams.MethodDFTB3)
+	}
+
+	if (request.ThirdOrderFull != nil || request.DampXH != nil) && request.Method != skparams.MethodDFTB3 {
+		return fmt.Errorf("third_order_full and damp_xh require the %s method", skparams.MethodDFTB3)
+	}
+
 	if request.Fmax <= 0 {
 		return fmt.Errorf("fmax must be positive")
 	}
-	
+
+	if request.InputFormat != "" && !parser.IsValidStructureFormat(request.InputFormat) {
+		return fmt.Errorf("invalid input format: %s", request.InputFormat)
+	}
+
+	if request.OutputFormat != "" && !parser.IsValidStructureFormat(request.OutputFormat) {
+		return fmt.Errorf("invalid output format: %s", request.OutputFormat)
+	}
+
+	if request.DOSBroadening < 0 {
+		return fmt.Errorf("dos_broadening must not be negative")
+	}
+
+	if request.DOSBroadening > 0 && !request.DOS {
+		return fmt.Errorf("dos_broadening requires dos")
+	}
+
+	if request.LatticeMode != "" && !parser.IsValidLatticeMode(request.LatticeMode) {
+		return fmt.Errorf("invalid lattice mode: %s", request.LatticeMode)
+	}
+
+	if (request.LatticeMode != "" || request.PressureGPa != 0) && !request.LatticeOpt {
+		return fmt.Errorf("lattice_mode and pressure_gpa require lattice_opt")
+	}
+
+	if request.KPoints != nil && request.KPoints.Spacing != 0 && request.KPoints.Grid != nil {
+		return fmt.Errorf("k-point spacing and grid are mutually exclusive")
+	}
+
+	if request.DataBlock != "" && request.DataBlockIndex != nil {
+		return fmt.Errorf("data_block and data_block_index are mutually exclusive")
+	}
+
+	if request.Batch && (request.DataBlock != "" || request.DataBlockIndex != nil) {
+		return fmt.Errorf("batch mode optimizes every data block and cannot be combined with a data block selection")
+	}
+
+	if request.DataBlockIndex != nil && *request.DataBlockIndex < 0 {
+		return fmt.Errorf("data_block_index must not be negative")
+	}
+
+	if request.DisorderPolicy != "" && !parser.IsValidDisorderPolicy(request.DisorderPolicy) {
+		return fmt.Errorf("invalid disorder policy: %s", request.DisorderPolicy)
+	}
+
+	if request.DisorderGroup != "" && request.DisorderPolicy != parser.DisorderPolicyGroup {
+		return fmt.Errorf("disorder_group requires the %s disorder policy", parser.DisorderPolicyGroup)
+	}
+
+	if request.DisorderPolicy == parser.DisorderPolicyGroup && request.DisorderGroup == "" {
+		return fmt.Errorf("the %s disorder policy requires disorder_group", parser.DisorderPolicyGroup)
+	}
+
+	// Check the structure itself so unknown elements are reported per site
+	cif, err := r.parseStructure(request)
+	if err != nil {
+		return err
+	}
+
+	blocks := r.cifParser.SplitDataBlocks(cif)
+	if !request.Batch {
+		selected, err := r.cifParser.SelectDataBlock(cif, request.DataBlock, request.DataBlockIndex)
+		if err != nil {
+			return err
+		}
+		blocks = []*types.CIFFile{selected}
+	}
+
+	var registry *skparams.Registry
+	if skparams.IsSKMethod(request.Method) {
+		if registry, err = skparams.NewRegistry(r.config.SKDir); err != nil {
+			return err
+		}
+	}
+
+	for _, block := range blocks {
+		if err := r.cifParser.ValidateElements(block); err != nil {
+			return err
+		}
+		if len(request.Constraints) > 0 {
+			if err := r.validateConstraints(request, block); err != nil {
+				return fmt.Errorf("data block %s: %v", block.DataBlock.Name, err)
+			}
+		}
+		if request.LatticeOpt && block.DataBlock.NonPeriodic {
+			return fmt.Errorf("data block %s: lattice_opt requires a periodic structure", block.DataBlock.Name)
+		}
+		if request.KPoints != nil {
+			if block.DataBlock.NonPeriodic {
+				return fmt.Errorf("data block %s: k-points require a periodic structure", block.DataBlock.Name)
+			}
+			lattice, err := parser.LatticeFromDataBlock(&block.DataBlock)
+			if err != nil {
+				return fmt.Errorf("data block %s: invalid cell parameters: %v", block.DataBlock.Name, err)
+			}
+			if _, err := parser.GenerateKPoints(lattice, request.KPoints); err != nil {
+				return fmt.Errorf("data block %s: %v", block.DataBlock.Name, err)
+			}
+		}
+		if registry != nil {
+			if _, err := registry.Resolve(request.ParameterSet, request.Method, blockElements(block)); err != nil {
+				return fmt.Errorf("data block %s: %v", block.DataBlock.Name, err)
+			}
+		}
+	}
+
 	return nil
 }
 
+// validateConstraints checks the constraints of a request against the atom
+// list of a data block, prepared as the run prepares it
+func (r *DFTBRunner) validateConstraints(request *types.OptimizationRequest, block *types.CIFFile) error {
+	cif, err := r.cifParser.ApplyDisorderPolicy(block, r.disorderPolicy(request), request.DisorderGroup)
+	if err != nil {
+		return fmt.Errorf("failed to resolve disorder: %v", err)
+	}
+	if cif, err = r.cifParser.ExpandSymmetry(cif); err != nil {
+		return fmt.Errorf("failed to apply symmetry operations: %v", err)
+	}
+	if cif, err = r.cifParser.ApplyConstraints(cif, request.Constraints); err != nil {
+		return fmt.Errorf("invalid constraints: %v", err)
+	}
+	// Rejects constraints that leave nothing to optimize
+	if _, err := r.cifParser.ToDFTBInput(cif, request.Method, request.Fmax); err != nil {
+		return fmt.Errorf("invalid constraints: %v", err)
+	}
+	return nil
+}
+
+// blockElements returns the distinct elements of a data block in order of
+// first appearance
+func blockElements(cif *types.CIFFile) []string {
+	seen := make(map[string]bool)
+	var list []string
+	for _, site := range cif.DataBlock.AtomSites {
+		if site.Element != "" && !seen[site.Element] {
+			seen[site.Element] = true
+			list = append(list, site.Element)
+		}
+	}
+	return list
+}
+
 // GetStatus returns the status of a running calculation
 func (r *DFTBRunner) GetStatus(requestID string) (string, error) {
 	requestDir := filepath.Join(r.workDir, requestID)
-	
+
 	// Check if directory exists
 	if _, err := os.Stat(requestDir); os.IsNotExist(err) {
 		return "not_found", nil
 	}
-	
+
 	// Check for output file
 	outputPath := filepath.Join(requestDir, "dftb_out.hsd")
 	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
 		return "running", nil
 	}
-	
+
 	// Check for error file
 	errorPath := filepath.Join(requestDir, "error.log")
 	if _, err := os.Stat(errorPath); !os.IsNotExist(err) {
 		return "error", nil
 	}
-	
+
 	return "completed", nil
 }
 
@@ -387,12 +1205,16 @@ func (r *DFTBRunner) Cleanup(maxAge time.Duration) error {
 	if err != nil {
 		return fmt.Errorf("failed to read work directory: %v", err)
 	}
-	
+
 	now := time.Now()
-	
+
 	for _, entry := range entries {
 		if entry.IsDir() {
-			if now.Sub(entry.ModTime()) > maxAge {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if now.Sub(info.ModTime()) > maxAge {
 				dirPath := filepath.Join(r.workDir, entry.Name())
 				if err := os.RemoveAll(dirPath); err != nil {
 					fmt.Printf("Warning: failed to remove directory %s: %v\n", dirPath, err)
@@ -400,6 +1222,6 @@ func (r *DFTBRunner) Cleanup(maxAge time.Duration) error {
 			}
 		}
 	}
-	
+
 	return nil
 }
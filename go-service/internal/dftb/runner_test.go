@@ -0,0 +1,280 @@
+package dftb
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/hsd"
+	"dftbopt-mcp/go-service/internal/parser"
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+const waterXYZ = `3
+Properties=species:S:1:pos:R:3
+O  0.000  0.000  0.119
+H  0.000  0.763 -0.477
+H  0.000 -0.763 -0.477
+`
+
+const siliconXYZ = `8
+Lattice="5.43 0 0 0 5.43 0 0 0 5.43" Properties=species:S:1:pos:R:3 pbc="T T T"
+Si 0.0000 0.0000 0.0000
+Si 0.0000 2.7150 2.7150
+Si 2.7150 0.0000 2.7150
+Si 2.7150 2.7150 0.0000
+Si 1.3575 1.3575 1.3575
+Si 1.3575 4.0725 4.0725
+Si 4.0725 1.3575 4.0725
+Si 4.0725 4.0725 1.3575
+`
+
+const slabXYZ = `5
+Lattice="3.84 0 0 0 3.84 0 0 0 20" Properties=species:S:1:pos:R:3 pbc="T T T"
+Si 0.00 0.00 1.00
+Si 1.92 1.92 1.00
+Si 0.00 1.92 2.36
+Si 1.92 0.00 2.36
+O  0.96 0.96 3.50
+`
+
+func TestGenerateDFTBInputGolden(t *testing.T) {
+	tests := []struct {
+		name      string
+		structure string
+		request   types.OptimizationRequest
+	}{
+		{
+			name:      "gfn1_xtb",
+			structure: waterXYZ,
+			request:   types.OptimizationRequest{Method: "GFN1-xTB", Fmax: 0.05},
+		},
+		{
+			name:      "gfn2_xtb",
+			structure: waterXYZ,
+			request:   types.OptimizationRequest{Method: "GFN2-xTB", Fmax: 0.01},
+		},
+		{
+			name:      "dftb",
+			structure: waterXYZ,
+			request:   types.OptimizationRequest{Method: "DFTB", Fmax: 0.05},
+		},
+		{
+			name:      "dftb3",
+			structure: waterXYZ,
+			request:   types.OptimizationRequest{Method: "DFTB3", Fmax: 0.05, ParameterSet: "3ob"},
+		},
+		{
+			name:      "periodic_kpoints",
+			structure: siliconXYZ,
+			request: types.OptimizationRequest{Method: "GFN2-xTB", Fmax: 0.05, KPoints: &types.KPointSettings{
+				Scheme: parser.KPointSchemeMonkhorstPack,
+				Grid:   &[3]int{3, 3, 3},
+			}},
+		},
+		{
+			name:      "lattice_opt",
+			structure: siliconXYZ,
+			request: types.OptimizationRequest{Method: "GFN2-xTB", Fmax: 0.05, LatticeOpt: true,
+				LatticeMode: parser.LatticeModeIsotropic, PressureGPa: 1.5},
+		},
+		{
+			name:      "constraints",
+			structure: slabXYZ,
+			request: types.OptimizationRequest{Method: "GFN2-xTB", Fmax: 0.05, Constraints: []types.AtomConstraint{
+				{Region: &types.ConstraintRegion{Axis: "z", Layers: 1}},
+				{Elements: []string{"O"}, Axes: []string{"x", "y"}},
+			}},
+		},
+	}
+
+	skDir, err := filepath.Abs(filepath.Join("testdata", "skparams"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewDFTBRunner(&types.ServerConfig{SKDir: filepath.Join("testdata", "skparams")})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cif, err := runner.xyzParser.ParseFromString(tt.structure)
+			if err != nil {
+				t.Fatalf("failed to parse the structure: %v", err)
+			}
+			request := tt.request
+			_, input, err := runner.prepareInput(&request, cif)
+			if err != nil {
+				t.Fatalf("prepareInput: %v", err)
+			}
+			content, err := runner.generateDFTBInputContent(input)
+			if err != nil {
+				t.Fatalf("generateDFTBInputContent: %v", err)
+			}
+			// The Slater-Koster prefix is absolute; keep the golden files
+			// independent of the checkout location
+			got := strings.ReplaceAll(content, skDir, "<sk-dir>")
+
+			golden := filepath.Join("testdata", "golden", tt.name+".hsd")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatalf("failed to update %s: %v", golden, err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read %s (run with -update to create it): %v", golden, err)
+			}
+			if got != string(want) {
+				t.Errorf("dftb_in.hsd differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// hexagonalPOSCAR fixes the first atom, the c coordinate of the second and
+// the a coordinate of the third
+const hexagonalPOSCAR = `hexagonal
+1.0
+  2.0 0.0 0.0
+ -1.0 1.7320508075688772 0.0
+  0.0 0.0 5.0
+  C
+  3
+Selective dynamics
+Direct
+  0.0 0.0 0.0 F F F
+  0.3333333333 0.6666666667 0.5 T T F
+  0.6666666667 0.3333333333 0.5 F T T
+`
+
+func TestDriverLatticeConstraints(t *testing.T) {
+	runner := NewDFTBRunner(&types.ServerConfig{})
+	cif, err := runner.poscarParser.ParseFromString(hexagonalPOSCAR)
+	if err != nil {
+		t.Fatalf("failed to parse the structure: %v", err)
+	}
+	request := &types.OptimizationRequest{Method: "GFN2-xTB", Fmax: 0.05, KPoints: &types.KPointSettings{Scheme: parser.KPointSchemeGamma}}
+	_, input, err := runner.prepareInput(request, cif)
+	if err != nil {
+		t.Fatalf("prepareInput: %v", err)
+	}
+	moved, constraints, err := runner.movedAtoms(input)
+	if err != nil {
+		t.Fatalf("movedAtoms: %v", err)
+	}
+
+	content, err := runner.hsdWriter.Write(hsd.NewDocument(hsd.NewProperty("MovedAtoms", moved), hsd.NewBlock("Constraints", constraints...)))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	if lines[0] != "MovedAtoms = 2 3" {
+		t.Errorf("got %q, want the frozen atom left out of MovedAtoms", lines[0])
+	}
+
+	// A fixed lattice coordinate is constrained along its reciprocal vector
+	want := [][4]float64{{2, 0, 0, 1}, {3, math.Sqrt(3) / 2, 0.5, 0}}
+	var rows [][4]float64
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		var row [4]float64
+		for k, field := range fields {
+			if row[k], err = strconv.ParseFloat(field, 64); err != nil {
+				t.Fatalf("invalid constraint line %q", line)
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got constraints %v, want %v", rows, want)
+	}
+	for i := range want {
+		for k := range want[i] {
+			if math.Abs(rows[i][k]-want[i][k]) > 1e-9 {
+				t.Errorf("constraint %d: got %v, want %v", i+1, rows[i], want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestReadFinalGeometry(t *testing.T) {
+	const relaxedGen = "1 F\nSi\n1 1 0.5 0.5 0.5\n0 0 0\n5.2 0 0\n0 5.2 0\n0 0 5.2\n"
+	const lastXYZ = "1\nGeometry Step: 0\nSi 2.5 2.5 2.5\n1\nGeometry Step: 3\nSi 2.4 2.5 2.5 0.0\n"
+
+	input := &types.DFTBInput{}
+	input.Geometry.Periodic = true
+	input.Geometry.LatticeVectors = [3][3]float64{{5, 0, 0}, {0, 5, 0}, {0, 0, 5}}
+
+	tests := []struct {
+		name       string
+		files      map[string]string
+		latticeOpt bool
+		coordinate []float64
+		lattice    float64
+		err        string
+	}{
+		{
+			name:       "relaxed lattice from geo_end.gen",
+			files:      map[string]string{"geo_end.gen": relaxedGen, "geo_end.xyz": lastXYZ},
+			latticeOpt: true,
+			coordinate: []float64{2.6, 2.6, 2.6},
+			lattice:    5.2,
+		},
+		{
+			name:       "last frame of geo_end.xyz keeps the input lattice",
+			files:      map[string]string{"geo_end.xyz": lastXYZ},
+			coordinate: []float64{2.4, 2.5, 2.5},
+			lattice:    5,
+		},
+		{
+			name:       "variable cell without geo_end.gen",
+			files:      map[string]string{"geo_end.xyz": lastXYZ},
+			latticeOpt: true,
+			err:        "relaxed lattice was not written",
+		},
+		{
+			name: "no geometry",
+			err:  "neither geo_end.gen nor geo_end.xyz",
+		},
+	}
+	runner := NewDFTBRunner(&types.ServerConfig{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			input.Options.LatticeOpt = tt.latticeOpt
+
+			geometry, err := runner.readFinalGeometry(workDir, input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readFinalGeometry: %v", err)
+			}
+			if !geometry.Periodic || geometry.LatticeVectors[0][0] != tt.lattice {
+				t.Errorf("got periodic %v and lattice %v, want a = %v", geometry.Periodic, geometry.LatticeVectors, tt.lattice)
+			}
+			for k, want := range tt.coordinate {
+				if math.Abs(geometry.Coordinates[0][k]-want) > 1e-9 {
+					t.Errorf("got coordinates %v, want %v", geometry.Coordinates[0], tt.coordinate)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package dftb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/parser"
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// Files written to the job directory
+const (
+	stdoutFile     = "stdout.log"
+	trajectoryFile = "trajectory.json"
+)
+
+// forceToEVPerAngstrom converts forces from Hartree/Bohr to eV/Angstrom
+const forceToEVPerAngstrom = parser.HartreeToEV / parser.BohrToAngstrom
+
+// saveTrajectory combines the per-step geometries DFTB+ appends to
+// geo_end.xyz with the per-step energies and forces of its standard output
+// and stores the result as trajectory.json in the job directory. geo_end.xyz
+// holds no cell: fixed-cell frames take the input lattice, while a
+// variable-cell run only knows the cell of its last step, from the final
+// geometry, and leaves it out of the others.
+func (r *DFTBRunner) saveTrajectory(workDir, jobID string, input *types.DFTBInput, final *types.DFTBGeometry) error {
+	stdout, err := os.ReadFile(filepath.Join(workDir, stdoutFile))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", stdoutFile, err)
+	}
+	steps := r.outputParser.ParseGeometrySteps(string(stdout))
+	if len(steps) == 0 {
+		return fmt.Errorf("no geometry steps found in the DFTB+ output")
+	}
+
+	var geometries []*types.DFTBGeometry
+	if content, err := os.ReadFile(filepath.Join(workDir, "geo_end.xyz")); err == nil {
+		if geometries, err = r.genParser.ParseXYZFrames(string(content)); err != nil {
+			return fmt.Errorf("failed to parse geo_end.xyz: %v", err)
+		}
+	}
+
+	trajectory := &types.Trajectory{
+		RequestID:      jobID,
+		Periodic:       input.Geometry.Periodic,
+		LatticeVectors: input.Geometry.LatticeVectors,
+	}
+
+	for i, step := range steps {
+		frame := types.TrajectoryFrame{
+			Step:        step.Step,
+			EnergyEV:    step.EnergyHartree * parser.HartreeToEV,
+			MaxForceEVA: step.MaxForce * forceToEVPerAngstrom,
+		}
+
+		// geo_end.xyz holds one frame per step in the same order
+		if i < len(geometries) {
+			geometry := geometries[i]
+			for _, species := range geometry.Species {
+				frame.Elements = append(frame.Elements, geometry.Elements[species])
+			}
+			frame.Coordinates = geometry.Coordinates
+			frame.LatticeVectors = stepLattice(input, final, i == len(geometries)-1)
+		}
+
+		trajectory.Frames = append(trajectory.Frames, frame)
+	}
+
+	content, err := json.MarshalIndent(trajectory, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(workDir, trajectoryFile), content, 0644)
+}
+
+// stepLattice returns the cell of a trajectory frame, or nil when it is not
+// known
+func stepLattice(input *types.DFTBInput, final *types.DFTBGeometry, last bool) *[3][3]float64 {
+	if !input.Geometry.Periodic {
+		return nil
+	}
+	if !input.Options.LatticeOpt {
+		lattice := input.Geometry.LatticeVectors
+		return &lattice
+	}
+	if last && final != nil && final.Periodic {
+		lattice := final.LatticeVectors
+		return &lattice
+	}
+	return nil
+}
+
+// GetTrajectory returns the stored trajectory of a job. Coordinates are
+// only included when requested.
+func (r *DFTBRunner) GetTrajectory(requestID string, includeCoordinates bool) (*types.Trajectory, error) {
+	jobDir, err := r.jobDir(requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(jobDir, trajectoryFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no trajectory found for request %s", requestID)
+		}
+		return nil, fmt.Errorf("failed to read trajectory: %v", err)
+	}
+
+	trajectory := &types.Trajectory{}
+	if err := json.Unmarshal(content, trajectory); err != nil {
+		return nil, fmt.Errorf("failed to decode trajectory: %v", err)
+	}
+
+	if !includeCoordinates {
+		for i := range trajectory.Frames {
+			trajectory.Frames[i].Elements = nil
+			trajectory.Frames[i].Coordinates = nil
+			trajectory.Frames[i].LatticeVectors = nil
+		}
+	}
+
+	return trajectory, nil
+}
+
+// GetTrajectoryExtXYZ returns the stored trajectory of a job as a
+// multi-frame extended XYZ file with the energy and largest force of every
+// step on its comment line. Frames of a periodic run whose cell is unknown
+// are written without a lattice rather than with the input cell.
+func (r *DFTBRunner) GetTrajectoryExtXYZ(requestID string) (string, error) {
+	trajectory, err := r.GetTrajectory(requestID, true)
+	if err != nil {
+		return "", err
+	}
+
+	var frames []*parser.ExtXYZFrame
+	for _, step := range trajectory.Frames {
+		if len(step.Coordinates) == 0 {
+			continue
+		}
+
+		frame := &parser.ExtXYZFrame{
+			Species: step.Elements,
+			Info: []parser.CIFItem{
+				{Tag: "step", Value: strconv.Itoa(step.Step)},
+				{Tag: "energy", Value: strconv.FormatFloat(step.EnergyEV, 'f', 8, 64)},
+				{Tag: "max_force", Value: strconv.FormatFloat(step.MaxForceEVA, 'f', 8, 64)},
+			},
+		}
+		if trajectory.Periodic {
+			frame.Lattice = step.LatticeVectors
+		}
+		for _, coord := range step.Coordinates {
+			frame.Positions = append(frame.Positions, [3]float64{coord[0], coord[1], coord[2]})
+		}
+
+		frames = append(frames, frame)
+	}
+
+	if len(frames) == 0 {
+		return "", fmt.Errorf("trajectory of request %s has no geometries", requestID)
+	}
+
+	return r.xyzWriter.Write(frames...)
+}
+
+// jobDir returns the directory of a job, rejecting IDs that would escape
+// the work directory
+func (r *DFTBRunner) jobDir(requestID string) (string, error) {
+	if requestID == "" || requestID == "." || requestID == ".." || strings.ContainsAny(requestID, `/\`) {
+		return "", fmt.Errorf("invalid request ID: %q", requestID)
+	}
+	return filepath.Join(r.workDir, requestID), nil
+}
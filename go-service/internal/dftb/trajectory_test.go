@@ -0,0 +1,85 @@
+package dftb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+const trajectoryStdout = `Geometry step: 0
+Total Energy:                      -1.0000000000 H          -27.2114 eV
+Maximal force component:            0.1000E-01
+Geometry step: 1
+Total Energy:                      -1.1000000000 H          -29.9325 eV
+Maximal force component:            0.1000E-03
+`
+
+const trajectoryXYZ = `1
+Geometry Step: 0
+Si 0.0 0.0 0.0
+1
+Geometry Step: 1
+Si 0.1 0.0 0.0
+`
+
+func TestTrajectoryLattice(t *testing.T) {
+	input := &types.DFTBInput{}
+	input.Geometry.Periodic = true
+	input.Geometry.LatticeVectors = [3][3]float64{{5, 0, 0}, {0, 5, 0}, {0, 0, 5}}
+	final := &types.DFTBGeometry{Periodic: true, LatticeVectors: [3][3]float64{{5.2, 0, 0}, {0, 5.2, 0}, {0, 0, 5.2}}}
+
+	tests := []struct {
+		name       string
+		latticeOpt bool
+		lattices   []string
+	}{
+		{"fixed cell", false, []string{`Lattice="5.00000000 0.00000000`, `Lattice="5.00000000 0.00000000`}},
+		// Only the cell of the last step is known
+		{"variable cell", true, []string{"", `Lattice="5.20000000 0.00000000`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			jobDir := filepath.Join(root, "job")
+			if err := os.MkdirAll(jobDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range map[string]string{stdoutFile: trajectoryStdout, "geo_end.xyz": trajectoryXYZ} {
+				if err := os.WriteFile(filepath.Join(jobDir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			runner := NewDFTBRunner(&types.ServerConfig{WorkDir: root})
+			input.Options.LatticeOpt = tt.latticeOpt
+			if err := runner.saveTrajectory(jobDir, "job", input, final); err != nil {
+				t.Fatalf("saveTrajectory: %v", err)
+			}
+			content, err := runner.GetTrajectoryExtXYZ("job")
+			if err != nil {
+				t.Fatalf("GetTrajectoryExtXYZ: %v", err)
+			}
+
+			var comments []string
+			for _, line := range strings.Split(content, "\n") {
+				if strings.Contains(line, "Properties=") {
+					comments = append(comments, line)
+				}
+			}
+			if len(comments) != len(tt.lattices) {
+				t.Fatalf("got %d frames, want %d:\n%s", len(comments), len(tt.lattices), content)
+			}
+			for i, comment := range comments {
+				switch {
+				case tt.lattices[i] == "" && strings.Contains(comment, "Lattice="):
+					t.Errorf("frame %d: got a lattice for an unknown cell: %s", i+1, comment)
+				case tt.lattices[i] != "" && !strings.HasPrefix(comment, tt.lattices[i]):
+					t.Errorf("frame %d: got %s, want %s...", i+1, comment, tt.lattices[i])
+				}
+			}
+		})
+	}
+}
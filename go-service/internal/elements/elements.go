@@ -0,0 +1,114 @@
+package elements
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bySymbol indexes the periodic table by lower-case symbol
+var bySymbol = make(map[string]Element, len(table))
+
+// isotopeAliases maps hydrogen isotope symbols onto hydrogen
+var isotopeAliases = map[string]string{
+	"d": "H",
+	"t": "H",
+}
+
+func init() {
+	for _, element := range table {
+		bySymbol[strings.ToLower(element.Symbol)] = element
+	}
+}
+
+// Lookup returns the element with the given symbol, ignoring case
+func Lookup(symbol string) (Element, bool) {
+	key := strings.ToLower(symbol)
+	if alias, ok := isotopeAliases[key]; ok {
+		key = strings.ToLower(alias)
+	}
+	element, ok := bySymbol[key]
+	return element, ok
+}
+
+// ByNumber returns the element with the given atomic number
+func ByNumber(number int) (Element, bool) {
+	if number < 1 || number > len(table) {
+		return Element{}, false
+	}
+	return table[number-1], true
+}
+
+// NormalizeTypeSymbol extracts the element from a CIF type symbol such as
+// "Fe3+", "O2-", "Cu1" or "CL", stripping oxidation states and suffixes
+func NormalizeTypeSymbol(typeSymbol string) (string, error) {
+	letters := leadingLetters(typeSymbol)
+	if letters == "" {
+		return "", fmt.Errorf("type symbol %q does not start with an element symbol", typeSymbol)
+	}
+
+	// Type symbols name the element first, so prefer a two-letter match
+	if len(letters) >= 2 {
+		if element, ok := Lookup(letters[:2]); ok {
+			return element.Symbol, nil
+		}
+	}
+	if element, ok := Lookup(letters[:1]); ok {
+		return element.Symbol, nil
+	}
+
+	return "", fmt.Errorf("unknown element in type symbol %q", typeSymbol)
+}
+
+// maxUpperCaseLabelNumber is the heaviest element an upper-case label such
+// as "CL1" is read as; heavier symbols would turn labels like "CN1" into Cn
+const maxUpperCaseLabelNumber = 94
+
+// InferFromLabel infers the element from an atom site label such as "C12",
+// "Ca1", "H1A" or "CL1". A lower-case second letter marks a two-letter
+// symbol. Upper-case labels follow the SHELX convention of writing the whole
+// symbol in capitals, so "CL1" is chlorine and "CA1" calcium; the label is
+// read as a one-letter symbol with a suffix when no such element exists.
+func InferFromLabel(label string) (string, error) {
+	letters := leadingLetters(label)
+	if letters == "" {
+		return "", fmt.Errorf("label %q does not start with an element symbol", label)
+	}
+
+	if len(letters) >= 2 {
+		if element, ok := Lookup(letters[:2]); ok {
+			lower := letters[1] >= 'a' && letters[1] <= 'z'
+			if lower || element.Number <= maxUpperCaseLabelNumber {
+				return element.Symbol, nil
+			}
+		}
+	}
+	if element, ok := Lookup(letters[:1]); ok {
+		return element.Symbol, nil
+	}
+
+	return "", fmt.Errorf("cannot infer an element from label %q", label)
+}
+
+// Resolve determines the element of an atom site from its type symbol, or
+// from its label when the type symbol is missing
+func Resolve(typeSymbol, label string) (string, error) {
+	if typeSymbol != "" && typeSymbol != "?" && typeSymbol != "." {
+		return NormalizeTypeSymbol(typeSymbol)
+	}
+
+	if label == "" {
+		return "", fmt.Errorf("atom site has neither a type symbol nor a label")
+	}
+
+	return InferFromLabel(label)
+}
+
+// leadingLetters returns the ASCII letters at the start of s
+func leadingLetters(s string) string {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && (s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z') {
+		end++
+	}
+	return s[:end]
+}
@@ -0,0 +1,123 @@
+package elements
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTypeSymbol(t *testing.T) {
+	tests := []struct {
+		typeSymbol string
+		want       string
+		err        string
+	}{
+		{"Fe", "Fe", ""},
+		{"Fe3+", "Fe", ""},
+		{"Fe+3", "Fe", ""},
+		{"Ca2+", "Ca", ""},
+		{"O2-", "O", ""},
+		{"O-2", "O", ""},
+		{"Cu1", "Cu", ""},
+		{"CL", "Cl", ""},
+		{"cl1-", "Cl", ""},
+		{" Si4+ ", "Si", ""},
+		{"N", "N", ""},
+		// A one-letter element followed by a letter that forms no symbol
+		{"Hw", "H", ""},
+		{"D", "H", ""},
+		{"3+", "", "does not start with an element symbol"},
+		{"Xx", "", "unknown element"},
+		{"Q1", "", "unknown element"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeTypeSymbol(tt.typeSymbol)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("NormalizeTypeSymbol(%q): got %q and error %v, want an error containing %q", tt.typeSymbol, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeTypeSymbol(%q): got %q and error %v, want %q", tt.typeSymbol, got, err, tt.want)
+		}
+	}
+}
+
+func TestInferFromLabel(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+		err   string
+	}{
+		{"C12", "C", ""},
+		{"Ca1", "Ca", ""},
+		{"Ca2+", "Ca", ""},
+		{"Fe3+", "Fe", ""},
+		{"CL1", "Cl", ""},
+		{"CA1", "Ca", ""},
+		{"O1A", "O", ""},
+		{"H1A", "H", ""},
+		{"N1'", "N", ""},
+		// No element Hw, Ow or Ha: one-letter symbols with a suffix
+		{"Hw1", "H", ""},
+		{"OW1", "O", ""},
+		{"HA", "H", ""},
+		// Superheavy symbols are not read from upper-case labels
+		{"CN1", "C", ""},
+		{"Cn1", "Cn", ""},
+		{"1C", "", "does not start with an element symbol"},
+		{"Q1", "", "cannot infer an element"},
+	}
+	for _, tt := range tests {
+		got, err := InferFromLabel(tt.label)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("InferFromLabel(%q): got %q and error %v, want an error containing %q", tt.label, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("InferFromLabel(%q): got %q and error %v, want %q", tt.label, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		typeSymbol, label string
+		want              string
+	}{
+		// The type symbol wins over the label
+		{"Fe3+", "C1", "Fe"},
+		{"", "CL1", "Cl"},
+		{"?", "O1A", "O"},
+		{".", "Ca2+", "Ca"},
+	}
+	for _, tt := range tests {
+		if got, err := Resolve(tt.typeSymbol, tt.label); err != nil || got != tt.want {
+			t.Errorf("Resolve(%q, %q): got %q and error %v, want %q", tt.typeSymbol, tt.label, got, err, tt.want)
+		}
+	}
+	if _, err := Resolve("", ""); err == nil {
+		t.Errorf("expected an error for a site without type symbol and label")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for symbol, number := range map[string]int{"h": 1, "D": 1, "T": 1, "FE": 26, "og": 118} {
+		if element, ok := Lookup(symbol); !ok || element.Number != number {
+			t.Errorf("Lookup(%q): got %+v, %v, want number %d", symbol, element, ok, number)
+		}
+	}
+	if _, ok := Lookup("Xx"); ok {
+		t.Errorf("Lookup(\"Xx\") found an element")
+	}
+	if element, ok := ByNumber(14); !ok || element.Symbol != "Si" {
+		t.Errorf("ByNumber(14): got %+v, %v", element, ok)
+	}
+	for _, number := range []int{0, 119} {
+		if _, ok := ByNumber(number); ok {
+			t.Errorf("ByNumber(%d) found an element", number)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Package hsd builds DFTB+ input documents in the Human-readable Structured
+// Data format as a typed tree of blocks and properties
+package hsd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Node is an entry of a block: a property, a child block, a data row or an
+// include directive
+type Node interface {
+	write(content *strings.Builder, indent int) error
+}
+
+// Value is the right-hand side of a property or an item of a data row
+type Value interface {
+	format() (string, error)
+}
+
+// Document is the top level of an HSD input such as dftb_in.hsd
+type Document struct {
+	Nodes []Node
+}
+
+// NewDocument creates a document from its top-level nodes
+func NewDocument(nodes ...Node) *Document {
+	return &Document{Nodes: nodes}
+}
+
+// Add appends nodes to the document
+func (d *Document) Add(nodes ...Node) *Document {
+	d.Nodes = append(d.Nodes, nodes...)
+	return d
+}
+
+// Block is a named group of nodes. A typed block is written as
+// "Name = Type { ... }", as in "Hamiltonian = xTB { ... }"; an untyped one as
+// "Name { ... }".
+type Block struct {
+	Name     string
+	Type     string
+	Modifier string // Optional modifier such as a unit, written in brackets
+	Children []Node
+}
+
+// NewBlock creates an untyped block
+func NewBlock(name string, children ...Node) *Block {
+	return &Block{Name: name, Children: children}
+}
+
+// NewTypedBlock creates a block whose value is a method of the given type
+func NewTypedBlock(name, typ string, children ...Node) *Block {
+	return &Block{Name: name, Type: typ, Children: children}
+}
+
+// Add appends nodes to the block
+func (b *Block) Add(nodes ...Node) *Block {
+	b.Children = append(b.Children, nodes...)
+	return b
+}
+
+// WithModifier sets the modifier of the block
+func (b *Block) WithModifier(modifier string) *Block {
+	b.Modifier = modifier
+	return b
+}
+
+func (b *Block) write(content *strings.Builder, indent int) error {
+	head, err := header(b.Name, b.Modifier)
+	if err != nil {
+		return err
+	}
+	if b.Type != "" {
+		if !identifier.MatchString(b.Type) {
+			return fmt.Errorf("invalid block type %q for %s", b.Type, b.Name)
+		}
+		head += " = " + b.Type
+	}
+
+	pad := strings.Repeat("  ", indent)
+	if len(b.Children) == 0 {
+		content.WriteString(pad + head + " {}\n")
+		return nil
+	}
+
+	content.WriteString(pad + head + " {\n")
+	for _, child := range b.Children {
+		if err := child.write(content, indent+1); err != nil {
+			return fmt.Errorf("%s: %v", b.Name, err)
+		}
+	}
+	content.WriteString(pad + "}\n")
+	return nil
+}
+
+// Property is a "Name = Value" assignment
+type Property struct {
+	Name     string
+	Modifier string // Optional modifier such as a unit, written in brackets
+	Value    Value
+}
+
+// NewProperty creates a property
+func NewProperty(name string, value Value) *Property {
+	return &Property{Name: name, Value: value}
+}
+
+// WithModifier sets the modifier of the property, such as "eV/AA"
+func (p *Property) WithModifier(modifier string) *Property {
+	p.Modifier = modifier
+	return p
+}
+
+func (p *Property) write(content *strings.Builder, indent int) error {
+	head, err := header(p.Name, p.Modifier)
+	if err != nil {
+		return err
+	}
+	if p.Value == nil {
+		return fmt.Errorf("property %s has no value", p.Name)
+	}
+	value, err := p.Value.format()
+	if err != nil {
+		return fmt.Errorf("property %s: %v", p.Name, err)
+	}
+
+	content.WriteString(strings.Repeat("  ", indent) + head + " = " + value + "\n")
+	return nil
+}
+
+// Row is a line of free-form data inside a block, such as one constraint
+// or the rows of a k-point matrix
+type Row []Value
+
+// NewRow creates a data row
+func NewRow(values ...Value) Row {
+	return Row(values)
+}
+
+func (r Row) write(content *strings.Builder, indent int) error {
+	value, err := List(r).format()
+	if err != nil {
+		return err
+	}
+	content.WriteString(strings.Repeat("  ", indent) + value + "\n")
+	return nil
+}
+
+// Include inserts the raw content of a file, written as <<< "path"
+type Include string
+
+func (i Include) write(content *strings.Builder, indent int) error {
+	path, err := String(i).format()
+	if err != nil {
+		return fmt.Errorf("include: %v", err)
+	}
+	content.WriteString(strings.Repeat("  ", indent) + "<<< " + path + "\n")
+	return nil
+}
+
+// String is a quoted string value
+type String string
+
+func (s String) format() (string, error) {
+	value := string(s)
+	switch {
+	case strings.ContainsAny(value, "\n\r"):
+		return "", fmt.Errorf("string %q spans several lines", value)
+	case !strings.Contains(value, `"`):
+		return `"` + value + `"`, nil
+	case !strings.Contains(value, "'"):
+		return "'" + value + "'", nil
+	default:
+		return "", fmt.Errorf("string %q contains both quote characters", value)
+	}
+}
+
+// Word is an unquoted token such as an angular momentum ("p") or an atom
+// range ("1:-1")
+type Word string
+
+func (w Word) format() (string, error) {
+	if w == "" || strings.ContainsAny(string(w), " \t\n\r\"'{}=;#[]") {
+		return "", fmt.Errorf("%q cannot be written unquoted", string(w))
+	}
+	return string(w), nil
+}
+
+// Bool is a logical value, written as Yes or No
+type Bool bool
+
+func (b Bool) format() (string, error) {
+	if b {
+		return "Yes", nil
+	}
+	return "No", nil
+}
+
+// Int is an integer value
+type Int int
+
+func (i Int) format() (string, error) {
+	return strconv.Itoa(int(i)), nil
+}
+
+// Float is a real value
+type Float float64
+
+func (f Float) format() (string, error) {
+	value := float64(f)
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", fmt.Errorf("%v is not a finite number", value)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), nil
+}
+
+// List is a whitespace separated sequence of values
+type List []Value
+
+func (l List) format() (string, error) {
+	if len(l) == 0 {
+		return "", fmt.Errorf("empty list")
+	}
+	items := make([]string, len(l))
+	for i, value := range l {
+		item, err := value.format()
+		if err != nil {
+			return "", err
+		}
+		items[i] = item
+	}
+	return strings.Join(items, " "), nil
+}
+
+// identifier matches valid block, property and type names
+var identifier = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// header formats a name with its optional modifier
+func header(name, modifier string) (string, error) {
+	if !identifier.MatchString(name) {
+		return "", fmt.Errorf("invalid name %q", name)
+	}
+	if modifier == "" {
+		return name, nil
+	}
+	if strings.ContainsAny(modifier, "[]{}=\n\r") {
+		return "", fmt.Errorf("invalid modifier %q for %s", modifier, name)
+	}
+	return name + " [" + modifier + "]", nil
+}
+
+// Writer serializes HSD documents
+type Writer struct{}
+
+// NewWriter creates a new HSD writer instance
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// Write serializes a document with two-space indentation, separating the
+// top-level nodes by blank lines
+func (w *Writer) Write(document *Document) (string, error) {
+	if document == nil {
+		return "", fmt.Errorf("invalid HSD document")
+	}
+
+	var content strings.Builder
+	for i, node := range document.Nodes {
+		if i > 0 {
+			content.WriteString("\n")
+		}
+		if err := node.write(&content, 0); err != nil {
+			return "", err
+		}
+	}
+
+	return content.String(), nil
+}
@@ -0,0 +1,128 @@
+package hsd
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValueFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		value Value
+		want  string
+		err   string
+	}{
+		{name: "string", value: String("GFN2-xTB"), want: `"GFN2-xTB"`},
+		{name: "string with double quote", value: String(`say "hi"`), want: `'say "hi"'`},
+		{name: "string with single quote", value: String("it's"), want: `"it's"`},
+		{name: "string with both quotes", value: String(`it's "x"`), err: "both quote characters"},
+		{name: "multi-line string", value: String("a\nb"), err: "spans several lines"},
+		{name: "empty string", value: String(""), want: `""`},
+		{name: "word", value: Word("1:-1"), want: "1:-1"},
+		{name: "empty word", value: Word(""), err: "cannot be written unquoted"},
+		{name: "word with space", value: Word("a b"), err: "cannot be written unquoted"},
+		{name: "word with brace", value: Word("a}"), err: "cannot be written unquoted"},
+		{name: "yes", value: Bool(true), want: "Yes"},
+		{name: "no", value: Bool(false), want: "No"},
+		{name: "int", value: Int(-3), want: "-3"},
+		{name: "float", value: Float(0.05), want: "0.05"},
+		{name: "whole float", value: Float(1), want: "1"},
+		{name: "small float", value: Float(-0.1857e-5), want: "-1.857e-06"},
+		{name: "NaN", value: Float(math.NaN()), err: "not a finite number"},
+		{name: "infinity", value: Float(math.Inf(1)), err: "not a finite number"},
+		{name: "list", value: List{Int(1), Float(0.5), Word("x")}, want: "1 0.5 x"},
+		{name: "empty list", value: List{}, err: "empty list"},
+		{name: "list with invalid item", value: List{Int(1), Float(math.NaN())}, err: "not a finite number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.value.format()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %q, error %v, want an error containing %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("format: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriterDocument(t *testing.T) {
+	document := NewDocument(
+		NewTypedBlock("Geometry", "GenFormat", Include("geometry.gen")),
+		NewTypedBlock("Driver", "GeometryOptimization",
+			NewTypedBlock("Convergence", "Grad",
+				NewProperty("MaxForceComponent", Float(0.05)),
+			),
+			NewProperty("MovedAtoms", List{Int(2), Int(3)}),
+			NewBlock("Constraints", NewRow(Int(2), Float(0), Float(0), Float(1))),
+			NewProperty("Pressure", Float(1e9)).WithModifier("Pa"),
+		),
+		NewBlock("Options"),
+	).Add(NewBlock("ParserOptions", NewProperty("ParserVersion", Int(14))))
+
+	got, err := NewWriter().Write(document)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	want := `Geometry = GenFormat {
+  <<< "geometry.gen"
+}
+
+Driver = GeometryOptimization {
+  Convergence = Grad {
+    MaxForceComponent = 0.05
+  }
+  MovedAtoms = 2 3
+  Constraints {
+    2 0 0 1
+  }
+  Pressure [Pa] = 1e+09
+}
+
+Options {}
+
+ParserOptions {
+  ParserVersion = 14
+}
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		node Node
+		err  string
+	}{
+		{"invalid block name", NewBlock("Bad Name"), "invalid name"},
+		{"invalid block type", NewTypedBlock("Driver", "Geometry-Opt"), "invalid block type"},
+		{"invalid modifier", NewProperty("Pressure", Float(1)).WithModifier("Pa]"), "invalid modifier"},
+		{"property without value", NewProperty("MaxSteps", nil), "has no value"},
+		{"nested invalid value", NewBlock("Hamiltonian", NewBlock("Filling", NewProperty("Temperature", Float(math.NaN())))), "Hamiltonian: Filling: property Temperature"},
+		{"invalid include", Include("a\nb"), "include"},
+		{"empty row", NewBlock("Constraints", NewRow()), "empty list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWriter().Write(NewDocument(tt.node))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+
+	if _, err := NewWriter().Write(nil); err == nil {
+		t.Errorf("expected an error for a nil document")
+	}
+}
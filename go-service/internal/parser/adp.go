@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// anisoLabelTags are the normalised tags naming the site of an
+// anisotropic displacement parameter row
+var anisoLabelTags = []string{"_atom_site_aniso_label", "_atom_site_anisotrop_id"}
+
+// anisoLoop locates the anisotropic displacement parameter loop of a data
+// block and the columns holding its labels and tensor components
+type anisoLoop struct {
+	index      int
+	labelCol   int
+	components map[int][2]int // column -> tensor indices
+}
+
+// findAnisoLoop returns the anisotropic ADP loop of a data block, or nil
+func findAnisoLoop(dataBlock *types.CIFDataBlock) *anisoLoop {
+	for index, loop := range dataBlock.Loops {
+		aniso := &anisoLoop{index: index, labelCol: -1, components: make(map[int][2]int)}
+
+		for col, tag := range loop.Tags {
+			key := normalizeTag(tag)
+			if containsFold(anisoLabelTags, key) {
+				aniso.labelCol = col
+				continue
+			}
+			if i, j, ok := adpComponent(key); ok {
+				aniso.components[col] = [2]int{i, j}
+			}
+		}
+
+		if aniso.labelCol >= 0 {
+			return aniso
+		}
+	}
+	return nil
+}
+
+// adpComponent parses the tensor indices from tags such as
+// "_atom_site_aniso_u_12" or "_atom_site_anisotrop_b[1][2]"
+func adpComponent(key string) (int, int, bool) {
+	for _, prefix := range []string{"_atom_site_aniso_", "_atom_site_anisotrop_"} {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(key, prefix)
+		if rest == "" || rest[0] != 'u' && rest[0] != 'b' {
+			return 0, 0, false
+		}
+		digits := strings.NewReplacer("_", "", "[", "", "]", "").Replace(rest[1:])
+		if len(digits) != 2 || digits[0] < '1' || digits[0] > '3' || digits[1] < '1' || digits[1] > '3' {
+			return 0, 0, false
+		}
+		return int(digits[0] - '1'), int(digits[1] - '1'), true
+	}
+	return 0, 0, false
+}
+
+// rows returns the rows of the ADP loop keyed by site label
+func (a *anisoLoop) rows(dataBlock *types.CIFDataBlock) map[string][]string {
+	rows := make(map[string][]string)
+	for _, row := range dataBlock.Loops[a.index].Rows {
+		rows[row[a.labelCol]] = row
+	}
+	return rows
+}
+
+// transform returns a copy of an ADP row for the image of its site under op,
+// relabelled to label. ADPs are given along the reciprocal axes, so the
+// tensor is rotated as beta' = R beta R^T with beta = N U N and
+// N = diag(a*, b*, c*). Rows with unknown components are copied unchanged.
+func (a *anisoLoop) transform(row []string, label string, op *symOp, reciprocal [3]float64) []string {
+	out := append([]string(nil), row...)
+	out[a.labelCol] = label
+
+	if op.isIdentity() {
+		return out
+	}
+
+	var beta [3][3]float64
+	for col, ij := range a.components {
+		val, _, err := parseNumericValue(cifToken{kind: tokValue, text: row[col]})
+		if err != nil {
+			return out
+		}
+		i, j := ij[0], ij[1]
+		beta[i][j] = val * reciprocal[i] * reciprocal[j]
+		beta[j][i] = beta[i][j]
+	}
+
+	var rotated [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				for l := 0; l < 3; l++ {
+					rotated[i][j] += op.rotation[i][k] * beta[k][l] * op.rotation[j][l]
+				}
+			}
+		}
+	}
+
+	for col, ij := range a.components {
+		i, j := ij[0], ij[1]
+		out[col] = strconv.FormatFloat(rotated[i][j]/(reciprocal[i]*reciprocal[j]), 'f', 5, 64)
+	}
+
+	return out
+}
+
+// reciprocalLengths returns a*, b* and c* from an inverse lattice matrix,
+// whose columns are the reciprocal lattice vectors
+func reciprocalLengths(inverse [3][3]float64) [3]float64 {
+	var lengths [3]float64
+	for j := 0; j < 3; j++ {
+		var sq float64
+		for i := 0; i < 3; i++ {
+			sq += inverse[i][j] * inverse[i][j]
+		}
+		lengths[j] = math.Sqrt(sq)
+	}
+	return lengths
+}
+
+// filterAnisoLoop drops ADP rows whose site is not in labels
+func filterAnisoLoop(dataBlock *types.CIFDataBlock, labels map[string]bool) {
+	aniso := findAnisoLoop(dataBlock)
+	if aniso == nil {
+		return
+	}
+
+	loops := append([]types.CIFLoop(nil), dataBlock.Loops...)
+	filtered := types.CIFLoop{Tags: loops[aniso.index].Tags}
+	for _, row := range loops[aniso.index].Rows {
+		if labels[row[aniso.labelCol]] {
+			filtered.Rows = append(filtered.Rows, row)
+		}
+	}
+	loops[aniso.index] = filtered
+	dataBlock.Loops = loops
+}
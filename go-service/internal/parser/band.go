@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// Gaussian density of states defaults
+const (
+	DefaultDOSBroadening = 0.1   // eV
+	dosGridStep          = 0.01  // eV
+	dosGridMargin        = 5.0   // Broadening widths added below and above the spectrum
+	dosMaxPoints         = 20000 // Upper bound on the number of grid points
+)
+
+// ParseBandOut parses the eigenvalues (eV) and occupations of every k-point
+// and spin channel from band.out, then locates the HOMO, the LUMO and the
+// band gaps
+func (p *DFTBOutputParser) ParseBandOut(content string) (*types.ElectronicStructure, error) {
+	structure := &types.ElectronicStructure{}
+
+	var current *types.KPointEigenvalues
+	for n, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if strings.EqualFold(fields[0], "KPT") {
+			kpoint, err := bandHeader(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, err)
+			}
+			structure.KPoints = append(structure.KPoints, kpoint)
+			current = &structure.KPoints[len(structure.KPoints)-1]
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("line %d: eigenvalue before the first KPT header", n+1)
+		}
+
+		// Rows are "index eigenvalue occupation" or "eigenvalue occupation"
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected an eigenvalue and an occupation", n+1)
+		}
+		eigenvalue, err := parseFortranFloat(fields[len(fields)-2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid eigenvalue %q", n+1, fields[len(fields)-2])
+		}
+		occupation, err := parseFortranFloat(fields[len(fields)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid occupation %q", n+1, fields[len(fields)-1])
+		}
+		current.EigenvaluesEV = append(current.EigenvaluesEV, eigenvalue)
+		current.Occupations = append(current.Occupations, occupation)
+	}
+
+	if len(structure.KPoints) == 0 {
+		return nil, fmt.Errorf("no k-points found in band.out")
+	}
+
+	analyzeGaps(structure)
+	return structure, nil
+}
+
+// bandHeader parses a header such as "KPT 1 SPIN 1 KWEIGHT 0.25"
+func bandHeader(fields []string) (types.KPointEigenvalues, error) {
+	kpoint := types.KPointEigenvalues{KPoint: 1, Spin: 1, Weight: 1}
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		switch strings.ToUpper(fields[i]) {
+		case "KPT":
+			val, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return kpoint, fmt.Errorf("invalid k-point index %q", fields[i+1])
+			}
+			kpoint.KPoint = val
+		case "SPIN":
+			val, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return kpoint, fmt.Errorf("invalid spin index %q", fields[i+1])
+			}
+			kpoint.Spin = val
+		case "KWEIGHT":
+			val, err := parseFortranFloat(fields[i+1])
+			if err != nil {
+				return kpoint, fmt.Errorf("invalid k-point weight %q", fields[i+1])
+			}
+			kpoint.Weight = val
+		}
+	}
+
+	return kpoint, nil
+}
+
+// analyzeGaps locates the HOMO and LUMO and computes the fundamental and
+// direct gaps. A state counts as occupied when it holds at least half of the
+// maximal occupation of its spin channel. The gap is direct only when the
+// HOMO and LUMO share both k-point and spin channel.
+func analyzeGaps(structure *types.ElectronicStructure) {
+	halfFilled := spinDegeneracy(structure) / 2
+
+	homo, lumo := math.Inf(-1), math.Inf(1)
+	directGap := math.Inf(1)
+	for _, kpoint := range structure.KPoints {
+		kHomo, kLumo := math.Inf(-1), math.Inf(1)
+		for i, eigenvalue := range kpoint.EigenvaluesEV {
+			if kpoint.Occupations[i] >= halfFilled {
+				kHomo = math.Max(kHomo, eigenvalue)
+			} else {
+				kLumo = math.Min(kLumo, eigenvalue)
+			}
+		}
+
+		if kHomo > homo {
+			homo = kHomo
+			structure.HOMOKPoint = kpoint.KPoint
+			structure.HOMOSpin = kpoint.Spin
+		}
+		if kLumo < lumo {
+			lumo = kLumo
+			structure.LUMOKPoint = kpoint.KPoint
+			structure.LUMOSpin = kpoint.Spin
+		}
+		if !math.IsInf(kHomo, 0) && !math.IsInf(kLumo, 0) {
+			directGap = math.Min(directGap, kLumo-kHomo)
+		}
+	}
+
+	if math.IsInf(homo, 0) || math.IsInf(lumo, 0) {
+		// Every state is empty or every state is filled; no gap is defined
+		structure.GapType = "undefined"
+		return
+	}
+
+	structure.HOMOEV = homo
+	structure.LUMOEV = lumo
+	if !math.IsInf(directGap, 0) {
+		structure.DirectGapEV = math.Max(directGap, 0)
+	}
+
+	switch {
+	case lumo-homo <= 0:
+		structure.GapType = "metallic"
+		structure.DirectGapEV = 0
+	case structure.HOMOKPoint == structure.LUMOKPoint && structure.HOMOSpin == structure.LUMOSpin:
+		structure.BandGapEV = lumo - homo
+		structure.GapType = "direct"
+	default:
+		structure.BandGapEV = lumo - homo
+		structure.GapType = "indirect"
+	}
+}
+
+// spinDegeneracy returns the maximal occupation of a state: 2 for
+// spin-unpolarized and 1 for spin-polarized calculations
+func spinDegeneracy(structure *types.ElectronicStructure) float64 {
+	for _, kpoint := range structure.KPoints {
+		if kpoint.Spin > 1 {
+			return 1
+		}
+	}
+	return 2
+}
+
+// BroadenedDOS computes the density of states of an eigenvalue spectrum
+// with Gaussians of width sigma (eV), weighting every k-point by its
+// normalised weight
+func (p *DFTBOutputParser) BroadenedDOS(structure *types.ElectronicStructure, sigma float64) (*types.DensityOfStates, error) {
+	if sigma <= 0 {
+		sigma = DefaultDOSBroadening
+	}
+
+	// Normalise the k-point weights per spin channel
+	totalWeight := make(map[int]float64)
+	minE, maxE := math.Inf(1), math.Inf(-1)
+	for _, kpoint := range structure.KPoints {
+		totalWeight[kpoint.Spin] += kpoint.Weight
+		for _, eigenvalue := range kpoint.EigenvaluesEV {
+			minE = math.Min(minE, eigenvalue)
+			maxE = math.Max(maxE, eigenvalue)
+		}
+	}
+	if math.IsInf(minE, 0) {
+		return nil, fmt.Errorf("no eigenvalues to broaden")
+	}
+
+	start := minE - dosGridMargin*sigma
+	points := int(math.Ceil((maxE+dosGridMargin*sigma-start)/dosGridStep)) + 1
+	if points > dosMaxPoints {
+		return nil, fmt.Errorf("eigenvalue range of %.1f eV is too wide for a density of states", maxE-minE)
+	}
+
+	dos := &types.DensityOfStates{
+		BroadeningEV: sigma,
+		EnergiesEV:   make([]float64, points),
+		States:       make([]float64, points),
+	}
+	for i := range dos.EnergiesEV {
+		dos.EnergiesEV[i] = start + float64(i)*dosGridStep
+	}
+
+	degeneracy := spinDegeneracy(structure)
+	norm := 1 / (sigma * math.Sqrt(2*math.Pi))
+	cutoff := dosGridMargin * sigma
+	for _, kpoint := range structure.KPoints {
+		if totalWeight[kpoint.Spin] <= 0 {
+			continue
+		}
+		weight := degeneracy * kpoint.Weight / totalWeight[kpoint.Spin]
+
+		for _, eigenvalue := range kpoint.EigenvaluesEV {
+			first := int(math.Max(0, math.Floor((eigenvalue-cutoff-start)/dosGridStep)))
+			last := int(math.Min(float64(points-1), math.Ceil((eigenvalue+cutoff-start)/dosGridStep)))
+			for i := first; i <= last; i++ {
+				x := (dos.EnergiesEV[i] - eigenvalue) / sigma
+				dos.States[i] += weight * norm * math.Exp(-0.5*x*x)
+			}
+		}
+	}
+
+	return dos, nil
+}
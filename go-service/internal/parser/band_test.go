@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestParseBandOutGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		gapType  string
+		gap      float64
+		direct   float64
+		homoSpin int
+		lumoSpin int
+	}{
+		{
+			name: "direct",
+			content: ` KPT            1  SPIN            1  KWEIGHT    0.5000000000000000
+     1   -10.000  2.00000
+     2    -5.000  2.00000
+     3    -1.000  0.00000
+ KPT            2  SPIN            1  KWEIGHT    0.5000000000000000
+     1    -9.000  2.00000
+     2    -6.000  2.00000
+     3     0.500  0.00000
+`,
+			gapType: "direct", gap: 4, direct: 4, homoSpin: 1, lumoSpin: 1,
+		},
+		{
+			name: "indirect",
+			content: ` KPT 1 SPIN 1 KWEIGHT 0.5
+  -5.000  2.00000
+  -1.000  0.00000
+ KPT 2 SPIN 1 KWEIGHT 0.5
+  -6.000  2.00000
+  -2.000  0.00000
+`,
+			gapType: "indirect", gap: 3, direct: 4, homoSpin: 1, lumoSpin: 1,
+		},
+		{
+			name: "spin channels at the same k-point",
+			content: ` KPT 1 SPIN 1 KWEIGHT 1.0
+  -5.000  1.00000
+  -2.000  0.00000
+ KPT 1 SPIN 2 KWEIGHT 1.0
+  -6.000  1.00000
+  -4.000  0.00000
+`,
+			gapType: "indirect", gap: 1, direct: 2, homoSpin: 1, lumoSpin: 2,
+		},
+		{
+			name: "metallic",
+			content: ` KPT 1 SPIN 1 KWEIGHT 0.5
+  -5.000  2.00000
+  -1.000  0.00000
+ KPT 2 SPIN 1 KWEIGHT 0.5
+  -0.500  2.00000
+   1.000  0.00000
+`,
+			gapType: "metallic", gap: 0, direct: 0, homoSpin: 1, lumoSpin: 1,
+		},
+		{
+			name: "every state filled",
+			content: ` KPT 1 SPIN 1 KWEIGHT 1.0
+  -5.000  2.00000
+`,
+			gapType: "undefined", homoSpin: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			structure, err := NewDFTBOutputParser().ParseBandOut(tt.content)
+			if err != nil {
+				t.Fatalf("ParseBandOut: %v", err)
+			}
+			if structure.GapType != tt.gapType {
+				t.Errorf("gap type: got %s, want %s", structure.GapType, tt.gapType)
+			}
+			if !approxEqual(structure.BandGapEV, tt.gap, 1e-9) || !approxEqual(structure.DirectGapEV, tt.direct, 1e-9) {
+				t.Errorf("gaps: got %v (direct %v), want %v (direct %v)", structure.BandGapEV, structure.DirectGapEV, tt.gap, tt.direct)
+			}
+			if structure.HOMOSpin != tt.homoSpin || structure.LUMOSpin != tt.lumoSpin {
+				t.Errorf("spin channels: got HOMO %d, LUMO %d, want %d, %d", structure.HOMOSpin, structure.LUMOSpin, tt.homoSpin, tt.lumoSpin)
+			}
+		})
+	}
+}
+
+func TestParseBandOutErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":              "",
+		"no header":          "  -5.0 2.0\n",
+		"bad eigenvalue":     " KPT 1 SPIN 1 KWEIGHT 1.0\n  abc 2.0\n",
+		"missing occupation": " KPT 1 SPIN 1 KWEIGHT 1.0\n  -5.0\n",
+	}
+	for name, content := range tests {
+		if _, err := NewDFTBOutputParser().ParseBandOut(content); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cifBlock holds the raw contents of a data block or save frame
+type cifBlock struct {
+	name   string
+	tags   []string            // scalar tags in file order
+	items  map[string]cifToken // scalar values keyed by lower-case tag
+	loops  []*cifLoop
+	frames []*cifBlock
+}
+
+// cifLoop holds the raw contents of a loop_ construct
+type cifLoop struct {
+	tags []string
+	rows [][]cifToken
+}
+
+// newCIFBlock creates an empty block with the given name
+func newCIFBlock(name string) *cifBlock {
+	return &cifBlock{
+		name:  name,
+		items: make(map[string]cifToken),
+	}
+}
+
+// setItem stores a scalar data item, keeping the first-seen tag order
+func (b *cifBlock) setItem(tag string, value cifToken) {
+	key := strings.ToLower(tag)
+	if _, exists := b.items[key]; !exists {
+		b.tags = append(b.tags, tag)
+	}
+	b.items[key] = value
+}
+
+// parseCIF parses CIF 1.1 content into its data blocks following the
+// grammar: data blocks contain data items, loops and save frames; save
+// frames contain data items and loops.
+func parseCIF(content string) ([]*cifBlock, error) {
+	lexer := newCIFLexer(content)
+
+	var blocks []*cifBlock
+	var block, frame *cifBlock
+
+	for {
+		tok, err := lexer.next()
+		if err != nil {
+			return nil, err
+		}
+
+		// Data items and loops go into the open save frame, if any
+		container := block
+		if frame != nil {
+			container = frame
+		}
+
+		switch tok.kind {
+		case tokEOF:
+			if frame != nil {
+				return nil, fmt.Errorf("save frame %s is not closed", frame.name)
+			}
+			return blocks, nil
+
+		case tokData:
+			if frame != nil {
+				return nil, fmt.Errorf("line %d: data block %s starts inside save frame %s", tok.line, tok.text, frame.name)
+			}
+			block = newCIFBlock(tok.text)
+			blocks = append(blocks, block)
+
+		case tokSave:
+			if block == nil {
+				return nil, fmt.Errorf("line %d: save frame outside a data block", tok.line)
+			}
+			if tok.text == "" {
+				if frame == nil {
+					return nil, fmt.Errorf("line %d: save_ without an open save frame", tok.line)
+				}
+				frame = nil
+				continue
+			}
+			if frame != nil {
+				return nil, fmt.Errorf("line %d: save frame %s nested in save frame %s", tok.line, tok.text, frame.name)
+			}
+			frame = newCIFBlock(tok.text)
+			block.frames = append(block.frames, frame)
+
+		case tokLoop:
+			if container == nil {
+				return nil, fmt.Errorf("line %d: loop outside a data block", tok.line)
+			}
+			loop, err := parseLoop(lexer, tok.line)
+			if err != nil {
+				return nil, err
+			}
+			container.loops = append(container.loops, loop)
+
+		case tokTag:
+			if container == nil {
+				return nil, fmt.Errorf("line %d: data item %s outside a data block", tok.line, tok.text)
+			}
+			value, err := lexer.next()
+			if err != nil {
+				return nil, err
+			}
+			if value.kind != tokValue {
+				return nil, fmt.Errorf("line %d: data item %s has no value", tok.line, tok.text)
+			}
+			container.setItem(tok.text, value)
+
+		case tokValue:
+			return nil, fmt.Errorf("line %d: value %q without a data name", tok.line, tok.text)
+
+		case tokGlobal, tokStop:
+			return nil, fmt.Errorf("line %d: reserved word not allowed in CIF 1.1", tok.line)
+		}
+	}
+}
+
+// parseLoop reads the tags and values following a loop_ keyword. The value
+// count must be a whole multiple of the tag count; rows may wrap across lines.
+func parseLoop(lexer *cifLexer, line int) (*cifLoop, error) {
+	loop := &cifLoop{}
+
+	for {
+		tok, err := lexer.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind != tokTag {
+			break
+		}
+		lexer.next()
+		loop.tags = append(loop.tags, tok.text)
+	}
+
+	if len(loop.tags) == 0 {
+		return nil, fmt.Errorf("line %d: loop_ without data names", line)
+	}
+
+	var values []cifToken
+	for {
+		tok, err := lexer.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind != tokValue {
+			break
+		}
+		lexer.next()
+		values = append(values, tok)
+	}
+
+	if len(values)%len(loop.tags) != 0 {
+		return nil, fmt.Errorf("line %d: loop has %d values, which is not a multiple of its %d data names",
+			line, len(values), len(loop.tags))
+	}
+
+	for i := 0; i < len(values); i += len(loop.tags) {
+		loop.rows = append(loop.rows, values[i:i+len(loop.tags)])
+	}
+
+	return loop, nil
+}
+
+// isUnknownValue reports whether a value is the CIF '?' or '.' placeholder
+func isUnknownValue(value cifToken) bool {
+	return !value.quoted && (value.text == "?" || value.text == ".")
+}
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cifTokenKind identifies the lexical class of a CIF token
+type cifTokenKind int
+
+const (
+	tokEOF cifTokenKind = iota
+	tokData
+	tokLoop
+	tokSave
+	tokGlobal
+	tokStop
+	tokTag
+	tokValue
+)
+
+// cifToken is a single lexical unit of a CIF 1.1 file
+type cifToken struct {
+	kind   cifTokenKind
+	text   string // block/frame name, tag name or value text
+	quoted bool   // value was quoted or a text field, so '?' and '.' are literal
+	line   int
+}
+
+// cifLexer splits CIF 1.1 content into tokens
+type cifLexer struct {
+	src    string
+	pos    int
+	line   int
+	peeked *cifToken
+}
+
+// newCIFLexer creates a lexer over the given CIF content
+func newCIFLexer(src string) *cifLexer {
+	// Normalise line endings so text fields can be detected on any platform
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	return &cifLexer{src: src, line: 1}
+}
+
+// peek returns the next token without consuming it
+func (l *cifLexer) peek() (cifToken, error) {
+	if l.peeked == nil {
+		tok, err := l.scan()
+		if err != nil {
+			return cifToken{}, err
+		}
+		l.peeked = &tok
+	}
+	return *l.peeked, nil
+}
+
+// next returns and consumes the next token
+func (l *cifLexer) next() (cifToken, error) {
+	if l.peeked != nil {
+		tok := *l.peeked
+		l.peeked = nil
+		return tok, nil
+	}
+	return l.scan()
+}
+
+// scan reads the next token from the input
+func (l *cifLexer) scan() (cifToken, error) {
+	l.skipWhitespaceAndComments()
+
+	if l.pos >= len(l.src) {
+		return cifToken{kind: tokEOF, line: l.line}, nil
+	}
+
+	c := l.src[l.pos]
+
+	// Text fields start with a semicolon in the first column
+	if c == ';' && l.atLineStart() {
+		return l.scanTextField()
+	}
+
+	if c == '\'' || c == '"' {
+		return l.scanQuoted(c)
+	}
+
+	start := l.pos
+	for l.pos < len(l.src) && !isCIFSpace(l.src[l.pos]) {
+		l.pos++
+	}
+	word := l.src[start:l.pos]
+	lower := strings.ToLower(word)
+
+	switch {
+	case strings.HasPrefix(lower, "data_"):
+		if len(word) == len("data_") {
+			return cifToken{}, fmt.Errorf("line %d: data block without a name", l.line)
+		}
+		return cifToken{kind: tokData, text: word[len("data_"):], line: l.line}, nil
+	case lower == "loop_":
+		return cifToken{kind: tokLoop, line: l.line}, nil
+	case strings.HasPrefix(lower, "save_"):
+		return cifToken{kind: tokSave, text: word[len("save_"):], line: l.line}, nil
+	case lower == "global_":
+		return cifToken{kind: tokGlobal, line: l.line}, nil
+	case lower == "stop_":
+		return cifToken{kind: tokStop, line: l.line}, nil
+	case word[0] == '_':
+		return cifToken{kind: tokTag, text: word, line: l.line}, nil
+	}
+
+	return cifToken{kind: tokValue, text: word, line: l.line}, nil
+}
+
+// scanQuoted reads a single- or double-quoted value. As in CIF 1.1, a quote
+// only closes the value when it is followed by whitespace or end of input,
+// so values such as 'O'Brien' are read intact.
+func (l *cifLexer) scanQuoted(quote byte) (cifToken, error) {
+	line := l.line
+	l.pos++
+	start := l.pos
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '\n' {
+			break
+		}
+		if c == quote && (l.pos+1 == len(l.src) || isCIFSpace(l.src[l.pos+1])) {
+			value := l.src[start:l.pos]
+			l.pos++
+			return cifToken{kind: tokValue, text: value, quoted: true, line: line}, nil
+		}
+		l.pos++
+	}
+
+	return cifToken{}, fmt.Errorf("line %d: unterminated quoted string", line)
+}
+
+// scanTextField reads a semicolon-delimited multi-line text field
+func (l *cifLexer) scanTextField() (cifToken, error) {
+	line := l.line
+	l.pos++
+	start := l.pos
+
+	for l.pos < len(l.src) {
+		if l.src[l.pos] == '\n' {
+			l.line++
+			if l.pos+1 < len(l.src) && l.src[l.pos+1] == ';' {
+				// The line break after the opening semicolon is not content
+				value := strings.TrimPrefix(l.src[start:l.pos], "\n")
+				l.pos += 2
+				return cifToken{kind: tokValue, text: value, quoted: true, line: line}, nil
+			}
+		}
+		l.pos++
+	}
+
+	return cifToken{}, fmt.Errorf("line %d: unterminated text field", line)
+}
+
+// skipWhitespaceAndComments advances past blanks, newlines and comments
+func (l *cifLexer) skipWhitespaceAndComments() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case isCIFSpace(c):
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// atLineStart reports whether the lexer is positioned in the first column
+func (l *cifLexer) atLineStart() bool {
+	return l.pos == 0 || l.src[l.pos-1] == '\n'
+}
+
+// isCIFSpace reports whether c separates CIF tokens
+func isCIFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -1,14 +1,14 @@
 package parser
 
 import (
-	"bufio"
+	"dftbopt-mcp/go-service/internal/elements"
+	"dftbopt-mcp/go-service/internal/types"
 	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"dftbopt-mcp/go-service/internal/types"
 )
 
 // CIFParser handles parsing of CIF (Crystallographic Information File) format
@@ -32,180 +32,394 @@ func (p *CIFParser) ParseFromBase64(base64Content string) (*types.CIFFile, error
 
 // ParseFromString parses a CIF file from string content
 func (p *CIFParser) ParseFromString(content string) (*types.CIFFile, error) {
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	
+	blocks, err := parseCIF(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIF syntax: %v", err)
+	}
+
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no data block found in CIF content")
+	}
+
 	cif := &types.CIFFile{}
-	var currentDataBlock *types.CIFFile
-	var inLoop bool
-	var loopHeaders []string
-	var loopData [][]string
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	for _, raw := range blocks {
+		dataBlock, err := p.buildDataBlock(raw)
+		if err != nil {
+			return nil, fmt.Errorf("data block %s: %v", raw.name, err)
 		}
+		cif.DataBlocks = append(cif.DataBlocks, *dataBlock)
+	}
+	cif.DataBlock = cif.DataBlocks[0]
+
+	return cif, nil
+}
 
-		// Handle data blocks
-		if strings.HasPrefix(line, "data_") {
-			// Save previous data block if exists
-			if currentDataBlock != nil {
-				cif.DataBlock = *currentDataBlock
+// SelectDataBlock returns a copy of the CIF with the data block chosen by
+// name (case-insensitive) or by zero-based index as the selected block. With
+// neither given, the first data block is selected.
+func (p *CIFParser) SelectDataBlock(cif *types.CIFFile, name string, index *int) (*types.CIFFile, error) {
+	if cif == nil || len(cif.DataBlocks) == 0 {
+		return nil, fmt.Errorf("invalid CIF file")
+	}
+
+	selected := &types.CIFFile{DataBlocks: cif.DataBlocks}
+
+	switch {
+	case name != "":
+		for _, dataBlock := range cif.DataBlocks {
+			if strings.EqualFold(dataBlock.Name, name) {
+				selected.DataBlock = dataBlock
+				return selected, nil
 			}
-			
-			// Start new data block
-			currentDataBlock = &types.CIFFile{}
-			currentDataBlock.DataBlock.Name = strings.TrimPrefix(line, "data_")
-			currentDataBlock.DataBlock.CellLength = make(map[string]float64)
-			currentDataBlock.DataBlock.CellAngle = make(map[string]float64)
-			currentDataBlock.DataBlock.Metadata = make(map[string]string)
-			inLoop = false
-			loopHeaders = nil
-			loopData = nil
-			continue
 		}
+		return nil, fmt.Errorf("data block %s not found (available: %s)", name, strings.Join(p.DataBlockNames(cif), ", "))
+	case index != nil:
+		if *index < 0 || *index >= len(cif.DataBlocks) {
+			return nil, fmt.Errorf("data block index %d out of range (file has %d data blocks)", *index, len(cif.DataBlocks))
+		}
+		selected.DataBlock = cif.DataBlocks[*index]
+	default:
+		selected.DataBlock = cif.DataBlocks[0]
+	}
 
-		// Handle loops
-		if strings.HasPrefix(line, "loop_") {
-			inLoop = true
-			loopHeaders = nil
-			loopData = nil
-			continue
+	return selected, nil
+}
+
+// SplitDataBlocks returns one single-structure CIF per data block
+func (p *CIFParser) SplitDataBlocks(cif *types.CIFFile) []*types.CIFFile {
+	var files []*types.CIFFile
+	for _, dataBlock := range cif.DataBlocks {
+		files = append(files, &types.CIFFile{
+			DataBlock:  dataBlock,
+			DataBlocks: []types.CIFDataBlock{dataBlock},
+		})
+	}
+	return files
+}
+
+// DataBlockNames returns the names of all data blocks in file order
+func (p *CIFParser) DataBlockNames(cif *types.CIFFile) []string {
+	names := make([]string, 0, len(cif.DataBlocks))
+	for _, dataBlock := range cif.DataBlocks {
+		names = append(names, dataBlock.Name)
+	}
+	return names
+}
+
+// buildDataBlock maps the raw items and loops of a parsed block onto a
+// CIFDataBlock. Save frames only occur in dictionaries and are not mapped.
+func (p *CIFParser) buildDataBlock(raw *cifBlock) (*types.CIFDataBlock, error) {
+	dataBlock := &types.CIFDataBlock{
+		Name:       raw.name,
+		CellLength: make(map[string]float64),
+		CellAngle:  make(map[string]float64),
+		Metadata:   make(map[string]string),
+	}
+
+	for _, tag := range raw.tags {
+		value := raw.items[strings.ToLower(tag)]
+
+		handled, err := p.setCellParameter(dataBlock, tag, value)
+		if err != nil {
+			return nil, err
+		}
+		if !handled {
+			dataBlock.Metadata[tag] = value.text
+			dataBlock.MetadataOrder = append(dataBlock.MetadataOrder, tag)
 		}
+	}
 
-		if inLoop {
-			// Collect loop headers
-			if strings.HasPrefix(line, "_") {
-				loopHeaders = append(loopHeaders, line)
-				continue
-			}
+	// Cartesian atom sites are keyed by atom site index until the cell is known
+	cartesian := make(map[int][3]float64)
+	for _, loop := range raw.loops {
+		if err := p.processLoopData(dataBlock, loop, cartesian); err != nil {
+			return nil, err
+		}
+	}
 
-			// Collect loop data
-			if !strings.HasPrefix(line, "_") && line != "" {
-				fields := strings.Fields(line)
-				if len(fields) == len(loopHeaders) {
-					loopData = append(loopData, fields)
-				}
-				continue
-			}
+	if len(cartesian) > 0 {
+		if err := p.convertCartesianSites(dataBlock, cartesian); err != nil {
+			return nil, err
+		}
+	}
 
-			// End of loop
-			inLoop = false
-			p.processLoopData(currentDataBlock, loopHeaders, loopData)
-			continue
+	// Unknown elements are left empty here and reported by ValidateElements
+	for i := range dataBlock.AtomSites {
+		site := &dataBlock.AtomSites[i]
+		if element, err := elements.Resolve(site.TypeSymbol, site.Label); err == nil {
+			site.Element = element
 		}
+	}
 
-		// Handle key-value pairs
-		if strings.Contains(line, " ") && !strings.HasPrefix(line, "_") {
-			parts := strings.SplitN(line, " ", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				
-				// Remove quotes if present
-				if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
-					value = strings.Trim(value, "\"")
-				} else if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
-					value = strings.Trim(value, "'")
-				}
-				
-				currentDataBlock.DataBlock.Metadata[key] = value
+	return dataBlock, nil
+}
+
+// ValidateElements checks that the element of every atom site of the
+// selected data block is known, reporting each offending site
+func (p *CIFParser) ValidateElements(cif *types.CIFFile) error {
+	if cif == nil {
+		return fmt.Errorf("invalid CIF file")
+	}
+
+	if len(cif.DataBlock.AtomSites) == 0 {
+		return fmt.Errorf("data block %s has no atom sites", cif.DataBlock.Name)
+	}
+
+	var problems []string
+	for i, site := range cif.DataBlock.AtomSites {
+		if _, err := elements.Resolve(site.TypeSymbol, site.Label); err != nil {
+			name := site.Label
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
 			}
-			continue
+			problems = append(problems, fmt.Sprintf("atom site %s: %v", name, err))
 		}
+	}
 
-		// Handle CIF keywords
-		if strings.HasPrefix(line, "_") {
-			parts := strings.SplitN(line, " ", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				
-				// Remove quotes if present
-				if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
-					value = strings.Trim(value, "\"")
-				} else if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
-					value = strings.Trim(value, "'")
-				}
-				
-				switch key {
-				case "_cell_length_a", "_cell_length_b", "_cell_length_c":
-					if val, err := strconv.ParseFloat(value, 64); err == nil {
-						currentDataBlock.DataBlock.CellLength[key] = val
-					}
-				case "_cell_angle_alpha", "_cell_angle_beta", "_cell_angle_gamma":
-					if val, err := strconv.ParseFloat(value, 64); err == nil {
-						currentDataBlock.DataBlock.CellAngle[key] = val
-					}
-				}
-			}
+	if len(problems) > 0 {
+		return fmt.Errorf("data block %s: %s", cif.DataBlock.Name, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// setCellParameter stores value if tag is a cell length or angle and
+// reports whether it did
+func (p *CIFParser) setCellParameter(dataBlock *types.CIFDataBlock, tag string, value cifToken) (bool, error) {
+	key := normalizeTag(tag)
+
+	switch key {
+	case "_cell_length_a", "_cell_length_b", "_cell_length_c":
+		val, su, err := parseNumericValue(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s: %v", tag, err)
+		}
+		dataBlock.CellLength[key] = val
+		setUncertainty(&dataBlock.Uncertainties, key, su)
+	case "_cell_angle_alpha", "_cell_angle_beta", "_cell_angle_gamma":
+		val, su, err := parseNumericValue(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s: %v", tag, err)
+		}
+		dataBlock.CellAngle[key] = val
+		setUncertainty(&dataBlock.Uncertainties, key, su)
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// convertCartesianSites fills in the fractional coordinates of atom sites
+// given in Cartesian coordinates. As in PDBx/mmCIF, the Cartesian frame is
+// assumed to have a along x and b in the xy plane. Without any cell
+// parameters the sites describe a molecule, which is placed in a bounding box.
+func (p *CIFParser) convertCartesianSites(dataBlock *types.CIFDataBlock, cartesian map[int][3]float64) error {
+	if len(dataBlock.CellLength) == 0 && len(dataBlock.CellAngle) == 0 {
+		if len(cartesian) != len(dataBlock.AtomSites) {
+			return fmt.Errorf("atom sites mix Cartesian and fractional coordinates without cell parameters")
+		}
+		positions := make([][3]float64, len(dataBlock.AtomSites))
+		for index, cart := range cartesian {
+			positions[index] = cart
 		}
+		return SetStructureFromCartesian(dataBlock, nil, positions)
 	}
 
-	// Save the last data block
-	if currentDataBlock != nil {
-		cif.DataBlock = *currentDataBlock
+	lattice, err := LatticeFromDataBlock(dataBlock)
+	if err != nil {
+		return fmt.Errorf("Cartesian atom sites need valid cell parameters: %v", err)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading CIF content: %v", err)
+	inverse, err := InvertLattice(lattice)
+	if err != nil {
+		return err
 	}
 
-	return cif, nil
+	for index, cart := range cartesian {
+		frac := CartesianToFractional(inverse, cart)
+		site := &dataBlock.AtomSites[index]
+		site.FractX, site.FractY, site.FractZ = frac[0], frac[1], frac[2]
+	}
+
+	return nil
+}
+
+// atomSiteFields are the normalised atom site tags read into AtomSite fields
+var atomSiteFields = map[string]bool{
+	"_atom_site_label":             true,
+	"_atom_site_label_atom_id":     true,
+	"_atom_site_auth_atom_id":      true,
+	"_atom_site_id":                true,
+	"_atom_site_type_symbol":       true,
+	"_atom_site_fract_x":           true,
+	"_atom_site_fract_y":           true,
+	"_atom_site_fract_z":           true,
+	"_atom_site_cartn_x":           true,
+	"_atom_site_cartn_y":           true,
+	"_atom_site_cartn_z":           true,
+	"_atom_site_occupancy":         true,
+	"_atom_site_u_iso_or_equiv":    true,
+	"_atom_site_adp_type":          true,
+	"_atom_site_disorder_group":    true,
+	"_atom_site_disorder_assembly": true,
+}
+
+// derivedAtomSiteTags are atom site columns that follow from the positions
+// and site symmetry, which change when the structure is expanded or relaxed
+var derivedAtomSiteTags = map[string]bool{
+	"_atom_site_symmetry_multiplicity": true,
+	"_atom_site_site_symmetry_order":   true,
+	"_atom_site_wyckoff_symbol":        true,
 }
 
 // processLoopData processes loop data and populates atom sites
-func (p *CIFParser) processLoopData(dataBlock *types.CIFFile, headers []string, data [][]string) {
-	// Check if this is an atom site loop
-	atomSiteHeaders := []string{
-		"_atom_site_label",
-		"_atom_site_type_symbol",
+func (p *CIFParser) processLoopData(dataBlock *types.CIFDataBlock, loop *cifLoop, cartesian map[int][3]float64) error {
+	headers := make([]string, len(loop.tags))
+	for i, tag := range loop.tags {
+		headers[i] = normalizeTag(tag)
+	}
+
+	// DDL2 files may write single-valued categories such as _cell as loops
+	if len(loop.rows) == 1 && strings.HasPrefix(headers[0], "_cell_") {
+		for i, tag := range loop.tags {
+			handled, err := p.setCellParameter(dataBlock, tag, loop.rows[0][i])
+			if err != nil {
+				return err
+			}
+			if !handled {
+				dataBlock.Metadata[tag] = loop.rows[0][i].text
+				dataBlock.MetadataOrder = append(dataBlock.MetadataOrder, tag)
+			}
+		}
+		return nil
+	}
+
+	// Check if this is an atom site loop; the element may come from either
+	// the type symbol or the label, and positions may be fractional or
+	// Cartesian
+	fractHeaders := []string{
 		"_atom_site_fract_x",
 		"_atom_site_fract_y",
 		"_atom_site_fract_z",
 	}
+	cartnHeaders := []string{
+		"_atom_site_cartn_x",
+		"_atom_site_cartn_y",
+		"_atom_site_cartn_z",
+	}
+	hasIdentity := p.containsAllHeaders(headers, []string{"_atom_site_label"}) ||
+		p.containsAllHeaders(headers, []string{"_atom_site_label_atom_id"}) ||
+		p.containsAllHeaders(headers, []string{"_atom_site_auth_atom_id"}) ||
+		p.containsAllHeaders(headers, []string{"_atom_site_type_symbol"})
+	hasFract := p.containsAllHeaders(headers, fractHeaders)
+	hasCartn := !hasFract && p.containsAllHeaders(headers, cartnHeaders)
+
+	if hasIdentity && (hasFract || hasCartn) {
+		// Columns without a field of their own are carried through to the
+		// written file, apart from those the optimization invalidates
+		extraTags := make(map[int]string)
+		for i, header := range headers {
+			if !atomSiteFields[header] && !derivedAtomSiteTags[header] {
+				extraTags[i] = strings.Replace(loop.tags[i], ".", "_", 1)
+				dataBlock.AtomSiteTags = append(dataBlock.AtomSiteTags, extraTags[i])
+			}
+		}
+
+		for _, row := range loop.rows {
+			atomSite := types.AtomSite{Occupancy: 1.0}
+			var cart [3]float64
+			var atomName, atomID string
 
-	if p.containsAllHeaders(headers, atomSiteHeaders) {
-		for _, row := range data {
-			atomSite := types.AtomSite{}
-			
 			for i, header := range headers {
-				if i >= len(row) {
+				value := row[i]
+				if tag, ok := extraTags[i]; ok {
+					if atomSite.Extra == nil {
+						atomSite.Extra = make(map[string]string)
+					}
+					atomSite.Extra[tag] = value.text
 					continue
 				}
-				
-				value := strings.TrimSpace(row[i])
-				
+
 				switch header {
 				case "_atom_site_label":
-					atomSite.Label = value
+					atomSite.Label = value.text
+				case "_atom_site_label_atom_id":
+					atomName = value.text
+				case "_atom_site_auth_atom_id":
+					if atomName == "" {
+						atomName = value.text
+					}
+				case "_atom_site_id":
+					atomID = value.text
+				case "_atom_site_cartn_x", "_atom_site_cartn_y", "_atom_site_cartn_z":
+					if !hasCartn {
+						continue
+					}
+					val, _, err := parseNumericValue(value)
+					if err != nil {
+						return fmt.Errorf("line %d: atom site %d has invalid %s: %v", value.line, len(dataBlock.AtomSites)+1, loop.tags[i], err)
+					}
+					cart[header[len(header)-1]-'x'] = val
 				case "_atom_site_type_symbol":
-					atomSite.TypeSymbol = value
-				case "_atom_site_fract_x":
-					if val, err := strconv.ParseFloat(value, 64); err == nil {
-						atomSite.FractX = val
+					atomSite.TypeSymbol = value.text
+				case "_atom_site_fract_x", "_atom_site_fract_y", "_atom_site_fract_z":
+					val, su, err := parseNumericValue(value)
+					if err != nil {
+						return fmt.Errorf("line %d: atom site %d has invalid %s: %v", value.line, len(dataBlock.AtomSites)+1, loop.tags[i], err)
 					}
-				case "_atom_site_fract_y":
-					if val, err := strconv.ParseFloat(value, 64); err == nil {
+					switch header {
+					case "_atom_site_fract_x":
+						atomSite.FractX = val
+					case "_atom_site_fract_y":
 						atomSite.FractY = val
-					}
-				case "_atom_site_fract_z":
-					if val, err := strconv.ParseFloat(value, 64); err == nil {
+					default:
 						atomSite.FractZ = val
 					}
+					setUncertainty(&atomSite.Uncertainties, header, su)
+				case "_atom_site_occupancy":
+					if isUnknownValue(value) {
+						continue
+					}
+					val, su, err := parseNumericValue(value)
+					if err != nil || val < 0 || val > 1 {
+						return fmt.Errorf("line %d: atom site %d has invalid %s %q", value.line, len(dataBlock.AtomSites)+1, loop.tags[i], value.text)
+					}
+					atomSite.Occupancy = val
+					setUncertainty(&atomSite.Uncertainties, header, su)
 				case "_atom_site_u_iso_or_equiv":
-					if val, err := strconv.ParseFloat(value, 64); err == nil {
+					if val, su, err := parseNumericValue(value); err == nil {
 						atomSite.UIsoOrEquiv = val
+						setUncertainty(&atomSite.Uncertainties, header, su)
 					}
 				case "_atom_site_adp_type":
-					atomSite.AdpType = value
+					atomSite.AdpType = value.text
+				case "_atom_site_disorder_group":
+					if !isUnknownValue(value) {
+						atomSite.DisorderGroup = value.text
+					}
+				case "_atom_site_disorder_assembly":
+					if !isUnknownValue(value) {
+						atomSite.DisorderAssembly = value.text
+					}
+				}
+			}
+
+			// PDBx/mmCIF atom names are not unique, so qualify them with the atom ID
+			if atomSite.Label == "" && atomName != "" {
+				atomSite.Label = atomName
+				if atomID != "" {
+					atomSite.Label = atomName + "_" + atomID
 				}
 			}
-			
-			dataBlock.DataBlock.AtomSites = append(dataBlock.DataBlock.AtomSites, atomSite)
+
+			if hasCartn {
+				cartesian[len(dataBlock.AtomSites)] = cart
+			}
+
+			dataBlock.AtomSites = append(dataBlock.AtomSites, atomSite)
 		}
+		return nil
 	}
 
 	// Check if this is a symmetry operation loop
@@ -216,16 +430,12 @@ func (p *CIFParser) processLoopData(dataBlock *types.CIFFile, headers []string,
 	}
 
 	if p.containsAllHeaders(headers, symmetryHeaders) {
-		for _, row := range data {
+		for _, row := range loop.rows {
 			symmetry := types.SymmetryOperation{}
-			
+
 			for i, header := range headers {
-				if i >= len(row) {
-					continue
-				}
-				
-				value := strings.TrimSpace(row[i])
-				
+				value := strings.TrimSpace(row[i].text)
+
 				switch header {
 				case "_symmetry_equiv_pos_as_xyz_x":
 					symmetry.X = value
@@ -235,10 +445,100 @@ func (p *CIFParser) processLoopData(dataBlock *types.CIFFile, headers []string,
 					symmetry.Z = value
 				}
 			}
-			
-			dataBlock.DataBlock.Symmetry = append(dataBlock.DataBlock.Symmetry, symmetry)
+
+			dataBlock.Symmetry = append(dataBlock.Symmetry, symmetry)
+		}
+		return nil
+	}
+
+	// Check if this is a loop of complete symmetry operation strings
+	for i, header := range headers {
+		if header != "_symmetry_equiv_pos_as_xyz" && header != "_space_group_symop_operation_xyz" {
+			continue
+		}
+
+		for _, row := range loop.rows {
+			symmetry, err := ParseSymmetryOperationString(row[i].text)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", row[i].line, err)
+			}
+			dataBlock.Symmetry = append(dataBlock.Symmetry, symmetry)
+		}
+		return nil
+	}
+
+	// Keep every other loop verbatim so it can be written back out
+	kept := types.CIFLoop{Tags: loop.tags}
+	for _, row := range loop.rows {
+		values := make([]string, len(row))
+		for i, value := range row {
+			values[i] = value.text
 		}
+		kept.Rows = append(kept.Rows, values)
 	}
+	dataBlock.Loops = append(dataBlock.Loops, kept)
+
+	return nil
+}
+
+// parseNumericValue parses a CIF numeric value such as "0.2345(3)" and
+// returns the value and its standard uncertainty (0 when none is given)
+func parseNumericValue(value cifToken) (float64, float64, error) {
+	if isUnknownValue(value) {
+		return 0, 0, fmt.Errorf("value is unknown (%s)", value.text)
+	}
+
+	text := value.text
+	suDigits := ""
+	if open := strings.IndexByte(text, '('); open >= 0 && strings.HasSuffix(text, ")") {
+		suDigits = text[open+1 : len(text)-1]
+		text = text[:open]
+	}
+
+	val, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q is not a number", value.text)
+	}
+
+	if suDigits == "" {
+		return val, 0, nil
+	}
+
+	// The uncertainty applies to the last digit of the mantissa
+	mantissa, exponent := text, 0
+	if i := strings.IndexAny(text, "eE"); i >= 0 {
+		mantissa = text[:i]
+		if exponent, err = strconv.Atoi(text[i+1:]); err != nil {
+			return 0, 0, fmt.Errorf("%q is not a number", value.text)
+		}
+	}
+	if dot := strings.IndexByte(mantissa, '.'); dot >= 0 {
+		exponent -= len(mantissa) - dot - 1
+	}
+
+	su, err := strconv.ParseFloat(fmt.Sprintf("%se%d", suDigits, exponent), 64)
+	if err != nil || strings.ContainsAny(suDigits, "eE+-") {
+		return 0, 0, fmt.Errorf("%q has an invalid standard uncertainty", value.text)
+	}
+
+	return val, su, nil
+}
+
+// setUncertainty records a non-zero standard uncertainty for tag
+func setUncertainty(uncertainties *map[string]float64, tag string, su float64) {
+	if su == 0 {
+		return
+	}
+	if *uncertainties == nil {
+		*uncertainties = make(map[string]float64)
+	}
+	(*uncertainties)[tag] = su
+}
+
+// normalizeTag maps a data name onto the lower-case DDL1 form used for
+// matching, so the DDL2 name "_cell.length_a" matches "_cell_length_a"
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.Replace(tag, ".", "_", 1))
 }
 
 // containsAllHeaders checks if all required headers are present
@@ -247,13 +547,13 @@ func (p *CIFParser) containsAllHeaders(headers, required []string) bool {
 	for _, h := range headers {
 		headerMap[h] = true
 	}
-	
+
 	for _, req := range required {
 		if !headerMap[req] {
 			return false
 		}
 	}
-	
+
 	return true
 }
 
@@ -264,52 +564,65 @@ func (p *CIFParser) ToDFTBInput(cif *types.CIFFile, method string, fmax float64)
 	}
 
 	input := &types.DFTBInput{}
-	
+
 	// Set geometry
-	input.Geometry.Periodic = true
-	
-	// Set lattice vectors (simplified - assuming cubic cell for now)
-	a := cif.DataBlock.CellLength["_cell_length_a"]
-	b := cif.DataBlock.CellLength["_cell_length_b"]
-	c := cif.DataBlock.CellLength["_cell_length_c"]
-	
-	alpha := cif.DataBlock.CellAngle["_cell_angle_alpha"] * 3.141592653589793 / 180.0
-	beta := cif.DataBlock.CellAngle["_cell_angle_beta"] * 3.141592653589793 / 180.0
-	gamma := cif.DataBlock.CellAngle["_cell_angle_gamma"] * 3.141592653589793 / 180.0
-	
-	// Simplified lattice vector calculation (for demonstration)
-	// In a real implementation, you would need proper crystallographic calculations
-	input.Geometry.LatticeVectors = [3][3]float64{
-		{a, 0, 0},
-		{0, b, 0},
-		{0, 0, c},
-	}
-	
-	// Extract elements and coordinates
-	elementMap := make(map[string]bool)
+	input.Geometry.Periodic = !cif.DataBlock.NonPeriodic
+
+	// Build lattice vectors from the cell parameters
+	lattice, err := LatticeFromDataBlock(&cif.DataBlock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cell parameters: %v", err)
+	}
+	input.Geometry.LatticeVectors = lattice
+
+	// Extract elements, per-atom species and coordinates
+	elementIndex := make(map[string]int)
 	for _, atom := range cif.DataBlock.AtomSites {
-		if !elementMap[atom.TypeSymbol] {
-			input.Geometry.Elements = append(input.Geometry.Elements, atom.TypeSymbol)
-			elementMap[atom.TypeSymbol] = true
+		if atom.Element == "" {
+			return nil, fmt.Errorf("atom site %s has no known element", atom.Label)
 		}
-		
-		// Convert fractional to Cartesian coordinates (simplified)
-		x := atom.FractX * a
-		y := atom.FractY * b
-		z := atom.FractZ * c
-		
-		input.Geometry.Coordinates = append(input.Geometry.Coordinates, []float64{x, y, z})
-	}
-	
+		if _, ok := elementIndex[atom.Element]; !ok {
+			elementIndex[atom.Element] = len(input.Geometry.Elements)
+			input.Geometry.Elements = append(input.Geometry.Elements, atom.Element)
+		}
+		input.Geometry.Species = append(input.Geometry.Species, elementIndex[atom.Element])
+
+		// Convert fractional to Cartesian coordinates in the input frame
+		cart := SiteCartesian(&cif.DataBlock, lattice, atom)
+
+		input.Geometry.Coordinates = append(input.Geometry.Coordinates, []float64{cart[0], cart[1], cart[2]})
+	}
+
+	// Fixed axes are only passed on when at least one atom is constrained
+	constrained, frozen := 0, 0
+	for _, atom := range cif.DataBlock.AtomSites {
+		if atom.FixedAxes != [3]bool{} || atom.FixedLatticeAxes != [3]bool{} {
+			constrained++
+		}
+		if IsFrozen(atom) {
+			frozen++
+		}
+	}
+	if frozen == len(cif.DataBlock.AtomSites) {
+		return nil, fmt.Errorf("every atom is fixed, nothing can be optimized")
+	}
+	if constrained > 0 {
+		for _, atom := range cif.DataBlock.AtomSites {
+			input.Geometry.FixedAxes = append(input.Geometry.FixedAxes, atom.FixedAxes)
+			input.Geometry.FixedLatticeAxes = append(input.Geometry.FixedLatticeAxes, atom.FixedLatticeAxes)
+		}
+	}
+
 	// Set Hamiltonian method
 	input.Hamiltonian.Method = method
-	
+
 	// Enable force calculation
 	input.Analysis.Forces = true
-	
-	// Set convergence threshold
+
+	// Set convergence threshold and step limit
 	input.Options.Fmax = fmax
-	
+	input.Options.MaxSteps = DefaultMaxGeometrySteps
+
 	return input, nil
 }
 
@@ -320,12 +633,12 @@ func (p *CIFParser) SaveToFile(content string, filename string) (string, error)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create directory: %v", err)
 	}
-	
+
 	// Write content to file
 	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
 		return "", fmt.Errorf("failed to write file: %v", err)
 	}
-	
+
 	return filename, nil
 }
 
@@ -335,7 +648,7 @@ func (p *CIFParser) ReadFromFile(filename string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
-	
+
 	return string(content), nil
 }
 
@@ -344,14 +657,15 @@ func (p *CIFParser) ValidateCIFContent(content string) error {
 	if !strings.Contains(content, "data_") {
 		return fmt.Errorf("missing data block declaration")
 	}
-	
-	if !strings.Contains(content, "_cell_length_a") && !strings.Contains(content, "_cell.angle_alpha") {
+
+	lower := strings.ToLower(content)
+	if !strings.Contains(lower, "_cell_length_a") && !strings.Contains(lower, "_cell.length_a") {
 		return fmt.Errorf("missing cell parameters")
 	}
-	
+
 	if !strings.Contains(content, "_atom_site") && !strings.Contains(content, "loop_") {
 		return fmt.Errorf("missing atom site information")
 	}
-	
+
 	return nil
 }
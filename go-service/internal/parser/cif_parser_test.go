@@ -0,0 +1,370 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCIFValues(t *testing.T) {
+	content := `# comment line
+data_test
+_journal_name_full 'Acta Cryst.'
+_publ_author_name 'O'Brien, P.'
+_chemical_name_common "sodium \"chloride\""
+_symmetry_space_group_name_H-M ?
+_quoted_unknown '?'
+_exptl_special_details
+;
+first line
+ second line ; with a semicolon
+;
+_cell_length_a 5.64 # trailing comment
+`
+	blocks, err := parseCIF(content)
+	if err != nil {
+		t.Fatalf("parseCIF: %v", err)
+	}
+	if len(blocks) != 1 || blocks[0].name != "test" {
+		t.Fatalf("expected one block named test, got %d", len(blocks))
+	}
+
+	tests := []struct {
+		tag     string
+		text    string
+		quoted  bool
+		unknown bool
+	}{
+		{"_journal_name_full", "Acta Cryst.", true, false},
+		{"_publ_author_name", "O'Brien, P.", true, false},
+		{"_chemical_name_common", `sodium \"chloride\"`, true, false},
+		{"_symmetry_space_group_name_H-M", "?", false, true},
+		{"_quoted_unknown", "?", true, false},
+		{"_exptl_special_details", "first line\n second line ; with a semicolon", true, false},
+		{"_cell_length_a", "5.64", false, false},
+	}
+	for _, tt := range tests {
+		value, ok := blocks[0].items[strings.ToLower(tt.tag)]
+		if !ok {
+			t.Errorf("%s: missing", tt.tag)
+			continue
+		}
+		if value.text != tt.text || value.quoted != tt.quoted {
+			t.Errorf("%s: got %q (quoted %v), want %q (quoted %v)", tt.tag, value.text, value.quoted, tt.text, tt.quoted)
+		}
+		if isUnknownValue(value) != tt.unknown {
+			t.Errorf("%s: unknown = %v, want %v", tt.tag, isUnknownValue(value), tt.unknown)
+		}
+	}
+}
+
+func TestParseCIFLoops(t *testing.T) {
+	content := `data_loops
+loop_
+_atom_site_label
+_atom_site_fract_x
+_atom_site_fract_y
+_atom_site_fract_z
+Na1 0 0 0
+Cl1 0.5
+0.5 0.5
+loop_
+_publ_author_name
+'Smith, J.'
+;
+Doe, J.
+;
+`
+	blocks, err := parseCIF(content)
+	if err != nil {
+		t.Fatalf("parseCIF: %v", err)
+	}
+	loops := blocks[0].loops
+	if len(loops) != 2 {
+		t.Fatalf("expected 2 loops, got %d", len(loops))
+	}
+	if len(loops[0].rows) != 2 || loops[0].rows[1][0].text != "Cl1" || loops[0].rows[1][3].text != "0.5" {
+		t.Errorf("rows wrapped across lines were not joined: %+v", loops[0].rows)
+	}
+	if len(loops[1].rows) != 2 || loops[1].rows[1][0].text != "Doe, J." {
+		t.Errorf("text field in a loop not read as one value: %+v", loops[1].rows)
+	}
+}
+
+func TestParseCIFErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unterminated quote", "data_x\n_tag 'open\n", "unterminated quoted string"},
+		{"unterminated text field", "data_x\n_tag\n;\ntext\n", "unterminated text field"},
+		{"value without name", "data_x\nvalue\n", "without a data name"},
+		{"item without value", "data_x\n_tag\n_other 1\n", "has no value"},
+		{"loop without names", "data_x\nloop_\n1 2\n", "without data names"},
+		{"ragged loop", "data_x\nloop_\n_a\n_b\n1 2 3\n", "not a multiple"},
+		{"item before block", "_tag 1\n", "outside a data block"},
+		{"unnamed block", "data_\n", "without a name"},
+		{"reserved word", "data_x\nglobal_\n", "reserved word"},
+		{"open save frame", "data_x\nsave_frame\n_tag 1\n", "is not closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCIF(tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIFSaveFrames(t *testing.T) {
+	content := "data_dict\n_dictionary_name test\nsave_frame\n_item 1\nsave_\n_after 2\n"
+	blocks, err := parseCIF(content)
+	if err != nil {
+		t.Fatalf("parseCIF: %v", err)
+	}
+	block := blocks[0]
+	if len(block.frames) != 1 || block.frames[0].items["_item"].text != "1" {
+		t.Errorf("save frame items not kept in the frame: %+v", block.frames)
+	}
+	if _, ok := block.items["_item"]; ok {
+		t.Errorf("save frame item leaked into the data block")
+	}
+	if block.items["_after"].text != "2" {
+		t.Errorf("item after the save frame not added to the data block")
+	}
+}
+
+func TestParseFromStringDDL2(t *testing.T) {
+	content := `data_mm
+loop_
+_cell.length_a
+_cell.length_b
+_cell.length_c
+_cell.angle_alpha
+_cell.angle_beta
+_cell.angle_gamma
+4.0 5.0 6.0 90 90 90
+loop_
+_atom_site.id
+_atom_site.type_symbol
+_atom_site.label_atom_id
+_atom_site.fract_x
+_atom_site.fract_y
+_atom_site.fract_z
+1 C CA 0.1 0.2 0.3
+2 O O 0.4 0.5 0.6
+data_second
+_cell_length_a 3.0(2)
+_cell_length_b 3.0
+_cell_length_c 3.0
+loop_
+_atom_site_label
+_atom_site_fract_x
+_atom_site_fract_y
+_atom_site_fract_z
+Fe1 0 0 0
+`
+	parser := NewCIFParser()
+	cif, err := parser.ParseFromString(content)
+	if err != nil {
+		t.Fatalf("ParseFromString: %v", err)
+	}
+	if len(cif.DataBlocks) != 2 || cif.DataBlock.Name != "mm" {
+		t.Fatalf("expected blocks mm and second, got %v", parser.DataBlockNames(cif))
+	}
+
+	block := cif.DataBlocks[0]
+	if block.CellLength["_cell_length_b"] != 5.0 || block.CellAngle["_cell_angle_gamma"] != 90 {
+		t.Errorf("DDL2 cell loop not mapped: %v %v", block.CellLength, block.CellAngle)
+	}
+	if len(block.AtomSites) != 2 {
+		t.Fatalf("expected 2 atom sites, got %d", len(block.AtomSites))
+	}
+	site := block.AtomSites[0]
+	if site.Label != "CA_1" || site.Element != "C" || site.FractZ != 0.3 {
+		t.Errorf("DDL2 atom site mapped as %+v", site)
+	}
+
+	second := cif.DataBlocks[1]
+	if second.CellLength["_cell_length_a"] != 3.0 || second.Uncertainties["_cell_length_a"] != 0.2 {
+		t.Errorf("cell length with uncertainty read as %v ± %v", second.CellLength["_cell_length_a"], second.Uncertainties["_cell_length_a"])
+	}
+	if second.AtomSites[0].Element != "Fe" {
+		t.Errorf("element not resolved from the label: %+v", second.AtomSites[0])
+	}
+}
+
+func TestParseNumericValue(t *testing.T) {
+	tests := []struct {
+		text  string
+		value float64
+		su    float64
+		err   bool
+	}{
+		{"1.234", 1.234, 0, false},
+		{"1.234(5)", 1.234, 0.005, false},
+		{"12(3)", 12, 3, false},
+		{"1.5e-2(4)", 0.015, 0.004, false},
+		{"-0.25(12)", -0.25, 0.12, false},
+		{"?", 0, 0, true},
+		{"abc", 0, 0, true},
+	}
+	for _, tt := range tests {
+		value, su, err := parseNumericValue(cifToken{kind: tokValue, text: tt.text})
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v, want error %v", tt.text, err, tt.err)
+			continue
+		}
+		if !approxEqual(value, tt.value, 1e-12) || !approxEqual(su, tt.su, 1e-12) {
+			t.Errorf("%s: got %v(%v), want %v(%v)", tt.text, value, su, tt.value, tt.su)
+		}
+	}
+}
+
+// approxEqual reports whether a and b agree within an absolute tolerance
+func approxEqual(a, b, tolerance float64) bool {
+	d := a - b
+	return d <= tolerance && d >= -tolerance
+}
+
+func TestParseFromStringCartesianSites(t *testing.T) {
+	sites := `loop_
+_atom_site.id
+_atom_site.type_symbol
+_atom_site.label_atom_id
+_atom_site.Cartn_x
+_atom_site.Cartn_y
+_atom_site.Cartn_z
+1 O O 0.000 0.000 0.000
+2 H H1 0.757 0.586 0.000
+`
+	tests := []struct {
+		name        string
+		cell        string
+		nonPeriodic bool
+		want        [3]float64 // Fractional position of the second atom
+	}{
+		{
+			name: "with cell",
+			cell: "_cell.length_a 10\n_cell.length_b 10\n_cell.length_c 10\n",
+			want: [3]float64{0.0757, 0.0586, 0},
+		},
+		{
+			name:        "molecule without cell",
+			nonPeriodic: true,
+			want:        [3]float64{(10 + 0.757) / 20.757, (10 + 0.586) / 20.586, 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cif, err := NewCIFParser().ParseFromString("data_water\n" + tt.cell + sites)
+			if err != nil {
+				t.Fatalf("ParseFromString: %v", err)
+			}
+			block := cif.DataBlock
+			if block.NonPeriodic != tt.nonPeriodic {
+				t.Errorf("NonPeriodic = %v, want %v", block.NonPeriodic, tt.nonPeriodic)
+			}
+			site := block.AtomSites[1]
+			got := [3]float64{site.FractX, site.FractY, site.FractZ}
+			for k := 0; k < 3; k++ {
+				if !approxEqual(got[k], tt.want[k], 1e-9) {
+					t.Errorf("got fractional position %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// twoBlockCIF holds two structures, as written by refinement programs that
+// report several phases or temperatures in one file
+const twoBlockCIF = `data_NaCl
+_cell_length_a 5.64
+_cell_length_b 5.64
+_cell_length_c 5.64
+_cell_angle_alpha 90
+_cell_angle_beta 90
+_cell_angle_gamma 90
+loop_
+_atom_site_label
+_atom_site_fract_x
+_atom_site_fract_y
+_atom_site_fract_z
+Na1 0 0 0
+Cl1 0.5 0.5 0.5
+
+data_KCl
+_cell_length_a 6.29
+_cell_length_b 6.29
+_cell_length_c 6.29
+_cell_angle_alpha 90
+_cell_angle_beta 90
+_cell_angle_gamma 90
+loop_
+_atom_site_label
+_atom_site_fract_x
+_atom_site_fract_y
+_atom_site_fract_z
+K1 0 0 0
+`
+
+func TestSelectDataBlock(t *testing.T) {
+	cifParser := NewCIFParser()
+	cif, err := cifParser.ParseFromString(twoBlockCIF)
+	if err != nil {
+		t.Fatalf("ParseFromString: %v", err)
+	}
+	if names := strings.Join(cifParser.DataBlockNames(cif), " "); names != "NaCl KCl" {
+		t.Fatalf("got data blocks %s, want NaCl KCl", names)
+	}
+
+	index := func(i int) *int { return &i }
+	tests := []struct {
+		name      string
+		blockName string
+		index     *int
+		want      string
+		err       string
+	}{
+		{name: "first block by default", want: "NaCl"},
+		{name: "by name", blockName: "KCl", want: "KCl"},
+		{name: "names ignore case", blockName: "kcl", want: "KCl"},
+		{name: "by index", index: index(1), want: "KCl"},
+		{name: "name wins over index", blockName: "NaCl", index: index(1), want: "NaCl"},
+		{name: "unknown name", blockName: "LiF", err: "data block LiF not found (available: NaCl, KCl)"},
+		{name: "index out of range", index: index(2), err: "data block index 2 out of range (file has 2 data blocks)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := cifParser.SelectDataBlock(cif, tt.blockName, tt.index)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectDataBlock: %v", err)
+			}
+			if selected.DataBlock.Name != tt.want {
+				t.Errorf("selected %s, want %s", selected.DataBlock.Name, tt.want)
+			}
+		})
+	}
+
+	files := cifParser.SplitDataBlocks(cif)
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	for i, want := range []string{"Na1 Cl1", "K1"} {
+		var labels []string
+		for _, site := range files[i].DataBlock.AtomSites {
+			labels = append(labels, site.Label)
+		}
+		if strings.Join(labels, " ") != want || len(files[i].DataBlocks) != 1 {
+			t.Errorf("file %d: got sites %v in %d blocks, want %s in one block", i+1, labels, len(files[i].DataBlocks), want)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// cellTagOrder is the order in which cell parameters are written
+var cellTagOrder = []string{
+	"_cell_length_a",
+	"_cell_length_b",
+	"_cell_length_c",
+	"_cell_angle_alpha",
+	"_cell_angle_beta",
+	"_cell_angle_gamma",
+}
+
+// CIFItem is a single tag-value pair
+type CIFItem struct {
+	Tag   string
+	Value string
+}
+
+// CIFWriteOptions controls how a CIF file is serialized
+type CIFWriteOptions struct {
+	BlockName  string          // Overrides the data block name when set
+	Provenance []CIFItem       // Audit and provenance items written after the original metadata
+	ExtraLoops []types.CIFLoop // Additional loops, e.g. computed properties, written last
+}
+
+// CIFWriter serializes CIF files in a deterministic order
+type CIFWriter struct{}
+
+// NewCIFWriter creates a new CIF writer instance
+func NewCIFWriter() *CIFWriter {
+	return &CIFWriter{}
+}
+
+// Write serializes the selected data block of a CIF file. The original
+// metadata is written in file order, followed by the provenance items, the
+// cell, the symmetry operations, the atom sites, the retained loops and the
+// extra loops.
+func (w *CIFWriter) Write(cif *types.CIFFile, options *CIFWriteOptions) (string, error) {
+	if cif == nil {
+		return "", fmt.Errorf("invalid CIF file")
+	}
+	if options == nil {
+		options = &CIFWriteOptions{}
+	}
+
+	dataBlock := &cif.DataBlock
+	name := dataBlock.Name
+	if options.BlockName != "" {
+		name = options.BlockName
+	}
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return "", fmt.Errorf("invalid data block name %q", name)
+	}
+
+	var content strings.Builder
+	content.WriteString("data_" + name + "\n")
+
+	// Original metadata, skipping tags that the provenance items replace
+	provenanceTags := make(map[string]bool)
+	for _, item := range options.Provenance {
+		provenanceTags[strings.ToLower(item.Tag)] = true
+	}
+	for _, tag := range w.metadataTags(dataBlock) {
+		if provenanceTags[strings.ToLower(tag)] {
+			continue
+		}
+		w.writeItem(&content, tag, dataBlock.Metadata[tag])
+	}
+
+	if len(options.Provenance) > 0 {
+		content.WriteString("\n")
+		for _, item := range options.Provenance {
+			w.writeItem(&content, item.Tag, item.Value)
+		}
+	}
+
+	// Cell parameters in fixed order
+	content.WriteString("\n")
+	for _, tag := range cellTagOrder {
+		var value float64
+		var ok bool
+		if strings.HasPrefix(tag, "_cell_length_") {
+			value, ok = dataBlock.CellLength[tag]
+		} else {
+			value, ok = dataBlock.CellAngle[tag]
+		}
+		if !ok {
+			continue
+		}
+		w.writeItem(&content, tag, formatNumber(value, dataBlock.Uncertainties[tag], 6))
+	}
+
+	// Symmetry operations; a structure without any is written in P1
+	content.WriteString("\nloop_\n_symmetry_equiv_pos_as_xyz\n")
+	if len(dataBlock.Symmetry) == 0 {
+		content.WriteString("'x, y, z'\n")
+	}
+	for _, op := range dataBlock.Symmetry {
+		content.WriteString(formatValue(op.X+", "+op.Y+", "+op.Z) + "\n")
+	}
+
+	if len(dataBlock.AtomSites) > 0 {
+		content.WriteString("\n")
+		w.writeLoop(&content, w.atomSiteLoop(dataBlock.AtomSites, dataBlock.AtomSiteTags))
+	}
+
+	for _, loop := range dataBlock.Loops {
+		content.WriteString("\n")
+		w.writeLoop(&content, loop)
+	}
+
+	for _, loop := range options.ExtraLoops {
+		content.WriteString("\n")
+		w.writeLoop(&content, loop)
+	}
+
+	return content.String(), nil
+}
+
+// metadataTags returns the metadata tags in file order, followed by any tags
+// added since parsing in sorted order
+func (w *CIFWriter) metadataTags(dataBlock *types.CIFDataBlock) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, tag := range dataBlock.MetadataOrder {
+		if _, ok := dataBlock.Metadata[tag]; ok && !seen[tag] {
+			tags = append(tags, tag)
+			seen[tag] = true
+		}
+	}
+
+	var added []string
+	for tag := range dataBlock.Metadata {
+		if !seen[tag] {
+			added = append(added, tag)
+		}
+	}
+	sort.Strings(added)
+
+	return append(tags, added...)
+}
+
+// atomSiteLoop builds the atom site loop, including optional columns only
+// when at least one site uses them. The extra columns read from the input
+// follow, unless the loop already has a column of that name.
+func (w *CIFWriter) atomSiteLoop(sites []types.AtomSite, extraTags []string) types.CIFLoop {
+	var hasUIso, hasAdpType, hasOccupancy, hasAssembly, hasGroup, hasCharge bool
+	for _, site := range sites {
+		hasUIso = hasUIso || site.UIsoOrEquiv != 0
+		hasAdpType = hasAdpType || site.AdpType != ""
+		hasOccupancy = hasOccupancy || site.Occupancy != 1
+		hasAssembly = hasAssembly || site.DisorderAssembly != ""
+		hasGroup = hasGroup || site.DisorderGroup != ""
+		hasCharge = hasCharge || site.Charge != nil
+	}
+
+	loop := types.CIFLoop{Tags: []string{
+		"_atom_site_label",
+		"_atom_site_type_symbol",
+		"_atom_site_fract_x",
+		"_atom_site_fract_y",
+		"_atom_site_fract_z",
+	}}
+	if hasUIso {
+		loop.Tags = append(loop.Tags, "_atom_site_U_iso_or_equiv")
+	}
+	if hasAdpType {
+		loop.Tags = append(loop.Tags, "_atom_site_adp_type")
+	}
+	if hasOccupancy {
+		loop.Tags = append(loop.Tags, "_atom_site_occupancy")
+	}
+	if hasAssembly {
+		loop.Tags = append(loop.Tags, "_atom_site_disorder_assembly")
+	}
+	if hasGroup {
+		loop.Tags = append(loop.Tags, "_atom_site_disorder_group")
+	}
+	if hasCharge {
+		loop.Tags = append(loop.Tags, "_atom_site_charge")
+	}
+
+	written := make(map[string]bool)
+	for _, tag := range loop.Tags {
+		written[normalizeTag(tag)] = true
+	}
+	var extra []string
+	for _, tag := range extraTags {
+		if !written[normalizeTag(tag)] {
+			written[normalizeTag(tag)] = true
+			extra = append(extra, tag)
+		}
+	}
+	loop.Tags = append(loop.Tags, extra...)
+
+	for _, site := range sites {
+		typeSymbol := site.TypeSymbol
+		if typeSymbol == "" {
+			typeSymbol = site.Element
+		}
+
+		row := []string{
+			site.Label,
+			typeSymbol,
+			formatNumber(site.FractX, site.Uncertainties["_atom_site_fract_x"], 8),
+			formatNumber(site.FractY, site.Uncertainties["_atom_site_fract_y"], 8),
+			formatNumber(site.FractZ, site.Uncertainties["_atom_site_fract_z"], 8),
+		}
+		if hasUIso {
+			row = append(row, formatNumber(site.UIsoOrEquiv, site.Uncertainties["_atom_site_u_iso_or_equiv"], 6))
+		}
+		if hasAdpType {
+			row = append(row, placeholder(site.AdpType))
+		}
+		if hasOccupancy {
+			row = append(row, formatNumber(site.Occupancy, site.Uncertainties["_atom_site_occupancy"], 4))
+		}
+		if hasAssembly {
+			row = append(row, placeholder(site.DisorderAssembly))
+		}
+		if hasGroup {
+			row = append(row, placeholder(site.DisorderGroup))
+		}
+		if hasCharge {
+			if site.Charge != nil {
+				row = append(row, strconv.FormatFloat(*site.Charge, 'f', 6, 64))
+			} else {
+				row = append(row, "?")
+			}
+		}
+		for _, tag := range extra {
+			value, ok := site.Extra[tag]
+			if !ok {
+				value = "?"
+			}
+			row = append(row, value)
+		}
+		loop.Rows = append(loop.Rows, row)
+	}
+
+	return loop
+}
+
+// geometryCategories are the categories of bond, angle, torsion and
+// hydrogen bond lists, whose values and site labels are derived from the
+// atom positions
+var geometryCategories = []string{"_geom_bond_", "_geom_angle_", "_geom_torsion_", "_geom_hbond_"}
+
+// DropGeometryLists removes the geometry lists of a data block, as items or
+// loops, without touching the maps and slices it shares with other blocks.
+// They no longer hold once atoms have moved, or once expansion or disorder
+// resolution has changed the site labels.
+func DropGeometryLists(dataBlock *types.CIFDataBlock) {
+	isGeometry := func(tag string) bool {
+		normalized := normalizeTag(tag)
+		for _, category := range geometryCategories {
+			if strings.HasPrefix(normalized, category) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var loops []types.CIFLoop
+	for _, loop := range dataBlock.Loops {
+		if len(loop.Tags) == 0 || !isGeometry(loop.Tags[0]) {
+			loops = append(loops, loop)
+		}
+	}
+	dataBlock.Loops = loops
+
+	metadata := make(map[string]string, len(dataBlock.Metadata))
+	for tag, value := range dataBlock.Metadata {
+		if !isGeometry(tag) {
+			metadata[tag] = value
+		}
+	}
+	dataBlock.Metadata = metadata
+}
+
+// writeItem writes a single tag-value pair
+func (w *CIFWriter) writeItem(content *strings.Builder, tag, value string) {
+	formatted := formatValue(value)
+	if strings.HasPrefix(formatted, ";") {
+		content.WriteString(tag + "\n" + formatted + "\n")
+		return
+	}
+	content.WriteString(fmt.Sprintf("%-34s %s\n", tag, formatted))
+}
+
+// writeLoop writes a loop with one row per line; text fields go on their
+// own lines
+func (w *CIFWriter) writeLoop(content *strings.Builder, loop types.CIFLoop) {
+	content.WriteString("loop_\n")
+	for _, tag := range loop.Tags {
+		content.WriteString(tag + "\n")
+	}
+
+	for _, row := range loop.Rows {
+		line := make([]string, 0, len(row))
+		for _, value := range row {
+			formatted := formatValue(value)
+			if strings.HasPrefix(formatted, ";") {
+				if len(line) > 0 {
+					content.WriteString(strings.Join(line, " ") + "\n")
+					line = line[:0]
+				}
+				content.WriteString(formatted + "\n")
+				continue
+			}
+			line = append(line, formatted)
+		}
+		if len(line) > 0 {
+			content.WriteString(strings.Join(line, " ") + "\n")
+		}
+	}
+}
+
+// formatValue quotes a value as needed by CIF 1.1. The placeholders '?'
+// and '.' are written bare, multi-line values become text fields.
+func formatValue(value string) string {
+	if value == "?" || value == "." {
+		return value
+	}
+	if value == "" {
+		return "''"
+	}
+	if strings.Contains(value, "\n") {
+		return ";\n" + value + "\n;"
+	}
+
+	if !needsQuotes(value) {
+		return value
+	}
+
+	if !strings.Contains(value, "' ") && !strings.HasSuffix(value, "'") {
+		return "'" + value + "'"
+	}
+	if !strings.Contains(value, "\" ") && !strings.HasSuffix(value, "\"") {
+		return "\"" + value + "\""
+	}
+	return ";\n" + value + "\n;"
+}
+
+// needsQuotes reports whether a value cannot be written bare
+func needsQuotes(value string) bool {
+	if strings.ContainsAny(value, " \t") {
+		return true
+	}
+
+	switch value[0] {
+	case '_', '#', '$', '\'', '"', '[', ']', ';':
+		return true
+	}
+
+	lower := strings.ToLower(value)
+	for _, reserved := range []string{"data_", "save_"} {
+		if strings.HasPrefix(lower, reserved) {
+			return true
+		}
+	}
+	return lower == "loop_" || lower == "global_" || lower == "stop_"
+}
+
+// placeholder returns value, or '.' when it is empty
+func placeholder(value string) string {
+	if value == "" {
+		return "."
+	}
+	return value
+}
+
+// formatNumber formats a value with the given number of decimals, or with
+// the standard uncertainty in parentheses when su is non-zero
+func formatNumber(value, su float64, decimals int) string {
+	if su <= 0 {
+		return strconv.FormatFloat(value, 'f', decimals, 64)
+	}
+
+	// Express the uncertainty in units of the last digit, using at most two
+	// significant digits as is customary
+	digits := 0
+	scaled := su
+	for scaled < 2-1e-9 && digits < 12 {
+		scaled *= 10
+		digits++
+	}
+	if scaled >= 20 && digits > 0 {
+		scaled /= 10
+		digits--
+	}
+
+	return fmt.Sprintf("%s(%d)", strconv.FormatFloat(value, 'f', digits, 64), int64(scaled+0.5))
+}
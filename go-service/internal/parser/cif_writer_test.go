@@ -0,0 +1,218 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// roundTripCIF exercises the parts of a data block the writer must keep:
+// metadata with text fields and quotes, uncertainties, optional and unknown
+// atom site columns, anisotropic ADPs, geometry lists and other loops
+const roundTripCIF = `data_quartz
+_chemical_name_mineral 'alpha quartz'
+_publ_section_title
+;
+Low quartz; refined at 295 K
+;
+_journal_name_full "Acta Cryst. B"
+_symmetry_space_group_name_H-M 'P 32 2 1'
+_cell_length_a 4.9134(2)
+_cell_length_b 4.9134(2)
+_cell_length_c 5.4052(3)
+_cell_angle_alpha 90
+_cell_angle_beta 90
+_cell_angle_gamma 120
+_geom_special_details 'bonds from the refined model'
+loop_
+_symmetry_equiv_pos_as_xyz
+'x, y, z'
+'-y, x-y, z+1/3'
+loop_
+_atom_site_label
+_atom_site_type_symbol
+_atom_site_fract_x
+_atom_site_fract_y
+_atom_site_fract_z
+_atom_site_U_iso_or_equiv
+_atom_site_adp_type
+_atom_site_occupancy
+_atom_site_Wyckoff_symbol
+_atom_site_calc_flag
+_atom_site_refinement_flags
+Si1 Si 0.4697(1) 0.00000 0.00000 0.0066(2) Uani 1 3a d .
+O1 O 0.4133(3) 0.2672(3) 0.1188(2) 0.0130(4) Uani 0.95 6c d 'P R'
+loop_
+_atom_site_aniso_label
+_atom_site_aniso_U_11
+_atom_site_aniso_U_22
+_atom_site_aniso_U_33
+Si1 0.0066(3) 0.0053(4) 0.0072(3)
+O1 0.0132(7) 0.0101(7) 0.0127(6)
+loop_
+_geom_bond_atom_site_label_1
+_geom_bond_atom_site_label_2
+_geom_bond_distance
+Si1 O1 1.6092(3)
+loop_
+_geom_angle_atom_site_label_1
+_geom_angle_atom_site_label_2
+_geom_angle_atom_site_label_3
+_geom_angle
+O1 Si1 O1 109.2(1)
+loop_
+_publ_author_name
+'Smith, J.'
+"O'Brien, P."
+`
+
+func TestCIFWriterRoundTrip(t *testing.T) {
+	cifParser, writer := NewCIFParser(), NewCIFWriter()
+
+	original, err := cifParser.ParseFromString(roundTripCIF)
+	if err != nil {
+		t.Fatalf("ParseFromString: %v", err)
+	}
+	written, err := writer.Write(original, nil)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	again, err := cifParser.ParseFromString(written)
+	if err != nil {
+		t.Fatalf("failed to read the written CIF: %v\n%s", err, written)
+	}
+
+	if !reflect.DeepEqual(again.DataBlock, original.DataBlock) {
+		t.Errorf("data block changed on the round trip\ngot:  %+v\nwant: %+v\nwritten:\n%s", again.DataBlock, original.DataBlock, written)
+	}
+
+	// Writing is deterministic
+	rewritten, err := writer.Write(again, nil)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if rewritten != written {
+		t.Errorf("second write differs\nfirst:\n%s\nsecond:\n%s", written, rewritten)
+	}
+
+	for _, want := range []string{
+		"_atom_site_calc_flag",
+		"_atom_site_refinement_flags",
+		"O1 O 0.4133(3) 0.2672(3) 0.1188(2) 0.0130(4) Uani 0.9500 d 'P R'",
+		"_atom_site_aniso_U_11",
+		"_geom_bond_distance",
+	} {
+		if !strings.Contains(written, want) {
+			t.Errorf("written CIF lacks %q:\n%s", want, written)
+		}
+	}
+	// The Wyckoff letter depends on the site symmetry of the input
+	if strings.Contains(written, "Wyckoff") {
+		t.Errorf("derived atom site column written:\n%s", written)
+	}
+}
+
+func TestCIFWriterExtraColumns(t *testing.T) {
+	charge := -0.5
+	block := cubicBlock(4, []types.AtomSite{
+		{Label: "O1", TypeSymbol: "O", Occupancy: 1, Charge: &charge, Extra: map[string]string{"_atom_site_charge": "-2", "_atom_site_calc_flag": "d"}},
+		// A site added after parsing has no value for the extra columns
+		{Label: "O2", TypeSymbol: "O", Occupancy: 1},
+	})
+	block.AtomSiteTags = []string{"_atom_site_charge", "_atom_site_calc_flag"}
+
+	written, err := NewCIFWriter().Write(&types.CIFFile{DataBlock: block}, nil)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// The computed charge replaces the column read from the input
+	if strings.Count(written, "_atom_site_charge") != 1 {
+		t.Errorf("charge column written more than once:\n%s", written)
+	}
+	for _, want := range []string{"O1 O 0.00000000 0.00000000 0.00000000 -0.500000 d", "O2 O 0.00000000 0.00000000 0.00000000 ? ?"} {
+		if !strings.Contains(written, want) {
+			t.Errorf("written CIF lacks %q:\n%s", want, written)
+		}
+	}
+}
+
+func TestDropGeometryLists(t *testing.T) {
+	cif, err := NewCIFParser().ParseFromString(roundTripCIF + `_geom_bond_distance_single 1.61
+`)
+	if err != nil {
+		t.Fatalf("ParseFromString: %v", err)
+	}
+	block := cif.DataBlock
+	DropGeometryLists(&block)
+
+	var tags []string
+	for _, loop := range block.Loops {
+		tags = append(tags, loop.Tags[0])
+	}
+	if want := []string{"_atom_site_aniso_label", "_publ_author_name"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("got loops %v, want %v", tags, want)
+	}
+	if _, ok := block.Metadata["_geom_bond_distance_single"]; ok {
+		t.Errorf("geometry item kept")
+	}
+	if _, ok := block.Metadata["_geom_special_details"]; !ok {
+		t.Errorf("geometry details dropped")
+	}
+
+	// The parsed block shares its maps and slices and must not change
+	if len(cif.DataBlock.Loops) != 4 {
+		t.Errorf("loops of the original block changed")
+	}
+	if _, ok := cif.DataBlock.Metadata["_geom_bond_distance_single"]; !ok {
+		t.Errorf("metadata of the original block changed")
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Si1", "Si1"},
+		{"?", "?"},
+		{".", "."},
+		{"", "''"},
+		{"P 1", "'P 1'"},
+		{"_tag", "'_tag'"},
+		{"data_x", "'data_x'"},
+		{"loop_", "'loop_'"},
+		// A quote not followed by white space does not end a quoted value
+		{"O'Brien, P.", "'O'Brien, P.'"},
+		{"it' s", "\"it' s\""},
+		{"it's \"x\" y' z", ";\nit's \"x\" y' z\n;"},
+		{"a\nb", ";\na\nb\n;"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.want {
+			t.Errorf("formatValue(%q): got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		value, su float64
+		decimals  int
+		want      string
+	}{
+		{0.5, 0, 8, "0.50000000"},
+		// Uncertainties starting with 1 keep two digits
+		{0.4697, 0.0001, 8, "0.46970(10)"},
+		{4.9134, 0.0002, 6, "4.9134(2)"},
+		{109.2, 0.15, 6, "109.20(15)"},
+		{1.6092, 0.0025, 6, "1.609(3)"},
+	}
+	for _, tt := range tests {
+		if got := formatNumber(tt.value, tt.su, tt.decimals); got != tt.want {
+			t.Errorf("formatNumber(%v, %v): got %q, want %q", tt.value, tt.su, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"dftbopt-mcp/go-service/internal/elements"
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// BondTolerance scales the sum of two covalent radii into the largest
+// distance at which the atoms count as bonded
+const BondTolerance = 1.2
+
+// bondKey identifies a bond between atoms i <= j, where atom j sits in the
+// periodic image shifted by image lattice vectors
+type bondKey struct {
+	i, j  int
+	image [3]int
+}
+
+// CompareGeometries compares the input and optimized geometries of one
+// structure. Displacements follow the minimum-image convention for periodic
+// geometries, and bonds are derived from covalent radii before and after.
+// labels names the atoms in geometry order.
+func CompareGeometries(initial, final *types.DFTBGeometry, labels []string) (*types.StructureComparison, error) {
+	n := len(initial.Coordinates)
+	if len(final.Coordinates) != n || len(labels) != n {
+		return nil, fmt.Errorf("input has %d atoms, optimized geometry %d and %d labels", n, len(final.Coordinates), len(labels))
+	}
+	if initial.Periodic != final.Periodic {
+		return nil, fmt.Errorf("input and optimized geometries differ in periodicity")
+	}
+
+	// Work in fractional coordinates of each lattice for periodic systems;
+	// the optimized positions are unwrapped next to their input positions
+	start := make([][3]float64, n)
+	end := make([][3]float64, n)
+	var initialInverse, finalInverse [3][3]float64
+	if initial.Periodic {
+		var err error
+		if initialInverse, err = InvertLattice(initial.LatticeVectors); err != nil {
+			return nil, fmt.Errorf("invalid input lattice: %v", err)
+		}
+		if finalInverse, err = InvertLattice(final.LatticeVectors); err != nil {
+			return nil, fmt.Errorf("invalid optimized lattice: %v", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if len(initial.Coordinates[i]) != 3 || len(final.Coordinates[i]) != 3 {
+			return nil, fmt.Errorf("atom %s: expected 3 coordinates", labels[i])
+		}
+		for k := 0; k < 3; k++ {
+			start[i][k] = initial.Coordinates[i][k] - initial.Origin[k]
+			end[i][k] = final.Coordinates[i][k] - final.Origin[k]
+		}
+		if initial.Periodic {
+			start[i] = CartesianToFractional(initialInverse, start[i])
+			end[i] = CartesianToFractional(finalInverse, end[i])
+			for k := 0; k < 3; k++ {
+				end[i][k] = start[i][k] + minimumImage(end[i][k]-start[i][k])
+			}
+		}
+	}
+
+	comparison := &types.StructureComparison{
+		Displacements: make([]types.AtomDisplacement, n),
+		BondsFormed:   []types.BondChange{},
+		BondsBroken:   []types.BondChange{},
+	}
+
+	sumSquares := 0.0
+	for i := 0; i < n; i++ {
+		var vector [3]float64
+		if initial.Periodic {
+			var frac [3]float64
+			for k := 0; k < 3; k++ {
+				frac[k] = end[i][k] - start[i][k]
+			}
+			vector = FractionalToCartesian(final.LatticeVectors, frac)
+		} else {
+			for k := 0; k < 3; k++ {
+				vector[k] = end[i][k] - start[i][k]
+			}
+		}
+		distance := math.Sqrt(vector[0]*vector[0] + vector[1]*vector[1] + vector[2]*vector[2])
+
+		comparison.Displacements[i] = types.AtomDisplacement{
+			Label:     labels[i],
+			Element:   initial.Elements[initial.Species[i]],
+			VectorA:   vector,
+			DistanceA: distance,
+		}
+		sumSquares += distance * distance
+		if distance > comparison.MaxDisplacementA {
+			comparison.MaxDisplacementA = distance
+			comparison.MaxDisplacementAtom = labels[i]
+		}
+	}
+	if n > 0 {
+		comparison.RMSDA = math.Sqrt(sumSquares / float64(n))
+	}
+
+	// Connectivity before and after
+	radii := make([]float64, n)
+	for i := 0; i < n; i++ {
+		if element, ok := elements.Lookup(initial.Elements[initial.Species[i]]); ok {
+			radii[i] = element.CovalentRadius
+		}
+	}
+	before := findBonds(initial, start, radii)
+	after := findBonds(final, end, radii)
+
+	for key, length := range before {
+		if _, ok := after[key]; !ok {
+			comparison.BondsBroken = append(comparison.BondsBroken, bondChange(key, labels, length, bondLength(final, end, key)))
+		}
+	}
+	for key, length := range after {
+		if _, ok := before[key]; !ok {
+			comparison.BondsFormed = append(comparison.BondsFormed, bondChange(key, labels, bondLength(initial, start, key), length))
+		}
+	}
+	sortBondChanges(comparison.BondsBroken)
+	sortBondChanges(comparison.BondsFormed)
+	comparison.ConnectivityChanged = len(comparison.BondsBroken) > 0 || len(comparison.BondsFormed) > 0
+
+	return comparison, nil
+}
+
+// minimumImage wraps a fractional difference into [-0.5, 0.5)
+func minimumImage(delta float64) float64 {
+	return delta - math.Floor(delta+0.5)
+}
+
+// findBonds returns the bonded atom pairs of a geometry with their lengths.
+// positions are fractional for periodic geometries and Cartesian (relative
+// to the origin) otherwise. Atoms without a known covalent radius are skipped.
+func findBonds(geometry *types.DFTBGeometry, positions [][3]float64, radii []float64) map[bondKey]float64 {
+	maxRadius := 0.0
+	for _, radius := range radii {
+		maxRadius = math.Max(maxRadius, radius)
+	}
+	cutoff := 2 * maxRadius * BondTolerance
+
+	// Periodic images needed to cover the cutoff along each lattice vector
+	var reach [3]int
+	if geometry.Periodic {
+		// The lattice was inverted successfully by the caller
+		spacings, _ := PlaneSpacings(geometry.LatticeVectors)
+		for k := 0; k < 3; k++ {
+			reach[k] = int(math.Ceil(cutoff/spacings[k])) + 1
+		}
+	}
+
+	bonds := make(map[bondKey]float64)
+	for i := range positions {
+		if radii[i] == 0 {
+			continue
+		}
+		for j := i; j < len(positions); j++ {
+			if radii[j] == 0 {
+				continue
+			}
+			limit := (radii[i] + radii[j]) * BondTolerance
+
+			for a := -reach[0]; a <= reach[0]; a++ {
+				for b := -reach[1]; b <= reach[1]; b++ {
+					for c := -reach[2]; c <= reach[2]; c++ {
+						image := [3]int{a, b, c}
+						if i == j && !positiveImage(image) {
+							// Skip the atom itself and count each self-image bond once
+							continue
+						}
+						key := bondKey{i: i, j: j, image: image}
+						if length := bondLength(geometry, positions, key); length <= limit {
+							bonds[key] = length
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return bonds
+}
+
+// positiveImage reports whether the first non-zero component is positive
+func positiveImage(image [3]int) bool {
+	for _, component := range image {
+		if component != 0 {
+			return component > 0
+		}
+	}
+	return false
+}
+
+// bondLength returns the distance between atom i and the image of atom j
+func bondLength(geometry *types.DFTBGeometry, positions [][3]float64, key bondKey) float64 {
+	var delta [3]float64
+	for k := 0; k < 3; k++ {
+		delta[k] = positions[key.j][k] - positions[key.i][k]
+		if geometry.Periodic {
+			delta[k] += float64(key.image[k])
+		}
+	}
+	if geometry.Periodic {
+		delta = FractionalToCartesian(geometry.LatticeVectors, delta)
+	}
+	return math.Sqrt(delta[0]*delta[0] + delta[1]*delta[1] + delta[2]*delta[2])
+}
+
+// bondChange describes a bond that was formed or broken
+func bondChange(key bondKey, labels []string, before, after float64) types.BondChange {
+	change := types.BondChange{
+		Atom1:          labels[key.i],
+		Atom2:          labels[key.j],
+		Index1:         key.i + 1,
+		Index2:         key.j + 1,
+		InitialLengthA: before,
+		FinalLengthA:   after,
+	}
+	if key.image != [3]int{} {
+		image := key.image
+		change.Image = &image
+	}
+	return change
+}
+
+// sortBondChanges orders bond changes by atom indices and image
+func sortBondChanges(changes []types.BondChange) {
+	sort.Slice(changes, func(a, b int) bool {
+		if changes[a].Index1 != changes[b].Index1 {
+			return changes[a].Index1 < changes[b].Index1
+		}
+		if changes[a].Index2 != changes[b].Index2 {
+			return changes[a].Index2 < changes[b].Index2
+		}
+		imageA, imageB := imageOf(changes[a]), imageOf(changes[b])
+		for k := 0; k < 3; k++ {
+			if imageA[k] != imageB[k] {
+				return imageA[k] < imageB[k]
+			}
+		}
+		return false
+	})
+}
+
+// imageOf returns the image of a bond change, zero for bonds inside the cell
+func imageOf(change types.BondChange) [3]int {
+	if change.Image == nil {
+		return [3]int{}
+	}
+	return *change.Image
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// carbonGeometry builds a geometry of carbon atoms, periodic when a lattice
+// is given
+func carbonGeometry(lattice *[3][3]float64, coordinates ...[]float64) *types.DFTBGeometry {
+	geometry := &types.DFTBGeometry{Elements: []string{"C"}, Coordinates: coordinates}
+	for range coordinates {
+		geometry.Species = append(geometry.Species, 0)
+	}
+	if lattice != nil {
+		geometry.Periodic = true
+		geometry.LatticeVectors = *lattice
+	}
+	return geometry
+}
+
+func TestCompareGeometries(t *testing.T) {
+	cubic := [3][3]float64{{10, 0, 0}, {0, 10, 0}, {0, 0, 10}}
+	narrow := [3][3]float64{{1.5, 0, 0}, {0, 10, 0}, {0, 0, 10}}
+	wide := [3][3]float64{{2.5, 0, 0}, {0, 10, 0}, {0, 0, 10}}
+
+	tests := []struct {
+		name           string
+		initial, final *types.DFTBGeometry
+		labels         []string
+		vectors        [][3]float64
+		rmsd           float64
+		formed, broken []types.BondChange
+	}{
+		{
+			// DFTB+ wraps C1 back into the cell; it moved 0.1 Angstrom, not 9.9
+			name:    "atom wrapped across the boundary",
+			initial: carbonGeometry(&cubic, []float64{9.95, 5, 5}, []float64{5, 5, 5}),
+			final:   carbonGeometry(&cubic, []float64{0.05, 5, 5}, []float64{5, 5, 5}),
+			labels:  []string{"C1", "C2"},
+			vectors: [][3]float64{{0.1, 0, 0}, {0, 0, 0}},
+			rmsd:    math.Sqrt(0.01 / 2),
+		},
+		{
+			// C2 is bonded to C1 through the cell face at x = 0
+			name:    "bond to a periodic image kept",
+			initial: carbonGeometry(&cubic, []float64{0.5, 5, 5}, []float64{9, 5, 5}),
+			final:   carbonGeometry(&cubic, []float64{0.4, 5, 5}, []float64{9.1, 5, 5}),
+			labels:  []string{"C1", "C2"},
+			vectors: [][3]float64{{-0.1, 0, 0}, {0.1, 0, 0}},
+			rmsd:    0.1,
+		},
+		{
+			name:    "bond to a periodic image broken",
+			initial: carbonGeometry(&cubic, []float64{0.5, 5, 5}, []float64{9, 5, 5}),
+			final:   carbonGeometry(&cubic, []float64{0.5, 5, 5}, []float64{8, 5, 5}),
+			labels:  []string{"C1", "C2"},
+			vectors: [][3]float64{{0, 0, 0}, {-1, 0, 0}},
+			rmsd:    math.Sqrt(0.5),
+			broken:  []types.BondChange{{Atom1: "C1", Atom2: "C2", Index1: 1, Index2: 2, Image: &[3]int{-1, 0, 0}, InitialLengthA: 1.5, FinalLengthA: 2.5}},
+		},
+		{
+			name:    "bond formed in a molecule",
+			initial: carbonGeometry(nil, []float64{0, 0, 0}, []float64{2.5, 0, 0}),
+			final:   carbonGeometry(nil, []float64{0.5, 0, 0}, []float64{2, 0, 0}),
+			labels:  []string{"C1", "C2"},
+			vectors: [][3]float64{{0.5, 0, 0}, {-0.5, 0, 0}},
+			rmsd:    0.5,
+			formed:  []types.BondChange{{Atom1: "C1", Atom2: "C2", Index1: 1, Index2: 2, InitialLengthA: 2.5, FinalLengthA: 1.5}},
+		},
+		{
+			// A single atom bonded to its own image along a short axis; the
+			// bond is counted once and breaks when the cell expands
+			name:    "self-image bond in a small cell",
+			initial: carbonGeometry(&narrow, []float64{0.75, 5, 5}),
+			final:   carbonGeometry(&wide, []float64{1.25, 5, 5}),
+			labels:  []string{"C1"},
+			vectors: [][3]float64{{0, 0, 0}},
+			broken:  []types.BondChange{{Atom1: "C1", Atom2: "C1", Index1: 1, Index2: 1, Image: &[3]int{1, 0, 0}, InitialLengthA: 1.5, FinalLengthA: 2.5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparison, err := CompareGeometries(tt.initial, tt.final, tt.labels)
+			if err != nil {
+				t.Fatalf("CompareGeometries: %v", err)
+			}
+
+			for i, displacement := range comparison.Displacements {
+				for k := 0; k < 3; k++ {
+					if !approxEqual(displacement.VectorA[k], tt.vectors[i][k], 1e-9) {
+						t.Errorf("atom %s: got displacement %v, want %v", displacement.Label, displacement.VectorA, tt.vectors[i])
+						break
+					}
+				}
+			}
+			if !approxEqual(comparison.RMSDA, tt.rmsd, 1e-9) {
+				t.Errorf("RMSD: got %v, want %v", comparison.RMSDA, tt.rmsd)
+			}
+
+			for _, changes := range [][]types.BondChange{comparison.BondsFormed, comparison.BondsBroken} {
+				for i := range changes {
+					changes[i].InitialLengthA = math.Round(changes[i].InitialLengthA*1e9) / 1e9
+					changes[i].FinalLengthA = math.Round(changes[i].FinalLengthA*1e9) / 1e9
+				}
+			}
+			if tt.formed == nil {
+				tt.formed = []types.BondChange{}
+			}
+			if tt.broken == nil {
+				tt.broken = []types.BondChange{}
+			}
+			if !reflect.DeepEqual(comparison.BondsFormed, tt.formed) || !reflect.DeepEqual(comparison.BondsBroken, tt.broken) {
+				t.Errorf("got bonds formed %+v and broken %+v, want %+v and %+v", comparison.BondsFormed, comparison.BondsBroken, tt.formed, tt.broken)
+			}
+			if changed := len(tt.formed)+len(tt.broken) > 0; comparison.ConnectivityChanged != changed {
+				t.Errorf("ConnectivityChanged = %v, want %v", comparison.ConnectivityChanged, changed)
+			}
+		})
+	}
+}
+
+func TestCompareGeometriesErrors(t *testing.T) {
+	cubic := [3][3]float64{{10, 0, 0}, {0, 10, 0}, {0, 0, 10}}
+	molecule := carbonGeometry(nil, []float64{0, 0, 0})
+	if _, err := CompareGeometries(molecule, carbonGeometry(nil, []float64{0, 0, 0}, []float64{1, 0, 0}), []string{"C1"}); err == nil {
+		t.Errorf("expected an error for different atom counts")
+	}
+	if _, err := CompareGeometries(molecule, carbonGeometry(&cubic, []float64{0, 0, 0}), []string{"C1"}); err == nil {
+		t.Errorf("expected an error for different periodicity")
+	}
+	singular := [3][3]float64{{1, 0, 0}, {2, 0, 0}, {0, 0, 1}}
+	if _, err := CompareGeometries(carbonGeometry(&cubic, []float64{0, 0, 0}), carbonGeometry(&singular, []float64{0, 0, 0}), []string{"C1"}); err == nil {
+		t.Errorf("expected an error for a singular lattice")
+	}
+}
@@ -0,0 +1,313 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// Ends of a structure from which region layers are counted
+const (
+	RegionFromBottom = "bottom"
+	RegionFromTop    = "top"
+)
+
+// DefaultLayerTolerance is the largest gap in Angstrom between the
+// coordinates of atoms in the same layer
+const DefaultLayerTolerance = 0.5
+
+// ApplyConstraints fixes the atoms selected by each constraint along its
+// axes. Selectors of one constraint are combined: an atom must match every
+// given selector, and any entry of a selector list. Indices are 1-based and
+// refer to the expanded structure; a label also selects the symmetry copies
+// of that site. Layers of a periodic structure are counted after unwrapping
+// it along the region axis, so a slab that crosses the cell boundary stays
+// whole. Constraints that select no atom, and selectors that do not match the
+// atom list, are errors. Fixed axes already present, and the fixed lattice
+// axes of POSCAR selective dynamics, are kept.
+func (p *CIFParser) ApplyConstraints(cif *types.CIFFile, constraints []types.AtomConstraint) (*types.CIFFile, error) {
+	if cif == nil {
+		return nil, fmt.Errorf("invalid CIF file")
+	}
+	if len(constraints) == 0 {
+		return cif, nil
+	}
+
+	sites := cif.DataBlock.AtomSites
+	lattice, err := LatticeFromDataBlock(&cif.DataBlock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cell parameters: %v", err)
+	}
+	periodic := !cif.DataBlock.NonPeriodic
+
+	constrained := &types.CIFFile{DataBlock: cif.DataBlock}
+	constrained.DataBlock.AtomSites = append([]types.AtomSite(nil), sites...)
+
+	for n, constraint := range constraints {
+		axes, err := constraintAxes(constraint.Axes)
+		if err != nil {
+			return nil, fmt.Errorf("constraint %d: %v", n+1, err)
+		}
+		selected, err := selectAtoms(sites, lattice, cif.DataBlock.Origin, periodic, constraint)
+		if err != nil {
+			return nil, fmt.Errorf("constraint %d: %v", n+1, err)
+		}
+
+		count := 0
+		for i, ok := range selected {
+			if !ok {
+				continue
+			}
+			count++
+			for k := 0; k < 3; k++ {
+				constrained.DataBlock.AtomSites[i].FixedAxes[k] = constrained.DataBlock.AtomSites[i].FixedAxes[k] || axes[k]
+			}
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("constraint %d selects no atoms", n+1)
+		}
+	}
+
+	constrained.DataBlocks = []types.CIFDataBlock{constrained.DataBlock}
+	return constrained, nil
+}
+
+// IsFrozen reports whether an atom is fixed along every Cartesian or every
+// lattice axis and cannot move at all
+func IsFrozen(site types.AtomSite) bool {
+	return site.FixedAxes == [3]bool{true, true, true} || site.FixedLatticeAxes == [3]bool{true, true, true}
+}
+
+// constraintAxes parses the fixed axes of a constraint; all axes when none
+// are given
+func constraintAxes(names []string) ([3]bool, error) {
+	if len(names) == 0 {
+		return [3]bool{true, true, true}, nil
+	}
+
+	var axes [3]bool
+	for _, name := range names {
+		axis, err := cartesianAxis(name)
+		if err != nil {
+			return axes, err
+		}
+		axes[axis] = true
+	}
+	return axes, nil
+}
+
+// cartesianAxis returns the index of the axis "x", "y" or "z"
+func cartesianAxis(name string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "x":
+		return 0, nil
+	case "y":
+		return 1, nil
+	case "z":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid axis %q, expected x, y or z", name)
+}
+
+// selectAtoms returns which atoms match every selector of a constraint
+func selectAtoms(sites []types.AtomSite, lattice [3][3]float64, origin [3]float64, periodic bool, constraint types.AtomConstraint) ([]bool, error) {
+	if len(constraint.Indices) == 0 && len(constraint.Labels) == 0 && len(constraint.Elements) == 0 && constraint.Region == nil {
+		return nil, fmt.Errorf("no indices, labels, elements or region given")
+	}
+
+	selected := make([]bool, len(sites))
+	for i := range selected {
+		selected[i] = true
+	}
+	restrict := func(match []bool) {
+		for i := range selected {
+			selected[i] = selected[i] && match[i]
+		}
+	}
+
+	if len(constraint.Indices) > 0 {
+		match := make([]bool, len(sites))
+		for _, index := range constraint.Indices {
+			if index < 1 || index > len(sites) {
+				return nil, fmt.Errorf("atom index %d out of range 1-%d", index, len(sites))
+			}
+			match[index-1] = true
+		}
+		restrict(match)
+	}
+
+	if len(constraint.Labels) > 0 {
+		match := make([]bool, len(sites))
+		for _, label := range constraint.Labels {
+			found := false
+			for i, site := range sites {
+				if site.Label == label || site.Parent == label {
+					match[i] = true
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("no atom site labelled %s", label)
+			}
+		}
+		restrict(match)
+	}
+
+	if len(constraint.Elements) > 0 {
+		match := make([]bool, len(sites))
+		for _, element := range constraint.Elements {
+			found := false
+			for i, site := range sites {
+				if strings.EqualFold(site.Element, element) {
+					match[i] = true
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("structure has no %s atoms", element)
+			}
+		}
+		restrict(match)
+	}
+
+	if constraint.Region != nil {
+		match, err := selectRegion(sites, lattice, origin, periodic, constraint.Region)
+		if err != nil {
+			return nil, fmt.Errorf("region: %v", err)
+		}
+		restrict(match)
+	}
+
+	return selected, nil
+}
+
+// selectRegion returns the atoms inside a coordinate range along a Cartesian
+// axis, or in the outermost layers counted from the bottom or top. Ranges
+// apply to the coordinates as read; layers of a periodic structure are
+// counted on coordinates unwrapped along the axis.
+func selectRegion(sites []types.AtomSite, lattice [3][3]float64, origin [3]float64, periodic bool, region *types.ConstraintRegion) ([]bool, error) {
+	axis, err := cartesianAxis(region.Axis)
+	if err != nil {
+		return nil, err
+	}
+
+	ranged := region.Min != nil || region.Max != nil
+	switch {
+	case ranged && region.Layers != 0:
+		return nil, fmt.Errorf("min/max and layers are mutually exclusive")
+	case !ranged && region.Layers <= 0:
+		return nil, fmt.Errorf("either min/max or a positive number of layers is required")
+	case region.Min != nil && region.Max != nil && *region.Min > *region.Max:
+		return nil, fmt.Errorf("min must not exceed max")
+	}
+
+	fractional := make([][3]float64, len(sites))
+	for i, site := range sites {
+		fractional[i] = [3]float64{site.FractX, site.FractY, site.FractZ}
+	}
+	if periodic && !ranged {
+		fractional = unwrapAlongAxis(lattice, fractional, axis)
+	}
+	positions := make([][3]float64, len(sites))
+	for i, frac := range fractional {
+		pos := FractionalToCartesian(lattice, frac)
+		positions[i] = [3]float64{pos[0] + origin[0], pos[1] + origin[1], pos[2] + origin[2]}
+	}
+
+	match := make([]bool, len(positions))
+	if ranged {
+		for i, pos := range positions {
+			match[i] = (region.Min == nil || pos[axis] >= *region.Min) && (region.Max == nil || pos[axis] <= *region.Max)
+		}
+		return match, nil
+	}
+
+	from := region.From
+	if from == "" {
+		from = RegionFromBottom
+	}
+	if from != RegionFromBottom && from != RegionFromTop {
+		return nil, fmt.Errorf("invalid layer origin %q, expected %s or %s", region.From, RegionFromBottom, RegionFromTop)
+	}
+	tolerance := region.LayerTolerance
+	if tolerance == 0 {
+		tolerance = DefaultLayerTolerance
+	}
+	if tolerance < 0 {
+		return nil, fmt.Errorf("layer tolerance must be positive")
+	}
+
+	// Group the atoms into layers: a new layer starts at every gap wider than
+	// the tolerance, walking away from the chosen end
+	order := make([]int, len(positions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if from == RegionFromTop {
+			return positions[order[a]][axis] > positions[order[b]][axis]
+		}
+		return positions[order[a]][axis] < positions[order[b]][axis]
+	})
+
+	layer := 1
+	for n, i := range order {
+		if n > 0 && math.Abs(positions[i][axis]-positions[order[n-1]][axis]) > tolerance {
+			layer++
+		}
+		if layer > region.Layers {
+			break
+		}
+		match[i] = true
+	}
+	if layer < region.Layers {
+		return nil, fmt.Errorf("structure has only %d layers along %s", layer, region.Axis)
+	}
+
+	return match, nil
+}
+
+// unwrapAlongAxis wraps the fractional coordinates along every lattice vector
+// with a component on the Cartesian axis into one unbroken run: the atoms
+// below the largest gap, counting the gap across the cell boundary, are moved
+// up by one cell. Symmetry copies are wrapped into [0, 1), so without this a
+// slab crossing the boundary would be split between the bottom and the top.
+func unwrapAlongAxis(lattice [3][3]float64, fractional [][3]float64, axis int) [][3]float64 {
+	unwrapped := make([][3]float64, len(fractional))
+	copy(unwrapped, fractional)
+	if len(fractional) == 0 {
+		return unwrapped
+	}
+
+	for j := 0; j < 3; j++ {
+		if math.Abs(lattice[j][axis]) < 1e-6 {
+			continue
+		}
+
+		values := make([]float64, len(unwrapped))
+		for i := range unwrapped {
+			unwrapped[i][j] -= math.Floor(unwrapped[i][j])
+			values[i] = unwrapped[i][j]
+		}
+		sort.Float64s(values)
+
+		// The gap across the boundary needs no shift
+		cut := values[0]
+		largest := values[0] + 1 - values[len(values)-1]
+		for n := 1; n < len(values); n++ {
+			if gap := values[n] - values[n-1]; gap > largest {
+				largest = gap
+				cut = values[n]
+			}
+		}
+		for i := range unwrapped {
+			if unwrapped[i][j] < cut {
+				unwrapped[i][j]++
+			}
+		}
+	}
+	return unwrapped
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// slabSites is a four-layer slab in a 10 Angstrom cell whose bottom layer
+// was wrapped to the top of the cell: the vacuum runs from z = 0.3 to 0.95
+func slabSites() []types.AtomSite {
+	return []types.AtomSite{
+		{Label: "O1", Element: "O", FractX: 0, FractY: 0, FractZ: 0.95},
+		{Label: "Si1", Element: "Si", FractX: 0.5, FractY: 0.5, FractZ: 0.02},
+		{Label: "Si1_2", Parent: "Si1", Element: "Si", FractX: 0, FractY: 0.5, FractZ: 0.12},
+		{Label: "Si2", Element: "Si", FractX: 0.5, FractY: 0, FractZ: 0.22},
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestApplyConstraints(t *testing.T) {
+	all := [3]bool{true, true, true}
+	tests := []struct {
+		name        string
+		constraints []types.AtomConstraint
+		nonPeriodic bool
+		fixed       [][3]bool
+	}{
+		{
+			name:        "indices",
+			constraints: []types.AtomConstraint{{Indices: []int{2, 4}}},
+			fixed:       [][3]bool{{}, all, {}, all},
+		},
+		{
+			name:        "label selects symmetry copies",
+			constraints: []types.AtomConstraint{{Labels: []string{"Si1"}}},
+			fixed:       [][3]bool{{}, all, all, {}},
+		},
+		{
+			name:        "copy label selects only the copy",
+			constraints: []types.AtomConstraint{{Labels: []string{"Si1_2"}}},
+			fixed:       [][3]bool{{}, {}, all, {}},
+		},
+		{
+			name:        "element on some axes",
+			constraints: []types.AtomConstraint{{Elements: []string{"o"}, Axes: []string{"x", "Y"}}},
+			fixed:       [][3]bool{{true, true, false}, {}, {}, {}},
+		},
+		{
+			name:        "selectors combine",
+			constraints: []types.AtomConstraint{{Elements: []string{"Si"}, Region: &types.ConstraintRegion{Axis: "z", Max: floatPtr(1.5)}}},
+			fixed:       [][3]bool{{}, all, all, {}},
+		},
+		{
+			name:        "bottom layer across the cell boundary",
+			constraints: []types.AtomConstraint{{Region: &types.ConstraintRegion{Axis: "z", Layers: 1}}},
+			fixed:       [][3]bool{all, {}, {}, {}},
+		},
+		{
+			name:        "bottom layers across the cell boundary",
+			constraints: []types.AtomConstraint{{Region: &types.ConstraintRegion{Axis: "z", Layers: 2}}},
+			fixed:       [][3]bool{all, all, {}, {}},
+		},
+		{
+			name:        "top layer across the cell boundary",
+			constraints: []types.AtomConstraint{{Region: &types.ConstraintRegion{Axis: "z", Layers: 1, From: RegionFromTop}}},
+			fixed:       [][3]bool{{}, {}, {}, all},
+		},
+		{
+			name:        "molecule is not unwrapped",
+			constraints: []types.AtomConstraint{{Region: &types.ConstraintRegion{Axis: "z", Layers: 1}}},
+			nonPeriodic: true,
+			fixed:       [][3]bool{{}, all, {}, {}},
+		},
+		{
+			name: "fixed axes accumulate",
+			constraints: []types.AtomConstraint{
+				{Indices: []int{1}, Axes: []string{"z"}},
+				{Indices: []int{1}, Axes: []string{"x"}},
+			},
+			fixed: [][3]bool{{true, false, true}, {}, {}, {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := cubicBlock(10, slabSites())
+			block.NonPeriodic = tt.nonPeriodic
+			cif := &types.CIFFile{DataBlock: block}
+
+			constrained, err := NewCIFParser().ApplyConstraints(cif, tt.constraints)
+			if err != nil {
+				t.Fatalf("ApplyConstraints: %v", err)
+			}
+			for i, site := range constrained.DataBlock.AtomSites {
+				if site.FixedAxes != tt.fixed[i] {
+					t.Errorf("atom %d (%s at z = %v): fixed %v, want %v", i+1, site.Label, site.FractZ, site.FixedAxes, tt.fixed[i])
+				}
+			}
+			if cif.DataBlock.AtomSites[0].FixedAxes != [3]bool{} {
+				t.Errorf("the input structure was modified")
+			}
+		})
+	}
+}
+
+func TestApplyConstraintsIndependentSuffixedSite(t *testing.T) {
+	// O1_2 is a site of its own, and the copy of O1 was renamed to avoid it
+	block := cubicBlock(10, []types.AtomSite{
+		{Label: "O1", Element: "O"},
+		{Label: "O1_2", Element: "O", FractX: 0.3},
+		{Label: "O1_3", Parent: "O1", Element: "O", FractX: 0.5},
+	})
+	constrained, err := NewCIFParser().ApplyConstraints(&types.CIFFile{DataBlock: block}, []types.AtomConstraint{{Labels: []string{"O1"}}})
+	if err != nil {
+		t.Fatalf("ApplyConstraints: %v", err)
+	}
+	for i, want := range []bool{true, false, true} {
+		if site := constrained.DataBlock.AtomSites[i]; IsFrozen(site) != want {
+			t.Errorf("%s: frozen %v, want %v", site.Label, IsFrozen(site), want)
+		}
+	}
+}
+
+func TestApplyConstraintsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint types.AtomConstraint
+		err        string
+	}{
+		{"no selector", types.AtomConstraint{Axes: []string{"x"}}, "no indices, labels, elements or region"},
+		{"index out of range", types.AtomConstraint{Indices: []int{5}}, "out of range 1-4"},
+		{"unknown label", types.AtomConstraint{Labels: []string{"Si3"}}, "no atom site labelled Si3"},
+		{"unknown element", types.AtomConstraint{Elements: []string{"Fe"}}, "no Fe atoms"},
+		{"invalid axis", types.AtomConstraint{Indices: []int{1}, Axes: []string{"w"}}, "invalid axis"},
+		{"empty selection", types.AtomConstraint{Elements: []string{"O"}, Indices: []int{2}}, "selects no atoms"},
+		{"range and layers", types.AtomConstraint{Region: &types.ConstraintRegion{Axis: "z", Min: floatPtr(0), Layers: 1}}, "mutually exclusive"},
+		{"inverted range", types.AtomConstraint{Region: &types.ConstraintRegion{Axis: "z", Min: floatPtr(2), Max: floatPtr(1)}}, "min must not exceed max"},
+		{"too many layers", types.AtomConstraint{Region: &types.ConstraintRegion{Axis: "z", Layers: 5}}, "only 4 layers along z"},
+		{"invalid origin", types.AtomConstraint{Region: &types.ConstraintRegion{Axis: "z", Layers: 1, From: "middle"}}, "invalid layer origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cif := &types.CIFFile{DataBlock: cubicBlock(10, slabSites())}
+			_, err := NewCIFParser().ApplyConstraints(cif, []types.AtomConstraint{tt.constraint})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,493 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// Unit conversions between DFTB+ atomic units and the units of the API
+const (
+	HartreeToEV    = 27.211386245988
+	BohrToAngstrom = 0.529177210903
+
+	EVPerAngstrom3ToGPa  = 160.21766208
+	HartreePerBohr3ToGPa = HartreeToEV / (BohrToAngstrom * BohrToAngstrom * BohrToAngstrom) * EVPerAngstrom3ToGPa
+)
+
+// DefaultMaxGeometrySteps is the geometry step limit of the optimization driver
+const DefaultMaxGeometrySteps = 1000
+
+// ResultsTagEntry is a single tagged value of a results.tag file. Values
+// are stored flat in Fortran (column-major) order; logical values are 1 or 0.
+type ResultsTagEntry struct {
+	Type   string // "real", "integer", "logical" or "complex"
+	Shape  []int
+	Values []float64
+}
+
+// detailedEnergyKeys maps the energy labels of detailed.out onto the keys of
+// DFTBOutput.EnergiesEV; other labels are converted to snake case
+var detailedEnergyKeys = map[string]string{
+	"total energy":                "total",
+	"total electronic energy":     "total_electronic",
+	"repulsive energy":            "repulsive",
+	"band energy":                 "band",
+	"band free energy (e-ts)":     "band_free",
+	"energy h0":                   "h0",
+	"energy scc":                  "scc",
+	"energy 3rd":                  "third_order",
+	"dispersion energy":           "dispersion",
+	"total mermin free energy":    "mermin_free",
+	"extrapolated e(0k)":          "extrapolated_0k",
+	"force related energy":        "force_related",
+	"ts":                          "ts",
+	"energy l.s":                  "spin_orbit",
+	"energy spin":                 "spin",
+	"energy halogen x-correction": "halogen_correction",
+}
+
+// resultsTagEnergyKeys maps the energy tags of results.tag onto the keys of
+// DFTBOutput.EnergiesEV
+var resultsTagEnergyKeys = map[string]string{
+	"total_energy":         "total",
+	"mermin_energy":        "mermin_free",
+	"extrapolated0_energy": "extrapolated_0k",
+	"forcerelated_energy":  "force_related",
+}
+
+var (
+	// Matches "Label:   -4.0869 H   -111.2103 eV"
+	detailedEnergyLine = regexp.MustCompile(`^\s*([^:]+?):\s+(\S+)\s+H\s+(\S+)\s+eV\s*$`)
+	// Matches "Geometry optimization step: 12" and "Geometry step: 12"
+	geometryStepLine = regexp.MustCompile(`(?i)^\s*geometry\s+(?:optimi[sz]ation\s+)?step:\s*(\d+)`)
+	// Matches the final "Geometry converged" message of the driver
+	geometryConvergedLine = regexp.MustCompile(`(?i)^\s*geometry converged`)
+	// Matches the "!!! Geometry did NOT converge!" warning of the driver
+	geometryNotConvergedLine = regexp.MustCompile(`(?i)geometry did not converge`)
+	// Matches a results.tag header such as "forces   :real:2:3,8"
+	resultsTagHeader  = regexp.MustCompile(`^([A-Za-z0-9_]+)\s*:(real|integer|logical|complex):(\d+):(.*)$`)
+	snakeCaseReplacer = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// DFTBOutputParser reads the detailed.out and results.tag files of a DFTB+ run
+type DFTBOutputParser struct{}
+
+// NewDFTBOutputParser creates a new DFTB+ output parser instance
+func NewDFTBOutputParser() *DFTBOutputParser {
+	return &DFTBOutputParser{}
+}
+
+// NewDFTBOutput returns an empty output ready to be filled by the parser
+func NewDFTBOutput() *types.DFTBOutput {
+	output := &types.DFTBOutput{
+		EnergiesEV:      make(map[string]float64),
+		EnergiesHartree: make(map[string]float64),
+	}
+	output.Summary.Warnings = []string{}
+	return output
+}
+
+// ParseDetailedOut fills output from the content of detailed.out: energy
+// components, Fermi level, charge, electron count, dipole, SCC convergence,
+// the geometry step and warnings
+func (p *DFTBOutputParser) ParseDetailedOut(content string, output *types.DFTBOutput) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("detailed.out is empty")
+	}
+
+	sccSeen := false
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		lower := strings.ToLower(line)
+
+		if warning, consumed := parseWarning(lines, i); warning != "" {
+			output.Summary.Warnings = append(output.Summary.Warnings, warning)
+			i += consumed
+			continue
+		}
+
+		switch {
+		case lower == "total forces":
+			rows := parseAtomBlock(lines, i+1, 3)
+			atoms := resizeAtoms(output, len(rows))
+			for n, row := range rows {
+				for k := 0; k < 3; k++ {
+					atoms[n].ForceEVA[k] = row[k] * HartreeToEV / BohrToAngstrom
+				}
+			}
+			i += len(rows)
+		case strings.HasPrefix(lower, "atomic gross charges"):
+			rows := parseAtomBlock(lines, i+1, 1)
+			atoms := resizeAtoms(output, len(rows))
+			for n, row := range rows {
+				atoms[n].MullikenCharge = row[0]
+			}
+			i += len(rows)
+		case geometryStepLine.MatchString(line):
+			step, _ := strconv.Atoi(geometryStepLine.FindStringSubmatch(line)[1])
+			output.ConvergenceInfo.GeometrySteps = step + 1
+		case strings.HasPrefix(lower, "scc converged"):
+			output.ConvergenceInfo.SCCConverged = true
+			sccSeen = true
+		case strings.HasPrefix(lower, "scc is not converged"):
+			output.ConvergenceInfo.SCCConverged = false
+			sccSeen = true
+		case strings.HasPrefix(lower, "pressure:"):
+			if val, ok := firstFloat(line[len("pressure:"):]); ok {
+				if output.Stress == nil {
+					output.Stress = &types.Stress{}
+				}
+				output.Stress.PressureGPa = val * HartreePerBohr3ToGPa
+			}
+		case strings.HasPrefix(lower, "total charge:"):
+			if val, ok := firstFloat(line[len("total charge:"):]); ok {
+				output.ElectronicProperties.TotalCharge = val
+			}
+		case strings.HasPrefix(lower, "input / output electrons (q):"):
+			fields := strings.Fields(line[len("input / output electrons (q):"):])
+			if len(fields) > 0 {
+				if val, err := strconv.ParseFloat(fields[len(fields)-1], 64); err == nil {
+					output.ElectronicProperties.NumberOfElectrons = val
+				}
+			}
+		case strings.HasPrefix(lower, "dipole moment:") && strings.HasSuffix(lower, "debye"):
+			fields := strings.Fields(line[len("dipole moment:") : len(line)-len("debye")])
+			if len(fields) == 3 {
+				if vector, err := parseVector(fields); err == nil {
+					output.ElectronicProperties.DipoleMomentDebye.X = vector[0]
+					output.ElectronicProperties.DipoleMomentDebye.Y = vector[1]
+					output.ElectronicProperties.DipoleMomentDebye.Z = vector[2]
+				}
+			}
+		default:
+			match := detailedEnergyLine.FindStringSubmatch(lines[i])
+			if match == nil {
+				continue
+			}
+			hartree, err := parseFortranFloat(match[2])
+			if err != nil {
+				continue
+			}
+			label := strings.ToLower(strings.TrimSpace(match[1]))
+			if label == "fermi level" {
+				output.ElectronicProperties.FermiLevelEV = hartree * HartreeToEV
+				continue
+			}
+			key, ok := detailedEnergyKeys[label]
+			if !ok {
+				key = strings.Trim(snakeCaseReplacer.ReplaceAllString(label, "_"), "_")
+			}
+			setEnergy(output, key, hartree)
+		}
+	}
+
+	// Non-SCC calculations report no SCC status and have nothing to converge
+	if !sccSeen {
+		output.ConvergenceInfo.SCCConverged = true
+	}
+
+	updateForceSummary(output)
+
+	return nil
+}
+
+// GeometryStep is the energy and largest force component DFTB+ reports on
+// standard output for one geometry step, in atomic units
+type GeometryStep struct {
+	Step          int
+	EnergyHartree float64
+	MaxForce      float64 // Hartree/Bohr
+}
+
+// ParseGeometrySteps reads the per-step energies and largest force
+// components from the standard output of a geometry optimization
+func (p *DFTBOutputParser) ParseGeometrySteps(content string) []GeometryStep {
+	var steps []GeometryStep
+	var current *GeometryStep
+	energySeen := false
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		lower := strings.ToLower(trimmed)
+
+		if match := geometryStepLine.FindStringSubmatch(trimmed); match != nil {
+			step, _ := strconv.Atoi(match[1])
+			steps = append(steps, GeometryStep{Step: step})
+			current = &steps[len(steps)-1]
+			energySeen = false
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(lower, "total energy:") && !energySeen:
+			if val, ok := firstFloat(trimmed[len("total energy:"):]); ok {
+				current.EnergyHartree = val
+				energySeen = true
+			}
+		case strings.HasPrefix(lower, "maximal force component:"):
+			if val, ok := firstFloat(trimmed[len("maximal force component:"):]); ok {
+				current.MaxForce = val
+			}
+		}
+	}
+
+	return steps
+}
+
+// ParseGeometryConvergence reports whether the standard output of a geometry
+// optimization ends with the driver reaching its convergence criterion. seen
+// is false when the output holds neither the convergence message nor the
+// warning DFTB+ prints when the driver gives up.
+func (p *DFTBOutputParser) ParseGeometryConvergence(content string) (converged, seen bool) {
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case geometryNotConvergedLine.MatchString(line):
+			converged, seen = false, true
+		case geometryConvergedLine.MatchString(line):
+			converged, seen = true, true
+		}
+	}
+	return converged, seen
+}
+
+// ParseResultsTag parses the tagged results.tag format
+func (p *DFTBOutputParser) ParseResultsTag(content string) (map[string]*ResultsTagEntry, error) {
+	entries := make(map[string]*ResultsTagEntry)
+
+	var current *ResultsTagEntry
+	for n, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if match := resultsTagHeader.FindStringSubmatch(trimmed); match != nil {
+			current = &ResultsTagEntry{Type: match[2]}
+			if dims := strings.TrimSpace(match[4]); dims != "" {
+				for _, dim := range strings.Split(dims, ",") {
+					size, err := strconv.Atoi(strings.TrimSpace(dim))
+					if err != nil {
+						return nil, fmt.Errorf("line %d: invalid shape %q", n+1, dims)
+					}
+					current.Shape = append(current.Shape, size)
+				}
+			}
+			entries[strings.ToLower(match[1])] = current
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("line %d: value before the first tag", n+1)
+		}
+
+		for _, field := range strings.Fields(trimmed) {
+			if current.Type == "logical" {
+				val := 0.0
+				if strings.EqualFold(field, "T") {
+					val = 1
+				}
+				current.Values = append(current.Values, val)
+				continue
+			}
+
+			val, err := parseFortranFloat(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value %q", n+1, field)
+			}
+			current.Values = append(current.Values, val)
+		}
+	}
+
+	return entries, nil
+}
+
+// ApplyResultsTag fills the values of output that detailed.out did not
+// provide from the parsed results.tag entries
+func (p *DFTBOutputParser) ApplyResultsTag(entries map[string]*ResultsTagEntry, output *types.DFTBOutput) {
+	for tag, key := range resultsTagEnergyKeys {
+		if _, ok := output.EnergiesHartree[key]; ok {
+			continue
+		}
+		if entry, ok := entries[tag]; ok && len(entry.Values) > 0 {
+			setEnergy(output, key, entry.Values[0])
+		}
+	}
+
+	if output.ElectronicProperties.FermiLevelEV == 0 {
+		if entry, ok := entries["fermi_level"]; ok && len(entry.Values) > 0 {
+			output.ElectronicProperties.FermiLevelEV = entry.Values[0] * HartreeToEV
+		}
+	}
+
+	if output.ElectronicProperties.NumberOfElectrons == 0 {
+		if entry, ok := entries["number_of_electrons"]; ok && len(entry.Values) > 0 {
+			output.ElectronicProperties.NumberOfElectrons = entry.Values[0]
+		}
+	}
+
+	// Per-atom results; results.tag is more precise than detailed.out
+	if entry, ok := entries["gross_atomic_charges"]; ok {
+		atoms := resizeAtoms(output, len(entry.Values))
+		for i, charge := range entry.Values {
+			atoms[i].MullikenCharge = charge
+		}
+	}
+	if entry, ok := entries["forces"]; ok && len(entry.Values)%3 == 0 {
+		atoms := resizeAtoms(output, len(entry.Values)/3)
+		for i := range atoms {
+			for k := 0; k < 3; k++ {
+				atoms[i].ForceEVA[k] = entry.Values[3*i+k] * HartreeToEV / BohrToAngstrom
+			}
+		}
+	}
+	updateForceSummary(output)
+
+	// Stress tensor of periodic systems; the pressure of detailed.out is
+	// kept, otherwise it is a third of the trace as DFTB+ defines it
+	if entry, ok := entries["stress"]; ok && len(entry.Values) == 9 {
+		pressureSeen := output.Stress != nil
+		if output.Stress == nil {
+			output.Stress = &types.Stress{}
+		}
+		output.Stress.TensorGPa = make([][]float64, 3)
+		trace := 0.0
+		for i := 0; i < 3; i++ {
+			output.Stress.TensorGPa[i] = make([]float64, 3)
+			for j := 0; j < 3; j++ {
+				// Column-major: element (i,j) is stored at i + 3j
+				output.Stress.TensorGPa[i][j] = entry.Values[i+3*j] * HartreePerBohr3ToGPa
+			}
+			trace += output.Stress.TensorGPa[i][i]
+		}
+		if !pressureSeen {
+			output.Stress.PressureGPa = trace / 3
+		}
+	}
+}
+
+// resizeAtoms makes sure output holds n per-atom results and returns them
+func resizeAtoms(output *types.DFTBOutput, n int) []types.AtomResult {
+	if len(output.Atoms) != n {
+		atoms := make([]types.AtomResult, n)
+		copy(atoms, output.Atoms)
+		output.Atoms = atoms
+	}
+	return output.Atoms
+}
+
+// updateForceSummary computes the largest force, the RMS force and the
+// largest force component from the per-atom forces
+func updateForceSummary(output *types.DFTBOutput) {
+	if len(output.Atoms) == 0 {
+		return
+	}
+
+	var maxNorm, sumSquares, maxComponent float64
+	for _, atom := range output.Atoms {
+		squared := 0.0
+		for _, component := range atom.ForceEVA {
+			squared += component * component
+			maxComponent = math.Max(maxComponent, math.Abs(component))
+		}
+		maxNorm = math.Max(maxNorm, math.Sqrt(squared))
+		sumSquares += squared
+	}
+
+	output.Forces.MaxForceEVA = maxNorm
+	output.Forces.RMSForceEVA = math.Sqrt(sumSquares / float64(len(output.Atoms)))
+	output.Forces.MaxComponentEVA = maxComponent
+}
+
+// parseAtomBlock reads the per-atom rows following a detailed.out heading
+// such as "Total Forces" or "Atomic gross charges (e)". Rows may start with
+// the atom index; the last width fields of each row are returned.
+func parseAtomBlock(lines []string, start, width int) [][]float64 {
+	var rows [][]float64
+	for i := start; i < len(lines); i++ {
+		row, ok := parseAtomRow(strings.Fields(lines[i]), width)
+		if !ok {
+			// Skip a few blank lines and column headers before the first row
+			if len(rows) > 0 || i-start >= 3 {
+				break
+			}
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// parseAtomRow parses a row of width numbers, optionally preceded by an
+// atom index
+func parseAtomRow(fields []string, width int) ([]float64, bool) {
+	if len(fields) < width || len(fields) > width+1 {
+		return nil, false
+	}
+
+	row := make([]float64, width)
+	for k, field := range fields[len(fields)-width:] {
+		val, err := parseFortranFloat(field)
+		if err != nil {
+			return nil, false
+		}
+		row[k] = val
+	}
+	return row, true
+}
+
+// setEnergy stores an energy given in Hartree in both unit maps
+func setEnergy(output *types.DFTBOutput, key string, hartree float64) {
+	output.EnergiesHartree[key] = hartree
+	output.EnergiesEV[key] = hartree * HartreeToEV
+}
+
+// parseWarning recognizes the warnings DFTB+ writes, either on one line
+// ("WARNING: ...") or as "WARNING!" followed by "->" lines. It returns the
+// warning text and the number of extra lines consumed.
+func parseWarning(lines []string, i int) (string, int) {
+	line := strings.TrimSpace(lines[i])
+	if !strings.HasPrefix(strings.ToUpper(line), "WARNING") {
+		return "", 0
+	}
+
+	text := strings.TrimLeft(line[len("WARNING"):], "!: ")
+	consumed := 0
+	for j := i + 1; j < len(lines); j++ {
+		next := strings.TrimSpace(lines[j])
+		if !strings.HasPrefix(next, "->") {
+			break
+		}
+		text = strings.TrimSpace(text + " " + strings.TrimSpace(next[2:]))
+		consumed++
+	}
+
+	if text == "" {
+		text = line
+	}
+	return text, consumed
+}
+
+// firstFloat parses the first field of s as a number
+func firstFloat(s string) (float64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	val, err := parseFortranFloat(fields[0])
+	return val, err == nil
+}
+
+// parseFortranFloat parses a number that may use a Fortran exponent such as
+// "0.1D+01"
+func parseFortranFloat(s string) (float64, error) {
+	return strconv.ParseFloat(strings.NewReplacer("D", "E", "d", "e").Replace(s), 64)
+}
@@ -0,0 +1,226 @@
+package parser
+
+import (
+	"testing"
+)
+
+const detailedOut = `Fermi level:                        -0.1720453823 H           -4.6816 eV
+Band energy:                        -3.3940036372 H          -92.3553 eV
+
+Total charge:                        0.0000000000
+Input / Output electrons (q):      8.00000000      8.00000000
+
+Atomic gross charges (e)
+Atom           Charge
+   1      -0.59153231
+   2       0.29576616
+   3       0.29576616
+
+Energy H0:                          -4.2302467658 H         -115.1108 eV
+Energy SCC:                          0.0264393045 H            0.7194 eV
+Total Electronic energy:            -4.2038074613 H         -114.3914 eV
+Repulsive energy:                    0.0541035934 H            1.4722 eV
+Total energy:                       -4.1497038679 H         -112.9192 eV
+Total Mermin free energy:           -4.1497038679 H         -112.9192 eV
+
+Total Forces
+    1     -0.000000000000      0.000000000000     -0.000123456000
+    2      0.000000000000      0.000081234000      0.000061728000
+    3      0.000000000000     -0.000081234000      0.000061728000
+
+Dipole moment:   0.00000000    0.00000000    0.64330000 au
+Dipole moment:   0.00000000    0.00000000    1.63510000 Debye
+
+Geometry optimization step: 6
+SCC converged
+
+WARNING!
+-> Unusually short distance between atoms
+-> 1 and 2
+`
+
+func TestParseDetailedOut(t *testing.T) {
+	parser := NewDFTBOutputParser()
+	output := NewDFTBOutput()
+	if err := parser.ParseDetailedOut(detailedOut, output); err != nil {
+		t.Fatalf("ParseDetailedOut: %v", err)
+	}
+
+	energies := []struct {
+		key     string
+		hartree float64
+	}{
+		{"total", -4.1497038679},
+		{"total_electronic", -4.2038074613},
+		{"repulsive", 0.0541035934},
+		{"band", -3.3940036372},
+		{"h0", -4.2302467658},
+		{"scc", 0.0264393045},
+		{"mermin_free", -4.1497038679},
+	}
+	for _, e := range energies {
+		if output.EnergiesHartree[e.key] != e.hartree {
+			t.Errorf("energy %s: got %v H, want %v H", e.key, output.EnergiesHartree[e.key], e.hartree)
+		}
+		if !approxEqual(output.EnergiesEV[e.key], e.hartree*HartreeToEV, 1e-9) {
+			t.Errorf("energy %s: %v eV does not match %v H", e.key, output.EnergiesEV[e.key], e.hartree)
+		}
+	}
+
+	props := output.ElectronicProperties
+	if !approxEqual(props.FermiLevelEV, -0.1720453823*HartreeToEV, 1e-9) {
+		t.Errorf("Fermi level: got %v eV", props.FermiLevelEV)
+	}
+	if props.NumberOfElectrons != 8 {
+		t.Errorf("electrons: got %v, want 8", props.NumberOfElectrons)
+	}
+	if props.DipoleMomentDebye.Z != 1.6351 {
+		t.Errorf("dipole: got %+v, want the Debye line", props.DipoleMomentDebye)
+	}
+
+	if len(output.Atoms) != 3 {
+		t.Fatalf("expected 3 atoms, got %d", len(output.Atoms))
+	}
+	if output.Atoms[0].MullikenCharge != -0.59153231 {
+		t.Errorf("charge of atom 1: got %v", output.Atoms[0].MullikenCharge)
+	}
+	if want := -0.000123456 * HartreeToEV / BohrToAngstrom; !approxEqual(output.Atoms[0].ForceEVA[2], want, 1e-12) {
+		t.Errorf("force of atom 1: got %v, want %v eV/Angstrom", output.Atoms[0].ForceEVA, want)
+	}
+	if want := 0.000123456 * HartreeToEV / BohrToAngstrom; !approxEqual(output.Forces.MaxComponentEVA, want, 1e-12) {
+		t.Errorf("largest force component: got %v, want %v", output.Forces.MaxComponentEVA, want)
+	}
+
+	if !output.ConvergenceInfo.SCCConverged || output.ConvergenceInfo.GeometrySteps != 7 {
+		t.Errorf("convergence: got %+v, want SCC converged after 7 geometry steps", output.ConvergenceInfo)
+	}
+	if len(output.Summary.Warnings) != 1 || output.Summary.Warnings[0] != "Unusually short distance between atoms 1 and 2" {
+		t.Errorf("warnings: got %q", output.Summary.Warnings)
+	}
+}
+
+func TestParseDetailedOutSCCNotConverged(t *testing.T) {
+	output := NewDFTBOutput()
+	content := "Total energy: -1.0 H -27.2114 eV\nSCC is NOT converged, maximal SCC iterations exceeded\n"
+	if err := NewDFTBOutputParser().ParseDetailedOut(content, output); err != nil {
+		t.Fatalf("ParseDetailedOut: %v", err)
+	}
+	if output.ConvergenceInfo.SCCConverged {
+		t.Errorf("SCC reported as converged")
+	}
+	if err := NewDFTBOutputParser().ParseDetailedOut("  \n", NewDFTBOutput()); err == nil {
+		t.Errorf("expected an error for an empty detailed.out")
+	}
+}
+
+const resultsTag = `total_energy        :real:0:
+  -0.414970386790000E+01
+forces              :real:2:3,2
+   0.100000000000000E-02  0.200000000000000E-02  0.300000000000000E-02
+  -0.100000000000000E-02 -0.200000000000000E-02 -0.300000000000000E-02
+gross_atomic_charges:real:1:2
+  -0.25  0.25
+stress              :real:2:3,3
+   0.1D-04  0.2D-05  0.0
+   0.3D-05  0.2D-04  0.0
+   0.0      0.0      0.3D-04
+fermi_level         :real:0:
+  -0.172045382300000E+00
+number_of_electrons :real:0:
+   8.0
+scc_converged       :logical:0:
+ T
+`
+
+func TestParseResultsTag(t *testing.T) {
+	parser := NewDFTBOutputParser()
+	entries, err := parser.ParseResultsTag(resultsTag)
+	if err != nil {
+		t.Fatalf("ParseResultsTag: %v", err)
+	}
+
+	forces := entries["forces"]
+	if forces == nil || len(forces.Shape) != 2 || forces.Shape[0] != 3 || forces.Shape[1] != 2 || len(forces.Values) != 6 {
+		t.Fatalf("forces entry: got %+v", forces)
+	}
+	if entries["scc_converged"].Values[0] != 1 {
+		t.Errorf("logical value T not read as 1")
+	}
+
+	output := NewDFTBOutput()
+	parser.ApplyResultsTag(entries, output)
+
+	if output.EnergiesHartree["total"] != -4.14970386790 {
+		t.Errorf("total energy: got %v H", output.EnergiesHartree["total"])
+	}
+	if len(output.Atoms) != 2 || output.Atoms[1].MullikenCharge != 0.25 {
+		t.Fatalf("atoms: got %+v", output.Atoms)
+	}
+	if want := -0.003 * HartreeToEV / BohrToAngstrom; !approxEqual(output.Atoms[1].ForceEVA[2], want, 1e-12) {
+		t.Errorf("force z of atom 2: got %v, want %v", output.Atoms[1].ForceEVA[2], want)
+	}
+
+	// Column-major storage: the second value of the file is element (2,1)
+	stress := output.Stress
+	if stress == nil {
+		t.Fatalf("no stress tensor")
+	}
+	if !approxEqual(stress.TensorGPa[1][0], 0.2e-5*HartreePerBohr3ToGPa, 1e-12) || !approxEqual(stress.TensorGPa[0][1], 0.3e-5*HartreePerBohr3ToGPa, 1e-12) {
+		t.Errorf("stress tensor not read column-major: %v", stress.TensorGPa)
+	}
+	if want := (0.1e-4 + 0.2e-4 + 0.3e-4) / 3 * HartreePerBohr3ToGPa; !approxEqual(stress.PressureGPa, want, 1e-9) {
+		t.Errorf("pressure: got %v GPa, want %v", stress.PressureGPa, want)
+	}
+	if output.ElectronicProperties.NumberOfElectrons != 8 {
+		t.Errorf("electrons: got %v", output.ElectronicProperties.NumberOfElectrons)
+	}
+}
+
+func TestApplyResultsTagKeepsDetailedOut(t *testing.T) {
+	parser := NewDFTBOutputParser()
+	output := NewDFTBOutput()
+	setEnergy(output, "total", -1.5)
+	output.ElectronicProperties.FermiLevelEV = -3
+
+	entries, err := parser.ParseResultsTag(resultsTag)
+	if err != nil {
+		t.Fatalf("ParseResultsTag: %v", err)
+	}
+	parser.ApplyResultsTag(entries, output)
+
+	if output.EnergiesHartree["total"] != -1.5 || output.ElectronicProperties.FermiLevelEV != -3 {
+		t.Errorf("values from detailed.out were overwritten: %v, %v", output.EnergiesHartree["total"], output.ElectronicProperties.FermiLevelEV)
+	}
+}
+
+func TestParseResultsTagErrors(t *testing.T) {
+	tests := map[string]string{
+		"value before tag": "1.0\n",
+		"invalid shape":    "forces :real:2:3,x\n",
+		"invalid value":    "total_energy :real:0:\n abc\n",
+	}
+	for name, content := range tests {
+		if _, err := NewDFTBOutputParser().ParseResultsTag(content); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseGeometryConvergence(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		converged bool
+		seen      bool
+	}{
+		{"converged", "Geometry step: 12\n\nGeometry converged\n", true, true},
+		{"not converged", "Geometry step: 1000\n!!! Geometry did NOT converge!\n", false, true},
+		{"no verdict", "Geometry step: 3\n", false, false},
+	}
+	for _, tt := range tests {
+		converged, seen := NewDFTBOutputParser().ParseGeometryConvergence(tt.content)
+		if converged != tt.converged || seen != tt.seen {
+			t.Errorf("%s: got (%v, %v), want (%v, %v)", tt.name, converged, seen, tt.converged, tt.seen)
+		}
+	}
+}
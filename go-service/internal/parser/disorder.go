@@ -0,0 +1,218 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// Disorder policies applied before a structure is handed to DFTB+
+const (
+	DisorderPolicyReject           = "reject"            // Refuse disordered structures
+	DisorderPolicyHighestOccupancy = "highest_occupancy" // Keep the most occupied part of each disorder
+	DisorderPolicyGroup            = "group"             // Keep one chosen disorder group
+)
+
+// fullOccupancyTolerance is how far below 1 an occupancy may be and still
+// count as a fully occupied site
+const fullOccupancyTolerance = 1e-3
+
+// overlapDistance is the distance in Angstrom below which two partially
+// occupied sites without disorder groups are treated as alternatives
+const overlapDistance = 0.5
+
+// IsValidDisorderPolicy reports whether policy names a known disorder policy
+func IsValidDisorderPolicy(policy string) bool {
+	switch policy {
+	case DisorderPolicyReject, DisorderPolicyHighestOccupancy, DisorderPolicyGroup:
+		return true
+	}
+	return false
+}
+
+// isDisordered reports whether a site is partially occupied or belongs to a
+// disorder group
+func isDisordered(site types.AtomSite) bool {
+	return site.Occupancy < 1.0-fullOccupancyTolerance || hasDisorderGroup(site)
+}
+
+// hasDisorderGroup reports whether a site belongs to a disorder group
+func hasDisorderGroup(site types.AtomSite) bool {
+	return site.DisorderGroup != "" && site.DisorderGroup != "0"
+}
+
+// ApplyDisorderPolicy returns a copy of the CIF with disorder resolved
+// according to policy. group names the disorder group to keep under the
+// "group" policy. Ordered structures are returned unchanged.
+func (p *CIFParser) ApplyDisorderPolicy(cif *types.CIFFile, policy, group string) (*types.CIFFile, error) {
+	if cif == nil {
+		return nil, fmt.Errorf("invalid CIF file")
+	}
+
+	var disordered []string
+	for _, site := range cif.DataBlock.AtomSites {
+		if isDisordered(site) {
+			disordered = append(disordered, site.Label)
+		}
+	}
+
+	if len(disordered) == 0 {
+		return cif, nil
+	}
+
+	var kept []types.AtomSite
+	var err error
+
+	switch policy {
+	case DisorderPolicyReject:
+		return nil, fmt.Errorf("structure is disordered (%d sites with partial occupancy or disorder groups, e.g. %s); choose the %s or %s disorder policy",
+			len(disordered), disordered[0], DisorderPolicyHighestOccupancy, DisorderPolicyGroup)
+	case DisorderPolicyHighestOccupancy:
+		kept, err = p.keepHighestOccupancy(&cif.DataBlock)
+	case DisorderPolicyGroup:
+		kept, err = p.keepDisorderGroup(&cif.DataBlock, group)
+	default:
+		return nil, fmt.Errorf("unknown disorder policy: %s", policy)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &types.CIFFile{DataBlock: cif.DataBlock}
+	resolved.DataBlock.AtomSites = kept
+
+	labels := make(map[string]bool, len(kept))
+	for _, site := range kept {
+		labels[site.Label] = true
+	}
+	filterAnisoLoop(&resolved.DataBlock, labels)
+	resolved.DataBlocks = []types.CIFDataBlock{resolved.DataBlock}
+
+	return resolved, nil
+}
+
+// keepHighestOccupancy keeps, within every disorder assembly, the group with
+// the highest mean occupancy. Partially occupied sites without a group that
+// overlap are resolved to the most occupied one.
+func (p *CIFParser) keepHighestOccupancy(dataBlock *types.CIFDataBlock) ([]types.AtomSite, error) {
+	type groupStats struct {
+		total float64
+		count int
+		order int
+	}
+
+	// Mean occupancy of every group within each assembly
+	stats := make(map[string]map[string]*groupStats)
+	for _, site := range dataBlock.AtomSites {
+		if !hasDisorderGroup(site) {
+			continue
+		}
+		if stats[site.DisorderAssembly] == nil {
+			stats[site.DisorderAssembly] = make(map[string]*groupStats)
+		}
+		groups := stats[site.DisorderAssembly]
+		if groups[site.DisorderGroup] == nil {
+			groups[site.DisorderGroup] = &groupStats{order: len(groups)}
+		}
+		groups[site.DisorderGroup].total += site.Occupancy
+		groups[site.DisorderGroup].count++
+	}
+
+	best := make(map[string]string)
+	for assembly, groups := range stats {
+		names := make([]string, 0, len(groups))
+		for name := range groups {
+			names = append(names, name)
+		}
+		// Ties go to the group listed first in the file
+		sort.Slice(names, func(i, j int) bool {
+			a, b := groups[names[i]], groups[names[j]]
+			meanA, meanB := a.total/float64(a.count), b.total/float64(b.count)
+			if meanA != meanB {
+				return meanA > meanB
+			}
+			return a.order < b.order
+		})
+		best[assembly] = names[0]
+	}
+
+	var grouped []types.AtomSite
+	for _, site := range dataBlock.AtomSites {
+		if !hasDisorderGroup(site) || best[site.DisorderAssembly] == site.DisorderGroup {
+			grouped = append(grouped, site)
+		}
+	}
+
+	return p.resolveOverlappingSites(dataBlock, grouped)
+}
+
+// keepDisorderGroup keeps the atoms of the chosen group together with all
+// atoms outside any disorder group. Overlapping partially occupied sites
+// without a group are resolved as under the highest_occupancy policy.
+func (p *CIFParser) keepDisorderGroup(dataBlock *types.CIFDataBlock, group string) ([]types.AtomSite, error) {
+	if group == "" {
+		return nil, fmt.Errorf("the %s disorder policy requires a disorder group", DisorderPolicyGroup)
+	}
+
+	found := false
+	var kept []types.AtomSite
+	for _, site := range dataBlock.AtomSites {
+		if !hasDisorderGroup(site) {
+			kept = append(kept, site)
+			continue
+		}
+		if site.DisorderGroup == group {
+			kept = append(kept, site)
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("disorder group %s not found in structure", group)
+	}
+
+	return p.resolveOverlappingSites(dataBlock, kept)
+}
+
+// resolveOverlappingSites drops partially occupied sites without a disorder
+// group that overlap a more occupied site
+func (p *CIFParser) resolveOverlappingSites(dataBlock *types.CIFDataBlock, sites []types.AtomSite) ([]types.AtomSite, error) {
+	lattice, err := LatticeFromDataBlock(dataBlock)
+	if err != nil {
+		return nil, err
+	}
+	metric := latticeMetric(lattice)
+
+	var kept []types.AtomSite
+	for i, site := range sites {
+		if hasDisorderGroup(site) || site.Occupancy >= 1.0-fullOccupancyTolerance {
+			kept = append(kept, site)
+			continue
+		}
+
+		dominated := false
+		for j, other := range sites {
+			if i == j || hasDisorderGroup(other) {
+				continue
+			}
+			// Ties go to the site listed first
+			if other.Occupancy < site.Occupancy || other.Occupancy == site.Occupancy && j > i {
+				continue
+			}
+			pos := [3]float64{site.FractX, site.FractY, site.FractZ}
+			otherPos := [3]float64{other.FractX, other.FractY, other.FractZ}
+			if periodicDistance(metric, pos, otherPos) < overlapDistance {
+				dominated = true
+				break
+			}
+		}
+
+		if !dominated {
+			kept = append(kept, site)
+		}
+	}
+
+	return kept, nil
+}
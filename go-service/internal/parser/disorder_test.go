@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// disorderSite returns a site at the given fractional x with an occupancy,
+// disorder assembly and group
+func disorderSite(label string, x, occupancy float64, assembly, group string) types.AtomSite {
+	return types.AtomSite{Label: label, Element: "C", FractX: x, Occupancy: occupancy, DisorderAssembly: assembly, DisorderGroup: group}
+}
+
+func TestApplyDisorderPolicy(t *testing.T) {
+	ordered := []types.AtomSite{
+		disorderSite("O1", 0.5, 1, "", ""),
+		// Group 0 marks an ordered site, and an occupancy just below 1 is full
+		disorderSite("O2", 0.7, 0.9995, "", "0"),
+	}
+	groups := append(ordered,
+		disorderSite("C1A", 0.1, 0.6, "A", "1"),
+		disorderSite("C2A", 0.2, 0.6, "A", "1"),
+		disorderSite("C1B", 0.12, 0.4, "A", "2"),
+		disorderSite("N1A", 0.3, 0.5, "B", "1"),
+		disorderSite("N1B", 0.32, 0.5, "B", "2"),
+	)
+	// Partial occupancies without disorder groups: Na1 and K1 are 0.2
+	// Angstrom apart, Cl1 is an isolated vacancy
+	partial := append(ordered,
+		disorderSite("K1", 0.02, 0.3, "", ""),
+		disorderSite("Na1", 0, 0.7, "", ""),
+		disorderSite("Cl1", 0.9, 0.5, "", ""),
+	)
+
+	tests := []struct {
+		name   string
+		sites  []types.AtomSite
+		policy string
+		group  string
+		labels []string
+		err    string
+	}{
+		{
+			name:   "ordered structure is kept under reject",
+			sites:  ordered,
+			policy: DisorderPolicyReject,
+			labels: []string{"O1", "O2"},
+		},
+		{
+			name:   "reject disorder groups",
+			sites:  groups,
+			policy: DisorderPolicyReject,
+			err:    "5 sites with partial occupancy or disorder groups, e.g. C1A",
+		},
+		{
+			name:   "reject partial occupancy without a group",
+			sites:  partial,
+			policy: DisorderPolicyReject,
+			err:    "3 sites with partial occupancy or disorder groups, e.g. K1",
+		},
+		{
+			// Ties go to the group listed first
+			name:   "highest occupancy per assembly",
+			sites:  groups,
+			policy: DisorderPolicyHighestOccupancy,
+			labels: []string{"O1", "O2", "C1A", "C2A", "N1A"},
+		},
+		{
+			name:   "highest occupancy of overlapping sites without a group",
+			sites:  partial,
+			policy: DisorderPolicyHighestOccupancy,
+			labels: []string{"O1", "O2", "Na1", "Cl1"},
+		},
+		{
+			name:   "group",
+			sites:  groups,
+			policy: DisorderPolicyGroup,
+			group:  "2",
+			labels: []string{"O1", "O2", "C1B", "N1B"},
+		},
+		{
+			name:   "group with overlapping sites without a group",
+			sites:  append(append([]types.AtomSite(nil), groups...), partial[2:]...),
+			policy: DisorderPolicyGroup,
+			group:  "1",
+			labels: []string{"O1", "O2", "C1A", "C2A", "N1A", "Na1", "Cl1"},
+		},
+		{
+			name:   "group without a name",
+			sites:  groups,
+			policy: DisorderPolicyGroup,
+			err:    "requires a disorder group",
+		},
+		{
+			name:   "unknown group",
+			sites:  groups,
+			policy: DisorderPolicyGroup,
+			group:  "3",
+			err:    "disorder group 3 not found",
+		},
+		{
+			name:   "partial occupancy has no group to choose",
+			sites:  partial,
+			policy: DisorderPolicyGroup,
+			group:  "1",
+			err:    "disorder group 1 not found",
+		},
+		{
+			name:   "unknown policy",
+			sites:  groups,
+			policy: "average",
+			err:    "unknown disorder policy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cif := &types.CIFFile{DataBlock: cubicBlock(10, tt.sites)}
+			resolved, err := NewCIFParser().ApplyDisorderPolicy(cif, tt.policy, tt.group)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyDisorderPolicy: %v", err)
+			}
+
+			var labels []string
+			for _, site := range resolved.DataBlock.AtomSites {
+				labels = append(labels, site.Label)
+			}
+			if strings.Join(labels, " ") != strings.Join(tt.labels, " ") {
+				t.Errorf("got sites %v, want %v", labels, tt.labels)
+			}
+			if len(cif.DataBlock.AtomSites) != len(tt.sites) {
+				t.Errorf("the input structure was modified")
+			}
+		})
+	}
+}
+
+func TestApplyDisorderPolicyAnisoLoop(t *testing.T) {
+	block := cubicBlock(10, []types.AtomSite{
+		disorderSite("C1A", 0.1, 0.6, "", "1"),
+		disorderSite("C1B", 0.12, 0.4, "", "2"),
+	})
+	block.Loops = []types.CIFLoop{{
+		Tags: []string{"_atom_site_aniso_label", "_atom_site_aniso_U_11"},
+		Rows: [][]string{{"C1A", "0.01"}, {"C1B", "0.02"}},
+	}}
+
+	resolved, err := NewCIFParser().ApplyDisorderPolicy(&types.CIFFile{DataBlock: block}, DisorderPolicyHighestOccupancy, "")
+	if err != nil {
+		t.Fatalf("ApplyDisorderPolicy: %v", err)
+	}
+	if rows := resolved.DataBlock.Loops[0].Rows; len(rows) != 1 || rows[0][0] != "C1A" {
+		t.Errorf("got ADP rows %v, want only C1A", rows)
+	}
+	if len(block.Loops[0].Rows) != 2 {
+		t.Errorf("the input ADP loop was modified")
+	}
+}
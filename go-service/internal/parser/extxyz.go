@@ -0,0 +1,531 @@
+package parser
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/elements"
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// Structure file formats accepted as input or produced as output
+const (
+	FormatCIF    = "cif"
+	FormatExtXYZ = "extxyz"
+	FormatPOSCAR = "poscar"
+)
+
+// IsValidStructureFormat reports whether format names a known structure format
+func IsValidStructureFormat(format string) bool {
+	switch format {
+	case FormatCIF, FormatExtXYZ, FormatPOSCAR:
+		return true
+	}
+	return false
+}
+
+// ExtXYZProperty is a real-valued per-atom column of an extended XYZ frame,
+// e.g. forces (three columns) or charges (one column)
+type ExtXYZProperty struct {
+	Name   string
+	Values [][]float64 // One row per atom
+}
+
+// ExtXYZFrame is a single structure of an extended XYZ file
+type ExtXYZFrame struct {
+	Species    []string
+	Positions  [][3]float64   // Cartesian coordinates in Angstrom
+	Lattice    *[3][3]float64 // Lattice vectors as rows; nil for non-periodic structures
+	Info       []CIFItem      // Per-frame key=value pairs written to the comment line
+	Properties []ExtXYZProperty
+}
+
+// extxyzColumn is a column group declared in the Properties key
+type extxyzColumn struct {
+	name  string
+	kind  byte // 'S', 'R', 'I' or 'L'
+	count int
+}
+
+// ExtXYZParser reads extended XYZ files. Every frame becomes a data block so
+// that multi-frame files can be selected from and optimized in batch like
+// multi-block CIF files.
+type ExtXYZParser struct{}
+
+// NewExtXYZParser creates a new extended XYZ parser instance
+func NewExtXYZParser() *ExtXYZParser {
+	return &ExtXYZParser{}
+}
+
+// ParseFromBase64 parses an extended XYZ file from base64 encoded string
+func (p *ExtXYZParser) ParseFromBase64(base64Content string) (*types.CIFFile, error) {
+	decoded, err := base64.StdEncoding.DecodeString(base64Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 content: %v", err)
+	}
+
+	return p.ParseFromString(string(decoded))
+}
+
+// ParseFromString parses every frame of an extended XYZ file. Frames without
+// a Lattice, or with pbc="F F F", are read as non-periodic molecules; mixed
+// pbc values are rejected.
+func (p *ExtXYZParser) ParseFromString(content string) (*types.CIFFile, error) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	cif := &types.CIFFile{}
+	for i := 0; i < len(lines); {
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+
+		frame := len(cif.DataBlocks) + 1
+		count, err := strconv.Atoi(strings.TrimSpace(lines[i]))
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("frame %d: line %d: expected the number of atoms, got %q", frame, i+1, strings.TrimSpace(lines[i]))
+		}
+		if i+2+count > len(lines) {
+			return nil, fmt.Errorf("frame %d: expected %d atoms, file ends early", frame, count)
+		}
+
+		dataBlock, err := p.parseFrame(lines[i+1], lines[i+2:i+2+count], i+3)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %v", frame, err)
+		}
+		if dataBlock.Name == "" {
+			dataBlock.Name = fmt.Sprintf("frame_%d", frame)
+		}
+
+		cif.DataBlocks = append(cif.DataBlocks, *dataBlock)
+		i += 2 + count
+	}
+
+	if len(cif.DataBlocks) == 0 {
+		return nil, fmt.Errorf("no frame found in extended XYZ content")
+	}
+	cif.DataBlock = cif.DataBlocks[0]
+
+	return cif, nil
+}
+
+// parseFrame builds a data block from the comment line and atom lines of a
+// frame. firstLine is the file line number of the first atom line.
+func (p *ExtXYZParser) parseFrame(comment string, atomLines []string, firstLine int) (*types.CIFDataBlock, error) {
+	// A comment line without key=value pairs is a plain XYZ title
+	info, order := map[string]string{"comment": strings.TrimSpace(comment)}, []string{"comment"}
+	if strings.Contains(comment, "=") {
+		var err error
+		info, order, err = parseExtXYZInfo(comment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid comment line: %v", err)
+		}
+	} else if info["comment"] == "" {
+		order = nil
+	}
+
+	columns, err := parseExtXYZProperties(info["properties"])
+	if err != nil {
+		return nil, err
+	}
+
+	lattice, err := extxyzLattice(info)
+	if err != nil {
+		return nil, err
+	}
+
+	dataBlock := &types.CIFDataBlock{
+		Name:     sanitizeBlockName(info["name"]),
+		Metadata: make(map[string]string),
+	}
+
+	// Remaining per-frame information is kept as metadata
+	for _, key := range order {
+		switch key {
+		case "lattice", "properties", "pbc", "name":
+			continue
+		}
+		tag := "_extxyz_" + key
+		dataBlock.Metadata[tag] = info[key]
+		dataBlock.MetadataOrder = append(dataBlock.MetadataOrder, tag)
+	}
+
+	counts := make(map[string]int)
+	positions := make([][3]float64, 0, len(atomLines))
+	for n, line := range atomLines {
+		fields := strings.Fields(line)
+
+		species, pos, err := extxyzAtom(columns, fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", firstLine+n, err)
+		}
+
+		site := types.AtomSite{TypeSymbol: species, Occupancy: 1.0}
+		if element, err := elements.Resolve(species, ""); err == nil {
+			site.Element = element
+		}
+		counts[species]++
+		site.Label = fmt.Sprintf("%s%d", species, counts[species])
+
+		dataBlock.AtomSites = append(dataBlock.AtomSites, site)
+		positions = append(positions, pos)
+	}
+
+	if err := SetStructureFromCartesian(dataBlock, lattice, positions); err != nil {
+		return nil, fmt.Errorf("invalid lattice: %v", err)
+	}
+
+	return dataBlock, nil
+}
+
+// parseExtXYZInfo splits the comment line into key=value pairs. Keys are
+// case-insensitive and returned in lower case; values may be quoted with
+// double quotes or braces, and bare keys are flags with the value "T".
+func parseExtXYZInfo(comment string) (map[string]string, []string, error) {
+	info := make(map[string]string)
+	var order []string
+
+	s := strings.TrimSpace(comment)
+	for len(s) > 0 {
+		end := strings.IndexAny(s, "= \t")
+		if end < 0 {
+			end = len(s)
+		}
+		key := strings.ToLower(s[:end])
+		if key == "" {
+			return nil, nil, fmt.Errorf("missing key before %q", s)
+		}
+		s = strings.TrimLeft(s[end:], " \t")
+
+		value := "T"
+		if strings.HasPrefix(s, "=") {
+			s = strings.TrimLeft(s[1:], " \t")
+
+			var err error
+			value, s, err = scanExtXYZValue(s)
+			if err != nil {
+				return nil, nil, fmt.Errorf("key %s: %v", key, err)
+			}
+		}
+
+		if _, ok := info[key]; !ok {
+			order = append(order, key)
+		}
+		info[key] = value
+		s = strings.TrimLeft(s, " \t")
+	}
+
+	return info, order, nil
+}
+
+// scanExtXYZValue reads one value from the start of s and returns it with the
+// rest of the line
+func scanExtXYZValue(s string) (string, string, error) {
+	if s == "" {
+		return "", "", fmt.Errorf("missing value")
+	}
+
+	switch s[0] {
+	case '"':
+		var value strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch {
+			case s[i] == '\\' && i+1 < len(s):
+				i++
+				value.WriteByte(s[i])
+			case s[i] == '"':
+				return value.String(), s[i+1:], nil
+			default:
+				value.WriteByte(s[i])
+			}
+		}
+		return "", "", fmt.Errorf("unterminated quoted value")
+	case '{':
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated braced value")
+		}
+		return s[1:end], s[end+1:], nil
+	}
+
+	end := strings.IndexAny(s, " \t")
+	if end < 0 {
+		end = len(s)
+	}
+	return s[:end], s[end:], nil
+}
+
+// parseExtXYZProperties parses a Properties value such as
+// "species:S:1:pos:R:3:forces:R:3". Without one, plain XYZ columns are assumed.
+func parseExtXYZProperties(value string) ([]extxyzColumn, error) {
+	if value == "" {
+		value = "species:S:1:pos:R:3"
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts)%3 != 0 {
+		return nil, fmt.Errorf("invalid Properties %q: expected name:type:count triples", value)
+	}
+
+	var columns []extxyzColumn
+	hasSpecies, hasPos := false, false
+	for i := 0; i < len(parts); i += 3 {
+		count, err := strconv.Atoi(parts[i+2])
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid Properties %q: bad column count %q", value, parts[i+2])
+		}
+		kind := strings.ToUpper(parts[i+1])
+		if len(kind) != 1 || !strings.Contains("SRIL", kind) {
+			return nil, fmt.Errorf("invalid Properties %q: unknown column type %q", value, parts[i+1])
+		}
+
+		column := extxyzColumn{name: strings.ToLower(parts[i]), kind: kind[0], count: count}
+		switch column.name {
+		case "species", "z":
+			hasSpecies = true
+		case "pos":
+			if column.kind != 'R' || column.count != 3 {
+				return nil, fmt.Errorf("invalid Properties %q: pos must be R:3", value)
+			}
+			hasPos = true
+		}
+		columns = append(columns, column)
+	}
+
+	if !hasSpecies || !hasPos {
+		return nil, fmt.Errorf("Properties %q must declare species (or Z) and pos columns", value)
+	}
+
+	return columns, nil
+}
+
+// extxyzAtom reads the species and Cartesian position of an atom line
+func extxyzAtom(columns []extxyzColumn, fields []string) (string, [3]float64, error) {
+	var species, number string
+	var pos [3]float64
+
+	col := 0
+	for _, column := range columns {
+		if col+column.count > len(fields) {
+			return "", pos, fmt.Errorf("expected %d columns, got %d", extxyzWidth(columns), len(fields))
+		}
+
+		switch column.name {
+		case "species":
+			species = fields[col]
+		case "z":
+			number = fields[col]
+		case "pos":
+			for k := 0; k < 3; k++ {
+				val, err := strconv.ParseFloat(fields[col+k], 64)
+				if err != nil {
+					return "", pos, fmt.Errorf("invalid coordinate %q", fields[col+k])
+				}
+				pos[k] = val
+			}
+		}
+		col += column.count
+	}
+
+	if species == "" {
+		z, err := strconv.Atoi(number)
+		if err != nil {
+			return "", pos, fmt.Errorf("invalid atomic number %q", number)
+		}
+		element, ok := elements.ByNumber(z)
+		if !ok {
+			return "", pos, fmt.Errorf("unknown atomic number %d", z)
+		}
+		species = element.Symbol
+	}
+
+	return species, pos, nil
+}
+
+// extxyzWidth returns the number of columns of an atom line
+func extxyzWidth(columns []extxyzColumn) int {
+	width := 0
+	for _, column := range columns {
+		width += column.count
+	}
+	return width
+}
+
+// extxyzLattice returns the lattice of a frame, or nil when the frame is
+// non-periodic
+func extxyzLattice(info map[string]string) (*[3][3]float64, error) {
+	value, ok := info["lattice"]
+	if !ok {
+		return nil, nil
+	}
+
+	if pbc, ok := info["pbc"]; ok {
+		periodic, err := extxyzPBC(pbc)
+		if err != nil {
+			return nil, err
+		}
+		if !periodic {
+			return nil, nil
+		}
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) != 9 {
+		return nil, fmt.Errorf("Lattice must have 9 components, got %d", len(fields))
+	}
+
+	var lattice [3][3]float64
+	for i, field := range fields {
+		val, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Lattice component %q", field)
+		}
+		lattice[i/3][i%3] = val
+	}
+
+	return &lattice, nil
+}
+
+// extxyzPBC reports whether a pbc value such as "T T T" is fully periodic.
+// DFTB+ geometries are either periodic in three dimensions or not at all, so
+// mixed values such as the slab setting "T T F" are rejected.
+func extxyzPBC(value string) (bool, error) {
+	flags := strings.Fields(value)
+	if len(flags) != 3 {
+		return false, fmt.Errorf("pbc must have 3 components, got %q", value)
+	}
+
+	periodic := 0
+	for _, flag := range flags {
+		switch strings.ToLower(flag) {
+		case "t", "true":
+			periodic++
+		case "f", "false":
+		default:
+			return false, fmt.Errorf("invalid pbc component %q", flag)
+		}
+	}
+	if periodic != 0 && periodic != 3 {
+		return false, fmt.Errorf("pbc=%q mixes periodic and non-periodic directions; use \"T T T\" with a vacuum gap for slabs and wires, or \"F F F\" for molecules", value)
+	}
+
+	return periodic == 3, nil
+}
+
+// sanitizeBlockName makes a frame name usable as a CIF data block name
+func sanitizeBlockName(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// ExtXYZWriter serializes structures in extended XYZ format
+type ExtXYZWriter struct{}
+
+// NewExtXYZWriter creates a new extended XYZ writer instance
+func NewExtXYZWriter() *ExtXYZWriter {
+	return &ExtXYZWriter{}
+}
+
+// FrameFromCIF builds an extended XYZ frame from the selected data block of
+// a CIF. Lattice and positions keep the orientation and origin the structure
+// was read with; non-periodic structures are written without a lattice.
+func (w *ExtXYZWriter) FrameFromCIF(cif *types.CIFFile) (*ExtXYZFrame, error) {
+	if cif == nil {
+		return nil, fmt.Errorf("invalid CIF file")
+	}
+
+	lattice, err := LatticeFromDataBlock(&cif.DataBlock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cell parameters: %v", err)
+	}
+
+	frame := &ExtXYZFrame{}
+	if !cif.DataBlock.NonPeriodic {
+		frame.Lattice = &lattice
+	}
+
+	for _, site := range cif.DataBlock.AtomSites {
+		if site.Element == "" {
+			return nil, fmt.Errorf("atom site %s has no known element", site.Label)
+		}
+		frame.Species = append(frame.Species, site.Element)
+		frame.Positions = append(frame.Positions, SiteCartesian(&cif.DataBlock, lattice, site))
+	}
+
+	return frame, nil
+}
+
+// Write serializes one or more frames. Every frame declares its Properties
+// so that the per-atom columns can be read back by any extxyz reader.
+func (w *ExtXYZWriter) Write(frames ...*ExtXYZFrame) (string, error) {
+	var content strings.Builder
+
+	for n, frame := range frames {
+		if len(frame.Positions) != len(frame.Species) {
+			return "", fmt.Errorf("frame %d: %d positions for %d species", n+1, len(frame.Positions), len(frame.Species))
+		}
+
+		columns := "species:S:1:pos:R:3"
+		for _, property := range frame.Properties {
+			if len(property.Values) != len(frame.Species) {
+				return "", fmt.Errorf("frame %d: property %s has %d rows for %d atoms", n+1, property.Name, len(property.Values), len(frame.Species))
+			}
+			width := 0
+			if len(property.Values) > 0 {
+				width = len(property.Values[0])
+			}
+			for _, row := range property.Values {
+				if len(row) != width || width == 0 {
+					return "", fmt.Errorf("frame %d: property %s has rows of different widths", n+1, property.Name)
+				}
+			}
+			columns += fmt.Sprintf(":%s:R:%d", property.Name, width)
+		}
+
+		var header []string
+		if frame.Lattice != nil {
+			var components []string
+			for _, vector := range frame.Lattice {
+				for _, val := range vector {
+					components = append(components, strconv.FormatFloat(val, 'f', 8, 64))
+				}
+			}
+			header = append(header, "Lattice=\""+strings.Join(components, " ")+"\"")
+		}
+		header = append(header, "Properties="+columns)
+		for _, item := range frame.Info {
+			header = append(header, item.Tag+"="+formatExtXYZValue(item.Value))
+		}
+		if frame.Lattice != nil {
+			header = append(header, "pbc=\"T T T\"")
+		} else {
+			header = append(header, "pbc=\"F F F\"")
+		}
+
+		content.WriteString(strconv.Itoa(len(frame.Species)) + "\n")
+		content.WriteString(strings.Join(header, " ") + "\n")
+
+		for i, species := range frame.Species {
+			pos := frame.Positions[i]
+			line := fmt.Sprintf("%-3s %16.8f %16.8f %16.8f", species, pos[0], pos[1], pos[2])
+			for _, property := range frame.Properties {
+				for _, val := range property.Values[i] {
+					line += fmt.Sprintf(" %16.8f", val)
+				}
+			}
+			content.WriteString(line + "\n")
+		}
+	}
+
+	return content.String(), nil
+}
+
+// formatExtXYZValue quotes a comment line value when it contains whitespace
+// or characters that would end a bare value
+func formatExtXYZValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\"=") {
+		return value
+	}
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
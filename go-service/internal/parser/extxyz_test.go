@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExtXYZPBC(t *testing.T) {
+	tests := []struct {
+		pbc         string
+		nonPeriodic bool
+		err         string
+	}{
+		{pbc: "T T T"},
+		{pbc: "True true TRUE"},
+		{pbc: "F F F", nonPeriodic: true},
+		{pbc: "T T F", err: "mixes periodic and non-periodic"},
+		{pbc: "F F T", err: "mixes periodic and non-periodic"},
+		{pbc: "T T", err: "3 components"},
+		{pbc: "T T X", err: "invalid pbc component"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pbc, func(t *testing.T) {
+			content := "2\nLattice=\"5 0 0 0 5 0 0 0 5\" Properties=species:S:1:pos:R:3 pbc=\"" + tt.pbc + "\"\n" +
+				"H 0 0 0\nH 0.74 0 0\n"
+			cif, err := NewExtXYZParser().ParseFromString(content)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFromString: %v", err)
+			}
+			if cif.DataBlock.NonPeriodic != tt.nonPeriodic {
+				t.Errorf("NonPeriodic = %v, want %v", cif.DataBlock.NonPeriodic, tt.nonPeriodic)
+			}
+		})
+	}
+}
+
+func TestExtXYZRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			// The first lattice vector does not lie along x
+			name: "rotated cell",
+			content: "2\nLattice=\"0 2.1 2.1 2.1 0 2.1 2.1 2.1 0\" Properties=species:S:1:pos:R:3 pbc=\"T T T\"\n" +
+				"Mg 0 0 0\nO 2.1 2.1 2.1\n",
+		},
+		{
+			name: "molecule away from the origin",
+			content: "3\nProperties=species:S:1:pos:R:3\n" +
+				"O -4.000 12.500 0.119\nH -4.000 13.263 -0.477\nH -4.000 11.737 -0.477\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, writer := NewExtXYZParser(), NewExtXYZWriter()
+
+			cif, err := reader.ParseFromString(tt.content)
+			if err != nil {
+				t.Fatalf("ParseFromString: %v", err)
+			}
+			frame, err := writer.FrameFromCIF(cif)
+			if err != nil {
+				t.Fatalf("FrameFromCIF: %v", err)
+			}
+			content, err := writer.Write(frame)
+			if err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			// Compare the written file with the input line by line
+			want := strings.Split(strings.TrimSpace(tt.content), "\n")
+			got := strings.Split(strings.TrimSpace(content), "\n")
+			if len(got) != len(want) {
+				t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), content)
+			}
+			if lattice := extxyzTestLattice(want[1]); lattice != "" && !strings.Contains(got[1], lattice) {
+				t.Errorf("lattice not kept: got %s, want %s", got[1], lattice)
+			}
+			for i := 2; i < len(want); i++ {
+				wantFields, gotFields := strings.Fields(want[i]), strings.Fields(got[i])
+				if gotFields[0] != wantFields[0] {
+					t.Errorf("line %d: got species %s, want %s", i+1, gotFields[0], wantFields[0])
+				}
+				for k := 1; k <= 3; k++ {
+					g, _ := strconv.ParseFloat(gotFields[k], 64)
+					w, _ := strconv.ParseFloat(wantFields[k], 64)
+					if !approxEqual(g, w, 1e-8) {
+						t.Errorf("line %d: got %v, want %v", i+1, gotFields[1:4], wantFields[1:4])
+						break
+					}
+				}
+			}
+
+			// Reading the written file gives the same structure
+			again, err := reader.ParseFromString(content)
+			if err != nil {
+				t.Fatalf("failed to read the written file: %v\n%s", err, content)
+			}
+			if again.DataBlock.NonPeriodic != cif.DataBlock.NonPeriodic {
+				t.Errorf("periodicity changed on the round trip")
+			}
+		})
+	}
+}
+
+// extxyzTestLattice returns the Lattice value of a comment line written with
+// eight decimals, or "" when the line has no lattice
+func extxyzTestLattice(comment string) string {
+	start := strings.Index(comment, "Lattice=\"")
+	if start < 0 {
+		return ""
+	}
+	rest := comment[start+len("Lattice=\""):]
+	var components []string
+	for _, field := range strings.Fields(rest[:strings.Index(rest, "\"")]) {
+		val, _ := strconv.ParseFloat(field, 64)
+		components = append(components, strconv.FormatFloat(val, 'f', 8, 64))
+	}
+	return "Lattice=\"" + strings.Join(components, " ") + "\""
+}
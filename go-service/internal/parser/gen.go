@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// DFTB+ gen format geometry types
+const (
+	GenCluster    = "C" // Non-periodic, Cartesian coordinates
+	GenSupercell  = "S" // Periodic, Cartesian coordinates
+	GenFractional = "F" // Periodic, fractional coordinates
+)
+
+// GenWriter serializes DFTB+ geometries in gen format
+type GenWriter struct{}
+
+// NewGenWriter creates a new gen format writer instance
+func NewGenWriter() *GenWriter {
+	return &GenWriter{}
+}
+
+// Write serializes a geometry in the given gen mode. Species indices are
+// written 1-based; periodic modes end with the origin and lattice vectors.
+func (w *GenWriter) Write(geometry *types.DFTBGeometry, mode string) (string, error) {
+	switch mode {
+	case GenCluster:
+		if geometry.Periodic {
+			return "", fmt.Errorf("gen mode %s cannot describe a periodic geometry", mode)
+		}
+	case GenSupercell, GenFractional:
+		if !geometry.Periodic {
+			return "", fmt.Errorf("gen mode %s requires a periodic geometry", mode)
+		}
+	default:
+		return "", fmt.Errorf("unknown gen mode %q", mode)
+	}
+
+	if len(geometry.Species) != len(geometry.Coordinates) {
+		return "", fmt.Errorf("%d species for %d atoms", len(geometry.Species), len(geometry.Coordinates))
+	}
+	if len(geometry.Coordinates) == 0 {
+		return "", fmt.Errorf("geometry has no atoms")
+	}
+
+	var inverse [3][3]float64
+	if mode == GenFractional {
+		var err error
+		inverse, err = InvertLattice(geometry.LatticeVectors)
+		if err != nil {
+			return "", fmt.Errorf("invalid lattice vectors: %v", err)
+		}
+	}
+
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf("%d %s\n", len(geometry.Coordinates), mode))
+	content.WriteString(strings.Join(geometry.Elements, " ") + "\n")
+
+	for i, coord := range geometry.Coordinates {
+		species := geometry.Species[i]
+		if species < 0 || species >= len(geometry.Elements) {
+			return "", fmt.Errorf("atom %d: species index %d out of range", i+1, species)
+		}
+		if len(coord) != 3 {
+			return "", fmt.Errorf("atom %d: expected 3 coordinates, got %d", i+1, len(coord))
+		}
+
+		pos := [3]float64{coord[0], coord[1], coord[2]}
+		if mode == GenFractional {
+			pos = CartesianToFractional(inverse, [3]float64{pos[0] - geometry.Origin[0], pos[1] - geometry.Origin[1], pos[2] - geometry.Origin[2]})
+		}
+		content.WriteString(fmt.Sprintf("%5d %3d %18.10f %18.10f %18.10f\n", i+1, species+1, pos[0], pos[1], pos[2]))
+	}
+
+	if mode != GenCluster {
+		origin := geometry.Origin
+		content.WriteString(fmt.Sprintf("%18.10f %18.10f %18.10f\n", origin[0], origin[1], origin[2]))
+		for _, vector := range geometry.LatticeVectors {
+			content.WriteString(fmt.Sprintf("%18.10f %18.10f %18.10f\n", vector[0], vector[1], vector[2]))
+		}
+	}
+
+	return content.String(), nil
+}
+
+// GenParser reads DFTB+ geometry files such as geo_end.gen and geo_end.xyz
+type GenParser struct{}
+
+// NewGenParser creates a new gen format parser instance
+func NewGenParser() *GenParser {
+	return &GenParser{}
+}
+
+// ParseFromString parses a gen format geometry. Comments starting with '#'
+// are ignored. Fractional coordinates are converted to Cartesian ones.
+func (p *GenParser) ParseFromString(content string) (*types.DFTBGeometry, error) {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("gen content is too short")
+	}
+
+	header := strings.Fields(lines[0])
+	if len(header) != 2 {
+		return nil, fmt.Errorf("invalid gen header %q", strings.TrimSpace(lines[0]))
+	}
+	count, err := strconv.Atoi(header[0])
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("invalid number of atoms %q", header[0])
+	}
+	mode := strings.ToUpper(header[1])
+
+	geometry := &types.DFTBGeometry{Elements: strings.Fields(lines[1])}
+	switch mode {
+	case GenCluster:
+	case GenSupercell, GenFractional:
+		geometry.Periodic = true
+	default:
+		return nil, fmt.Errorf("unsupported gen mode %q", header[1])
+	}
+
+	needed := 2 + count
+	if geometry.Periodic {
+		needed += 4
+	}
+	if len(lines) < needed {
+		return nil, fmt.Errorf("expected %d lines, got %d", needed, len(lines))
+	}
+
+	positions := make([][3]float64, count)
+	for i := 0; i < count; i++ {
+		fields := strings.Fields(lines[2+i])
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("atom %d: expected index, species and three coordinates", i+1)
+		}
+		species, err := strconv.Atoi(fields[1])
+		if err != nil || species < 1 || species > len(geometry.Elements) {
+			return nil, fmt.Errorf("atom %d: invalid species index %q", i+1, fields[1])
+		}
+		geometry.Species = append(geometry.Species, species-1)
+
+		if positions[i], err = parseVector(fields[2:5]); err != nil {
+			return nil, fmt.Errorf("atom %d: %v", i+1, err)
+		}
+	}
+
+	if geometry.Periodic {
+		if geometry.Origin, err = parseVector(strings.Fields(lines[2+count])); err != nil {
+			return nil, fmt.Errorf("origin: %v", err)
+		}
+		for k := 0; k < 3; k++ {
+			if geometry.LatticeVectors[k], err = parseVector(strings.Fields(lines[3+count+k])); err != nil {
+				return nil, fmt.Errorf("lattice vector %d: %v", k+1, err)
+			}
+		}
+	}
+
+	for _, pos := range positions {
+		if mode == GenFractional {
+			pos = FractionalToCartesian(geometry.LatticeVectors, pos)
+			pos = [3]float64{pos[0] + geometry.Origin[0], pos[1] + geometry.Origin[1], pos[2] + geometry.Origin[2]}
+		}
+		geometry.Coordinates = append(geometry.Coordinates, []float64{pos[0], pos[1], pos[2]})
+	}
+
+	return geometry, nil
+}
+
+// ParseXYZFrames parses every frame of an XYZ file written by DFTB+, such as
+// geo_end.xyz. Columns after the coordinates (charges, velocities) are
+// ignored, and the geometries are returned as non-periodic.
+func (p *GenParser) ParseXYZFrames(content string) ([]*types.DFTBGeometry, error) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var frames []*types.DFTBGeometry
+	for i := 0; i < len(lines); {
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(lines[i]))
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("line %d: expected the number of atoms, got %q", i+1, strings.TrimSpace(lines[i]))
+		}
+		if i+2+count > len(lines) {
+			return nil, fmt.Errorf("frame %d: expected %d atoms, file ends early", len(frames)+1, count)
+		}
+
+		geometry := &types.DFTBGeometry{}
+		index := make(map[string]int)
+		for n, line := range lines[i+2 : i+2+count] {
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: expected an element and three coordinates", i+3+n)
+			}
+			pos, err := parseVector(fields[1:4])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+3+n, err)
+			}
+
+			if _, ok := index[fields[0]]; !ok {
+				index[fields[0]] = len(geometry.Elements)
+				geometry.Elements = append(geometry.Elements, fields[0])
+			}
+			geometry.Species = append(geometry.Species, index[fields[0]])
+			geometry.Coordinates = append(geometry.Coordinates, []float64{pos[0], pos[1], pos[2]})
+		}
+
+		frames = append(frames, geometry)
+		i += 2 + count
+	}
+
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frame found in XYZ content")
+	}
+
+	return frames, nil
+}
+
+// ParseXYZ parses the last frame of an XYZ file written by DFTB+
+func (p *GenParser) ParseXYZ(content string) (*types.DFTBGeometry, error) {
+	frames, err := p.ParseXYZFrames(content)
+	if err != nil {
+		return nil, err
+	}
+	return frames[len(frames)-1], nil
+}
+
+// parseVector parses three floating point fields
+func parseVector(fields []string) ([3]float64, error) {
+	var vector [3]float64
+	if len(fields) < 3 {
+		return vector, fmt.Errorf("expected three components, got %d", len(fields))
+	}
+	for k := 0; k < 3; k++ {
+		val, err := strconv.ParseFloat(fields[k], 64)
+		if err != nil {
+			return vector, fmt.Errorf("invalid number %q", fields[k])
+		}
+		vector[k] = val
+	}
+	return vector, nil
+}
@@ -0,0 +1,278 @@
+package parser
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// waterGeometry lists oxygen second so that species indices differ from
+// atom order
+func waterGeometry() *types.DFTBGeometry {
+	return &types.DFTBGeometry{
+		Elements:    []string{"H", "O"},
+		Species:     []int{0, 1, 0},
+		Coordinates: [][]float64{{0.7572, 0.5865, 0}, {0, 0, 0}, {-0.7572, 0.5865, 0}},
+	}
+}
+
+// hexagonalGeometry is a shifted hexagonal cell whose first lattice vector
+// does not lie along x
+func hexagonalGeometry() *types.DFTBGeometry {
+	return &types.DFTBGeometry{
+		Elements:       []string{"B", "N"},
+		Species:        []int{0, 1},
+		Coordinates:    [][]float64{{1, 1, 1}, {1 + 1.25, 1 + 1.25/1.7320508075688772, 2.5}},
+		Periodic:       true,
+		Origin:         [3]float64{1, 1, 1},
+		LatticeVectors: [3][3]float64{{1.25, -2.1650635094610964, 0}, {1.25, 2.1650635094610964, 0}, {0, 0, 3}},
+	}
+}
+
+func TestGenWriterGolden(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry *types.DFTBGeometry
+		mode     string
+	}{
+		{"cluster", waterGeometry(), GenCluster},
+		{"supercell", hexagonalGeometry(), GenSupercell},
+		{"fractional", hexagonalGeometry(), GenFractional},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewGenWriter().Write(tt.geometry, tt.mode)
+			if err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "golden", tt.name+".gen")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatalf("failed to update %s: %v", golden, err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read %s (run with -update to create it): %v", golden, err)
+			}
+			if got != string(want) {
+				t.Errorf("gen output differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestGenWriterErrors(t *testing.T) {
+	mismatched := waterGeometry()
+	mismatched.Species = mismatched.Species[:2]
+	outOfRange := waterGeometry()
+	outOfRange.Species[2] = 2
+	singular := hexagonalGeometry()
+	singular.LatticeVectors[2] = singular.LatticeVectors[0]
+
+	tests := []struct {
+		name     string
+		geometry *types.DFTBGeometry
+		mode     string
+		err      string
+	}{
+		{"periodic cluster", hexagonalGeometry(), GenCluster, "cannot describe a periodic geometry"},
+		{"molecule supercell", waterGeometry(), GenSupercell, "requires a periodic geometry"},
+		{"unknown mode", waterGeometry(), "X", "unknown gen mode"},
+		{"species count", mismatched, GenCluster, "2 species for 3 atoms"},
+		{"no atoms", &types.DFTBGeometry{}, GenCluster, "no atoms"},
+		{"species out of range", outOfRange, GenCluster, "atom 3: species index 2 out of range"},
+		{"singular lattice", singular, GenFractional, "invalid lattice vectors"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGenWriter().Write(tt.geometry, tt.mode)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// relaxedGeoEnd is a geo_end.gen as written by DFTB+ after a variable-cell
+// run: fractional coordinates in a strained, shifted cell
+const relaxedGeoEnd = `    2  F
+  Si
+    1 1    0.0000000000E+00    0.0000000000E+00    0.0000000000E+00
+    2 1    0.2500000000E+00    0.2500000000E+00    0.2500000000E+00
+    0.1000000000E+00    0.0000000000E+00    0.0000000000E+00
+    0.0000000000E+00    0.2800000000E+01    0.2800000000E+01
+    0.2800000000E+01    0.0000000000E+00    0.2800000000E+01
+    0.2800000000E+01    0.2800000000E+01    0.0000000000E+00
+`
+
+func TestGenParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		elements    []string
+		species     []int
+		coordinates [][]float64
+		periodic    bool
+		origin      [3]float64
+		lattice     [3][3]float64
+	}{
+		{
+			name:        "relaxed lattice in fractional coordinates",
+			content:     relaxedGeoEnd,
+			elements:    []string{"Si"},
+			species:     []int{0, 0},
+			coordinates: [][]float64{{0.1, 0, 0}, {1.5, 1.4, 1.4}},
+			periodic:    true,
+			origin:      [3]float64{0.1, 0, 0},
+			lattice:     [3][3]float64{{0, 2.8, 2.8}, {2.8, 0, 2.8}, {2.8, 2.8, 0}},
+		},
+		{
+			name:        "supercell with comments",
+			content:     "# geo_end.gen\n1 s\nNa\n\n1 1 0.5 0.5 0.5 # centre\n0 0 0\n4 0 0\n0 4 0\n0 0 4\n",
+			elements:    []string{"Na"},
+			species:     []int{0},
+			coordinates: [][]float64{{0.5, 0.5, 0.5}},
+			periodic:    true,
+			lattice:     [3][3]float64{{4, 0, 0}, {0, 4, 0}, {0, 0, 4}},
+		},
+		{
+			name:        "cluster",
+			content:     "2 C\nO H\n1 2 0 0 0.1\n2 1 0 0 -0.9\n",
+			elements:    []string{"O", "H"},
+			species:     []int{1, 0},
+			coordinates: [][]float64{{0, 0, 0.1}, {0, 0, -0.9}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			geometry, err := NewGenParser().ParseFromString(tt.content)
+			if err != nil {
+				t.Fatalf("ParseFromString: %v", err)
+			}
+			if !reflect.DeepEqual(geometry.Elements, tt.elements) || !reflect.DeepEqual(geometry.Species, tt.species) {
+				t.Errorf("got elements %v and species %v, want %v and %v", geometry.Elements, geometry.Species, tt.elements, tt.species)
+			}
+			if geometry.Periodic != tt.periodic || geometry.Origin != tt.origin || geometry.LatticeVectors != tt.lattice {
+				t.Errorf("got periodic %v, origin %v and lattice %v, want %v, %v and %v",
+					geometry.Periodic, geometry.Origin, geometry.LatticeVectors, tt.periodic, tt.origin, tt.lattice)
+			}
+			if len(geometry.Coordinates) != len(tt.coordinates) {
+				t.Fatalf("got %d atoms, want %d", len(geometry.Coordinates), len(tt.coordinates))
+			}
+			for i, coord := range geometry.Coordinates {
+				for k := 0; k < 3; k++ {
+					if !approxEqual(coord[k], tt.coordinates[i][k], 1e-9) {
+						t.Errorf("atom %d: got %v, want %v", i+1, coord, tt.coordinates[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"too short", "1 C\n", "too short"},
+		{"invalid header", "1\nH\n", "invalid gen header"},
+		{"invalid count", "0 C\nH\n", "invalid number of atoms"},
+		{"invalid mode", "1 H\nH\n1 1 0 0 0\n", "unsupported gen mode"},
+		{"missing lattice", "1 S\nH\n1 1 0 0 0\n0 0 0\n", "expected 7 lines, got 4"},
+		{"invalid species", "1 C\nH\n1 2 0 0 0\n", "atom 1: invalid species index"},
+		{"invalid coordinate", "1 C\nH\n1 1 0 x 0\n", "atom 1: invalid number"},
+		{"invalid lattice vector", "1 F\nH\n1 1 0 0 0\n0 0 0\n1 0 0\n0 1\n0 0 1\n", "lattice vector 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGenParser().ParseFromString(tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestGenRoundTrip(t *testing.T) {
+	for _, mode := range []string{GenSupercell, GenFractional} {
+		original := hexagonalGeometry()
+		content, err := NewGenWriter().Write(original, mode)
+		if err != nil {
+			t.Fatalf("%s: Write: %v", mode, err)
+		}
+		geometry, err := NewGenParser().ParseFromString(content)
+		if err != nil {
+			t.Fatalf("%s: ParseFromString: %v", mode, err)
+		}
+		for i, coord := range geometry.Coordinates {
+			for k := 0; k < 3; k++ {
+				if !approxEqual(coord[k], original.Coordinates[i][k], 1e-9) {
+					t.Errorf("%s: atom %d: got %v, want %v", mode, i+1, coord, original.Coordinates[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+// geoEndXYZ is a geo_end.xyz with two frames and the charge and velocity
+// columns DFTB+ appends
+const geoEndXYZ = `    3
+Geometry Step: 0
+    O    0.00000000    0.00000000    0.11700000   -0.59
+    H    0.00000000    0.75700000   -0.46800000    0.29
+    H    0.00000000   -0.75700000   -0.46800000    0.30
+    3
+Geometry Step: 4
+    O    0.00000000    0.00000000    0.12000000   -0.60    0.0 0.0 0.0
+    H    0.00000000    0.76500000   -0.47000000    0.30    0.0 0.0 0.0
+    H    0.00000000   -0.76500000   -0.47000000    0.30    0.0 0.0 0.0
+
+`
+
+func TestParseXYZFrames(t *testing.T) {
+	frames, err := NewGenParser().ParseXYZFrames(geoEndXYZ)
+	if err != nil {
+		t.Fatalf("ParseXYZFrames: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	for _, frame := range frames {
+		if !reflect.DeepEqual(frame.Elements, []string{"O", "H"}) || !reflect.DeepEqual(frame.Species, []int{0, 1, 1}) || frame.Periodic {
+			t.Errorf("got elements %v, species %v and periodic %v", frame.Elements, frame.Species, frame.Periodic)
+		}
+	}
+
+	last, err := NewGenParser().ParseXYZ(geoEndXYZ)
+	if err != nil {
+		t.Fatalf("ParseXYZ: %v", err)
+	}
+	if want := [][]float64{{0, 0, 0.12}, {0, 0.765, -0.47}, {0, -0.765, -0.47}}; !reflect.DeepEqual(last.Coordinates, want) {
+		t.Errorf("last frame: got %v, want %v", last.Coordinates, want)
+	}
+
+	for content, want := range map[string]string{
+		"":                        "no frame found",
+		"x\ncomment\n":            "expected the number of atoms",
+		"2\ncomment\nO 0 0 0":     "file ends early",
+		"1\ncomment\nO 0 0\n":     "expected an element and three coordinates",
+		"1\ncomment\nO 0 0 x\n\n": "invalid number",
+	} {
+		if _, err := NewGenParser().ParseXYZFrames(content); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want one containing %q", content, err, want)
+		}
+	}
+}
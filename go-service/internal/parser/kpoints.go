@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// K-point sampling schemes
+const (
+	KPointSchemeMonkhorstPack    = "monkhorst_pack"    // Shifted by half a step along even axes
+	KPointSchemeSupercellFolding = "supercell_folding" // Gamma-centred unless a shift is given
+	KPointSchemeGamma            = "gamma"             // The Gamma point only
+)
+
+// DefaultKPointSpacing is the largest distance between k-points along a
+// reciprocal lattice vector, in 1/Angstrom including the factor 2π
+const DefaultKPointSpacing = 0.3
+
+// IsValidKPointScheme reports whether a k-point scheme is supported
+func IsValidKPointScheme(scheme string) bool {
+	switch scheme {
+	case KPointSchemeMonkhorstPack, KPointSchemeSupercellFolding, KPointSchemeGamma:
+		return true
+	}
+	return false
+}
+
+// GenerateKPoints derives a k-point grid for a lattice. An explicit grid in
+// the settings is used as given; otherwise every axis gets enough points for
+// the reciprocal lattice vector length divided by the spacing. nil settings
+// select a Monkhorst-Pack grid at the default spacing.
+func GenerateKPoints(lattice [3][3]float64, settings *types.KPointSettings) (*types.KPointSampling, error) {
+	if settings == nil {
+		settings = &types.KPointSettings{}
+	}
+
+	sampling := &types.KPointSampling{Scheme: settings.Scheme}
+	if sampling.Scheme == "" {
+		sampling.Scheme = KPointSchemeMonkhorstPack
+	}
+	if !IsValidKPointScheme(sampling.Scheme) {
+		return nil, fmt.Errorf("invalid k-point scheme: %s", sampling.Scheme)
+	}
+
+	switch {
+	case sampling.Scheme == KPointSchemeGamma:
+		if settings.Grid != nil || settings.Spacing != 0 || settings.Shift != nil {
+			return nil, fmt.Errorf("the %s scheme takes no grid, spacing or shift", KPointSchemeGamma)
+		}
+		sampling.Grid = [3]int{1, 1, 1}
+	case settings.Grid != nil:
+		for k, n := range settings.Grid {
+			if n < 1 {
+				return nil, fmt.Errorf("k-point grid must be positive along every axis")
+			}
+			sampling.Grid[k] = n
+		}
+	default:
+		sampling.SpacingPerA = settings.Spacing
+		if sampling.SpacingPerA == 0 {
+			sampling.SpacingPerA = DefaultKPointSpacing
+		}
+		if sampling.SpacingPerA < 0 {
+			return nil, fmt.Errorf("k-point spacing must be positive")
+		}
+		spacings, err := PlaneSpacings(lattice)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lattice vectors: %v", err)
+		}
+		for k := 0; k < 3; k++ {
+			reciprocal := 2 * math.Pi / spacings[k]
+			sampling.Grid[k] = int(math.Max(1, math.Ceil(reciprocal/sampling.SpacingPerA-1e-6)))
+		}
+	}
+
+	switch sampling.Scheme {
+	case KPointSchemeMonkhorstPack:
+		if settings.Shift != nil {
+			return nil, fmt.Errorf("a k-point shift requires the %s scheme", KPointSchemeSupercellFolding)
+		}
+		for k, n := range sampling.Grid {
+			if n%2 == 0 {
+				sampling.Shift[k] = 0.5
+			}
+		}
+	case KPointSchemeSupercellFolding:
+		if settings.Shift != nil {
+			for k, shift := range settings.Shift {
+				if shift < 0 || shift >= 1 {
+					return nil, fmt.Errorf("k-point shifts must lie in [0, 1)")
+				}
+				sampling.Shift[k] = shift
+			}
+		}
+	}
+
+	return sampling, nil
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+func TestGenerateKPoints(t *testing.T) {
+	cubic, _ := LatticeFromCellParameters(4, 4, 4, 90, 90, 90)
+	slab, _ := LatticeFromCellParameters(3, 3, 30, 90, 90, 90)
+	hexagonal, _ := LatticeFromCellParameters(2.46, 2.46, 6.7, 90, 90, 120)
+
+	tests := []struct {
+		name     string
+		lattice  [3][3]float64
+		settings *types.KPointSettings
+		scheme   string
+		grid     [3]int
+		shift    [3]float64
+		spacing  float64
+	}{
+		{
+			// 2π/4 / 0.3 = 5.24
+			name:    "default spacing",
+			lattice: cubic,
+			scheme:  KPointSchemeMonkhorstPack,
+			grid:    [3]int{6, 6, 6},
+			shift:   [3]float64{0.5, 0.5, 0.5},
+			spacing: DefaultKPointSpacing,
+		},
+		{
+			name:     "coarse spacing",
+			lattice:  cubic,
+			settings: &types.KPointSettings{Spacing: 0.5},
+			scheme:   KPointSchemeMonkhorstPack,
+			grid:     [3]int{4, 4, 4},
+			shift:    [3]float64{0.5, 0.5, 0.5},
+			spacing:  0.5,
+		},
+		{
+			name:     "odd explicit mesh is Gamma-centred",
+			lattice:  cubic,
+			settings: &types.KPointSettings{Grid: &[3]int{3, 3, 3}},
+			scheme:   KPointSchemeMonkhorstPack,
+			grid:     [3]int{3, 3, 3},
+		},
+		{
+			name:     "mixed even and odd mesh",
+			lattice:  slab,
+			settings: &types.KPointSettings{Grid: &[3]int{4, 5, 1}},
+			scheme:   KPointSchemeMonkhorstPack,
+			grid:     [3]int{4, 5, 1},
+			shift:    [3]float64{0.5, 0, 0},
+		},
+		{
+			// The long axis of a slab needs a single point
+			name:    "slab",
+			lattice: slab,
+			scheme:  KPointSchemeMonkhorstPack,
+			grid:    [3]int{7, 7, 1},
+			spacing: DefaultKPointSpacing,
+		},
+		{
+			// Plane spacing of a = 2.46·sin(120°) = 2.13 Angstrom
+			name:     "hexagonal",
+			lattice:  hexagonal,
+			settings: &types.KPointSettings{Scheme: KPointSchemeSupercellFolding},
+			scheme:   KPointSchemeSupercellFolding,
+			grid:     [3]int{10, 10, 4},
+			spacing:  DefaultKPointSpacing,
+		},
+		{
+			name:     "supercell folding keeps an even mesh unshifted",
+			lattice:  cubic,
+			settings: &types.KPointSettings{Scheme: KPointSchemeSupercellFolding, Grid: &[3]int{4, 4, 4}},
+			scheme:   KPointSchemeSupercellFolding,
+			grid:     [3]int{4, 4, 4},
+		},
+		{
+			name:     "supercell folding with an explicit shift",
+			lattice:  cubic,
+			settings: &types.KPointSettings{Scheme: KPointSchemeSupercellFolding, Grid: &[3]int{2, 2, 2}, Shift: &[3]float64{0.5, 0, 0.25}},
+			scheme:   KPointSchemeSupercellFolding,
+			grid:     [3]int{2, 2, 2},
+			shift:    [3]float64{0.5, 0, 0.25},
+		},
+		{
+			name:     "gamma",
+			lattice:  cubic,
+			settings: &types.KPointSettings{Scheme: KPointSchemeGamma},
+			scheme:   KPointSchemeGamma,
+			grid:     [3]int{1, 1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampling, err := GenerateKPoints(tt.lattice, tt.settings)
+			if err != nil {
+				t.Fatalf("GenerateKPoints: %v", err)
+			}
+			if sampling.Scheme != tt.scheme || sampling.Grid != tt.grid || sampling.Shift != tt.shift || sampling.SpacingPerA != tt.spacing {
+				t.Errorf("got %s %v shift %v spacing %v, want %s %v shift %v spacing %v",
+					sampling.Scheme, sampling.Grid, sampling.Shift, sampling.SpacingPerA, tt.scheme, tt.grid, tt.shift, tt.spacing)
+			}
+		})
+	}
+}
+
+func TestGenerateKPointsErrors(t *testing.T) {
+	cubic, _ := LatticeFromCellParameters(4, 4, 4, 90, 90, 90)
+	tests := []struct {
+		name     string
+		lattice  [3][3]float64
+		settings *types.KPointSettings
+		err      string
+	}{
+		{"unknown scheme", cubic, &types.KPointSettings{Scheme: "random"}, "invalid k-point scheme"},
+		{"zero grid", cubic, &types.KPointSettings{Grid: &[3]int{2, 0, 2}}, "must be positive"},
+		{"negative spacing", cubic, &types.KPointSettings{Spacing: -0.2}, "must be positive"},
+		{"shift with Monkhorst-Pack", cubic, &types.KPointSettings{Shift: &[3]float64{0.5, 0.5, 0.5}}, "requires the supercell_folding scheme"},
+		{"shift out of range", cubic, &types.KPointSettings{Scheme: KPointSchemeSupercellFolding, Shift: &[3]float64{1, 0, 0}}, "[0, 1)"},
+		{"gamma with grid", cubic, &types.KPointSettings{Scheme: KPointSchemeGamma, Grid: &[3]int{2, 2, 2}}, "takes no grid"},
+		{"singular lattice", [3][3]float64{{1, 0, 0}, {2, 0, 0}, {0, 0, 1}}, nil, "invalid lattice vectors"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateKPoints(tt.lattice, tt.settings)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// LatticeFromCellParameters builds the lattice matrix for the given cell
+// lengths (Angstrom) and angles (degrees). Rows are the lattice vectors in
+// the standard crystallographic orientation: a along x and b in the xy plane.
+func LatticeFromCellParameters(a, b, c, alpha, beta, gamma float64) ([3][3]float64, error) {
+	var lattice [3][3]float64
+
+	if a <= 0 || b <= 0 || c <= 0 {
+		return lattice, fmt.Errorf("cell lengths must be positive (a=%g, b=%g, c=%g)", a, b, c)
+	}
+
+	cosAlpha := math.Cos(alpha * math.Pi / 180.0)
+	cosBeta := math.Cos(beta * math.Pi / 180.0)
+	cosGamma := math.Cos(gamma * math.Pi / 180.0)
+	sinGamma := math.Sin(gamma * math.Pi / 180.0)
+
+	if sinGamma <= 1e-8 {
+		return lattice, fmt.Errorf("invalid cell angle gamma=%g", gamma)
+	}
+
+	cy := (cosAlpha - cosBeta*cosGamma) / sinGamma
+	czSquared := 1.0 - cosBeta*cosBeta - cy*cy
+	if czSquared <= 1e-12 {
+		return lattice, fmt.Errorf("cell angles alpha=%g, beta=%g, gamma=%g do not describe a valid cell", alpha, beta, gamma)
+	}
+
+	lattice[0] = [3]float64{a, 0, 0}
+	lattice[1] = [3]float64{b * cosGamma, b * sinGamma, 0}
+	lattice[2] = [3]float64{c * cosBeta, c * cy, c * math.Sqrt(czSquared)}
+
+	// Suppress rounding noise such as cos(90°) = 6e-17
+	for i := range lattice {
+		for j := range lattice[i] {
+			if math.Abs(lattice[i][j]) < 1e-12 {
+				lattice[i][j] = 0
+			}
+		}
+	}
+
+	return lattice, nil
+}
+
+// LatticeFromDataBlock returns the lattice matrix of a CIF data block: the
+// stored matrix when the structure was read with one, so that POSCAR and
+// extxyz structures keep their orientation, or else the standard matrix
+// built from the cell parameters. Missing angles default to 90 degrees.
+func LatticeFromDataBlock(dataBlock *types.CIFDataBlock) ([3][3]float64, error) {
+	if dataBlock.LatticeVectors != nil {
+		return *dataBlock.LatticeVectors, nil
+	}
+	return LatticeFromCellParameters(
+		dataBlock.CellLength["_cell_length_a"],
+		dataBlock.CellLength["_cell_length_b"],
+		dataBlock.CellLength["_cell_length_c"],
+		cellAngle(dataBlock, "_cell_angle_alpha"),
+		cellAngle(dataBlock, "_cell_angle_beta"),
+		cellAngle(dataBlock, "_cell_angle_gamma"),
+	)
+}
+
+// cellAngle returns a cell angle in degrees, defaulting to 90 when absent
+func cellAngle(dataBlock *types.CIFDataBlock, tag string) float64 {
+	if angle, ok := dataBlock.CellAngle[tag]; ok {
+		return angle
+	}
+	return 90.0
+}
+
+// InvertLattice returns the inverse of a lattice matrix
+func InvertLattice(lattice [3][3]float64) ([3][3]float64, error) {
+	var inv [3][3]float64
+
+	det := LatticeVolume(lattice)
+	if math.Abs(det) < 1e-12 {
+		return inv, fmt.Errorf("lattice vectors are linearly dependent")
+	}
+
+	m := lattice
+	inv[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det
+	inv[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det
+	inv[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det
+	inv[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det
+	inv[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det
+	inv[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det
+	inv[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det
+	inv[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det
+	inv[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det
+
+	return inv, nil
+}
+
+// LatticeVolume returns the signed cell volume (determinant of the lattice)
+func LatticeVolume(lattice [3][3]float64) float64 {
+	m := lattice
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// ReciprocalDirection returns the unit vector normal to the two lattice
+// vectors other than k, given the inverse lattice. Moving an atom
+// perpendicular to it leaves its fractional coordinate k unchanged.
+func ReciprocalDirection(inverse [3][3]float64, k int) [3]float64 {
+	direction := [3]float64{inverse[0][k], inverse[1][k], inverse[2][k]}
+	norm := math.Sqrt(direction[0]*direction[0] + direction[1]*direction[1] + direction[2]*direction[2])
+	for j := range direction {
+		direction[j] /= norm
+		if math.Abs(direction[j]) < 1e-12 {
+			direction[j] = 0
+		}
+	}
+	return direction
+}
+
+// PlaneSpacings returns the distances between the lattice planes spanned by
+// each pair of lattice vectors, i.e. the inverse lengths of the reciprocal
+// lattice vectors without the factor 2π
+func PlaneSpacings(lattice [3][3]float64) ([3]float64, error) {
+	var spacings [3]float64
+	inverse, err := InvertLattice(lattice)
+	if err != nil {
+		return spacings, err
+	}
+	// Column j of the inverse lattice is the reciprocal vector of axis j
+	for j := 0; j < 3; j++ {
+		length := math.Sqrt(inverse[0][j]*inverse[0][j] + inverse[1][j]*inverse[1][j] + inverse[2][j]*inverse[2][j])
+		spacings[j] = 1 / length
+	}
+	return spacings, nil
+}
+
+// FractionalToCartesian converts a fractional position to Cartesian
+// coordinates in Angstrom
+func FractionalToCartesian(lattice [3][3]float64, frac [3]float64) [3]float64 {
+	var cart [3]float64
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			cart[j] += frac[i] * lattice[i][j]
+		}
+	}
+	return cart
+}
+
+// CartesianToFractional converts a Cartesian position in Angstrom to
+// fractional coordinates using the inverse lattice from InvertLattice
+func CartesianToFractional(inverse [3][3]float64, cart [3]float64) [3]float64 {
+	var frac [3]float64
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			frac[j] += cart[i] * inverse[i][j]
+		}
+	}
+	return frac
+}
+
+// latticeMetric returns the metric tensor G = L·Lᵀ of a lattice matrix
+func latticeMetric(lattice [3][3]float64) [3][3]float64 {
+	var metric [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				metric[i][j] += lattice[i][k] * lattice[j][k]
+			}
+		}
+	}
+	return metric
+}
+
+// CellParametersFromLattice returns the cell lengths (Angstrom) and angles
+// (degrees) a, b, c, alpha, beta, gamma of a lattice matrix
+func CellParametersFromLattice(lattice [3][3]float64) [6]float64 {
+	norm := func(v [3]float64) float64 {
+		return math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	}
+	angle := func(u, v [3]float64) float64 {
+		cos := (u[0]*v[0] + u[1]*v[1] + u[2]*v[2]) / (norm(u) * norm(v))
+		return math.Acos(math.Max(-1, math.Min(1, cos))) * 180.0 / math.Pi
+	}
+
+	return [6]float64{
+		norm(lattice[0]),
+		norm(lattice[1]),
+		norm(lattice[2]),
+		angle(lattice[1], lattice[2]),
+		angle(lattice[0], lattice[2]),
+		angle(lattice[0], lattice[1]),
+	}
+}
+
+// Lattice relaxation modes of variable-cell optimizations
+const (
+	LatticeModeFull        = "full"         // Every lattice vector relaxes freely
+	LatticeModeIsotropic   = "isotropic"    // The cell is only scaled
+	LatticeModeFixedAngles = "fixed_angles" // Lengths relax, angles are kept
+)
+
+// IsValidLatticeMode reports whether mode names a known lattice relaxation mode
+func IsValidLatticeMode(mode string) bool {
+	switch mode {
+	case LatticeModeFull, LatticeModeIsotropic, LatticeModeFixedAngles:
+		return true
+	}
+	return false
+}
+
+// LatticeParametersOf returns the cell lengths, angles and volume of a lattice
+// matrix
+func LatticeParametersOf(lattice [3][3]float64) types.LatticeParameters {
+	params := CellParametersFromLattice(lattice)
+	return types.LatticeParameters{
+		A:        params[0],
+		B:        params[1],
+		C:        params[2],
+		Alpha:    params[3],
+		Beta:     params[4],
+		Gamma:    params[5],
+		VolumeA3: math.Abs(LatticeVolume(lattice)),
+	}
+}
+
+// CompareCells summarizes the change from the initial to the final lattice.
+// The strain is the Green-Lagrange tensor E = (FᵀF - I)/2 of the deformation
+// gradient F that maps the initial lattice vectors onto the final ones.
+func CompareCells(initial, final [3][3]float64) (*types.CellChange, error) {
+	inverse, err := InvertLattice(initial)
+	if err != nil {
+		return nil, fmt.Errorf("invalid initial lattice: %v", err)
+	}
+
+	// Rows are lattice vectors, so final = initial·Fᵀ and Fᵀ = initial⁻¹·final
+	var gradientT [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				gradientT[i][j] += inverse[i][k] * final[k][j]
+			}
+		}
+	}
+
+	strain := make([][]float64, 3)
+	for i := 0; i < 3; i++ {
+		strain[i] = make([]float64, 3)
+		for j := 0; j < 3; j++ {
+			// (FᵀF)ij = Σk Fki Fkj = Σk Fᵀik Fᵀjk
+			for k := 0; k < 3; k++ {
+				strain[i][j] += gradientT[i][k] * gradientT[j][k]
+			}
+			if i == j {
+				strain[i][j] -= 1
+			}
+			strain[i][j] /= 2
+		}
+	}
+
+	change := &types.CellChange{
+		Initial:      LatticeParametersOf(initial),
+		Final:        LatticeParametersOf(final),
+		StrainTensor: strain,
+	}
+	change.VolumeChangeA3 = change.Final.VolumeA3 - change.Initial.VolumeA3
+	change.VolumeChangePercent = 100 * change.VolumeChangeA3 / change.Initial.VolumeA3
+
+	return change, nil
+}
+
+// SetCellFromLattice stores a lattice matrix and its cell parameters in a
+// CIF data block
+func SetCellFromLattice(dataBlock *types.CIFDataBlock, lattice [3][3]float64) {
+	params := CellParametersFromLattice(lattice)
+	dataBlock.LatticeVectors = &lattice
+
+	dataBlock.CellLength = map[string]float64{
+		"_cell_length_a": params[0],
+		"_cell_length_b": params[1],
+		"_cell_length_c": params[2],
+	}
+	dataBlock.CellAngle = map[string]float64{
+		"_cell_angle_alpha": params[3],
+		"_cell_angle_beta":  params[4],
+		"_cell_angle_gamma": params[5],
+	}
+}
+
+// SiteCartesian returns the Cartesian position of an atom site of a data
+// block with the given lattice, in the frame the structure was read in
+func SiteCartesian(dataBlock *types.CIFDataBlock, lattice [3][3]float64, site types.AtomSite) [3]float64 {
+	pos := FractionalToCartesian(lattice, [3]float64{site.FractX, site.FractY, site.FractZ})
+	return [3]float64{pos[0] + dataBlock.Origin[0], pos[1] + dataBlock.Origin[1], pos[2] + dataBlock.Origin[2]}
+}
+
+// moleculeBoxPadding is the vacuum in Angstrom placed around a non-periodic
+// structure when it is described by a bounding box cell
+const moleculeBoxPadding = 10.0
+
+// SetStructureFromCartesian fills the cell and fractional coordinates of a
+// data block from Cartesian positions. Periodic structures use the given
+// lattice; non-periodic ones (lattice nil) are placed in an orthorhombic
+// bounding box with moleculeBoxPadding of vacuum on every side. The box is
+// not moved onto the molecule: its corner is stored as the origin, so that
+// SiteCartesian returns the positions as given.
+func SetStructureFromCartesian(dataBlock *types.CIFDataBlock, lattice *[3][3]float64, positions [][3]float64) error {
+	var cell [3][3]float64
+	var shift [3]float64
+
+	if lattice != nil {
+		cell = *lattice
+	} else {
+		dataBlock.NonPeriodic = true
+
+		min, max := [3]float64{}, [3]float64{}
+		for i, pos := range positions {
+			for k := 0; k < 3; k++ {
+				if i == 0 || pos[k] < min[k] {
+					min[k] = pos[k]
+				}
+				if i == 0 || pos[k] > max[k] {
+					max[k] = pos[k]
+				}
+			}
+		}
+		for k := 0; k < 3; k++ {
+			cell[k][k] = max[k] - min[k] + 2*moleculeBoxPadding
+			shift[k] = moleculeBoxPadding - min[k]
+		}
+	}
+
+	inverse, err := InvertLattice(cell)
+	if err != nil {
+		return err
+	}
+
+	SetCellFromLattice(dataBlock, cell)
+	dataBlock.Origin = [3]float64{-shift[0], -shift[1], -shift[2]}
+
+	if len(positions) != len(dataBlock.AtomSites) {
+		return fmt.Errorf("%d positions for %d atom sites", len(positions), len(dataBlock.AtomSites))
+	}
+
+	for i, pos := range positions {
+		frac := CartesianToFractional(inverse, [3]float64{pos[0] + shift[0], pos[1] + shift[1], pos[2] + shift[2]})
+		site := &dataBlock.AtomSites[i]
+		site.FractX, site.FractY, site.FractZ = frac[0], frac[1], frac[2]
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLatticeFromCellParameters(t *testing.T) {
+	sqrt3 := math.Sqrt(3)
+	tests := []struct {
+		name   string
+		params [6]float64
+		want   [3][3]float64
+	}{
+		{
+			name:   "cubic",
+			params: [6]float64{4, 4, 4, 90, 90, 90},
+			want:   [3][3]float64{{4, 0, 0}, {0, 4, 0}, {0, 0, 4}},
+		},
+		{
+			name:   "orthorhombic",
+			params: [6]float64{3, 4, 5, 90, 90, 90},
+			want:   [3][3]float64{{3, 0, 0}, {0, 4, 0}, {0, 0, 5}},
+		},
+		{
+			name:   "hexagonal",
+			params: [6]float64{2, 2, 5, 90, 90, 120},
+			want:   [3][3]float64{{2, 0, 0}, {-1, sqrt3, 0}, {0, 0, 5}},
+		},
+		{
+			name:   "monoclinic",
+			params: [6]float64{3, 4, 2, 90, 120, 90},
+			want:   [3][3]float64{{3, 0, 0}, {0, 4, 0}, {-1, 0, sqrt3}},
+		},
+		{
+			name:   "rhombohedral primitive fcc",
+			params: [6]float64{math.Sqrt2, math.Sqrt2, math.Sqrt2, 60, 60, 60},
+			want: [3][3]float64{
+				{math.Sqrt2, 0, 0},
+				{math.Sqrt2 / 2, math.Sqrt(6) / 2, 0},
+				{math.Sqrt2 / 2, math.Sqrt(6) / 6, 2 / sqrt3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.params
+			lattice, err := LatticeFromCellParameters(p[0], p[1], p[2], p[3], p[4], p[5])
+			if err != nil {
+				t.Fatalf("LatticeFromCellParameters: %v", err)
+			}
+			for i := 0; i < 3; i++ {
+				for j := 0; j < 3; j++ {
+					if !approxEqual(lattice[i][j], tt.want[i][j], 1e-9) {
+						t.Fatalf("got %v, want %v", lattice, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTriclinicRoundTrip(t *testing.T) {
+	a, b, c := 5.1, 6.3, 7.7
+	alpha, beta, gamma := 78.5, 102.3, 95.7
+	lattice, err := LatticeFromCellParameters(a, b, c, alpha, beta, gamma)
+	if err != nil {
+		t.Fatalf("LatticeFromCellParameters: %v", err)
+	}
+
+	params := CellParametersFromLattice(lattice)
+	for i, want := range [6]float64{a, b, c, alpha, beta, gamma} {
+		if !approxEqual(params[i], want, 1e-9) {
+			t.Errorf("parameter %d: got %v, want %v", i, params[i], want)
+		}
+	}
+
+	ca, cb, cg := math.Cos(alpha*math.Pi/180), math.Cos(beta*math.Pi/180), math.Cos(gamma*math.Pi/180)
+	volume := a * b * c * math.Sqrt(1-ca*ca-cb*cb-cg*cg+2*ca*cb*cg)
+	if !approxEqual(LatticeVolume(lattice), volume, 1e-9) {
+		t.Errorf("volume: got %v, want %v", LatticeVolume(lattice), volume)
+	}
+
+	inverse, err := InvertLattice(lattice)
+	if err != nil {
+		t.Fatalf("InvertLattice: %v", err)
+	}
+	for _, frac := range [][3]float64{{0, 0, 0}, {1, 0, 0}, {0.25, 0.5, 0.75}, {-0.3, 1.2, 0.9}} {
+		back := CartesianToFractional(inverse, FractionalToCartesian(lattice, frac))
+		for k := 0; k < 3; k++ {
+			if !approxEqual(back[k], frac[k], 1e-12) {
+				t.Errorf("round trip of %v gave %v", frac, back)
+				break
+			}
+		}
+	}
+	if cart := FractionalToCartesian(lattice, [3]float64{0, 1, 0}); cart != lattice[1] {
+		t.Errorf("fractional (0,1,0) mapped to %v, want the b vector %v", cart, lattice[1])
+	}
+}
+
+func TestLatticeFromCellParametersInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		params [6]float64
+	}{
+		{"zero length", [6]float64{0, 1, 1, 90, 90, 90}},
+		{"negative length", [6]float64{1, -1, 1, 90, 90, 90}},
+		{"flat gamma", [6]float64{1, 1, 1, 90, 90, 180}},
+		{"impossible angles", [6]float64{1, 1, 1, 10, 10, 120}},
+	}
+	for _, tt := range tests {
+		p := tt.params
+		if _, err := LatticeFromCellParameters(p[0], p[1], p[2], p[3], p[4], p[5]); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestPlaneSpacings(t *testing.T) {
+	hexagonal, _ := LatticeFromCellParameters(2, 2, 5, 90, 90, 120)
+	spacings, err := PlaneSpacings(hexagonal)
+	if err != nil {
+		t.Fatalf("PlaneSpacings: %v", err)
+	}
+	want := [3]float64{math.Sqrt(3), math.Sqrt(3), 5}
+	for k := 0; k < 3; k++ {
+		if !approxEqual(spacings[k], want[k], 1e-9) {
+			t.Errorf("got %v, want %v", spacings, want)
+			break
+		}
+	}
+}
+
+func TestCompareCells(t *testing.T) {
+	initial, _ := LatticeFromCellParameters(4, 4, 4, 90, 90, 90)
+	final, _ := LatticeFromCellParameters(4.04, 4, 4, 90, 90, 90)
+
+	change, err := CompareCells(initial, final)
+	if err != nil {
+		t.Fatalf("CompareCells: %v", err)
+	}
+	if want := (1.01*1.01 - 1) / 2; !approxEqual(change.StrainTensor[0][0], want, 1e-12) {
+		t.Errorf("strain xx: got %v, want %v", change.StrainTensor[0][0], want)
+	}
+	if !approxEqual(change.StrainTensor[1][1], 0, 1e-12) || !approxEqual(change.StrainTensor[0][1], 0, 1e-12) {
+		t.Errorf("unexpected strain components: %v", change.StrainTensor)
+	}
+	if !approxEqual(change.VolumeChangePercent, 1, 1e-9) {
+		t.Errorf("volume change: got %v%%, want 1%%", change.VolumeChangePercent)
+	}
+}
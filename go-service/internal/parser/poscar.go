@@ -0,0 +1,344 @@
+package parser
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/elements"
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// POSCARParser reads VASP POSCAR and CONTCAR files into a single data block
+type POSCARParser struct{}
+
+// NewPOSCARParser creates a new POSCAR parser instance
+func NewPOSCARParser() *POSCARParser {
+	return &POSCARParser{}
+}
+
+// ParseFromBase64 parses a POSCAR file from base64 encoded string
+func (p *POSCARParser) ParseFromBase64(base64Content string) (*types.CIFFile, error) {
+	decoded, err := base64.StdEncoding.DecodeString(base64Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 content: %v", err)
+	}
+
+	return p.ParseFromString(string(decoded))
+}
+
+// ParseFromString parses a POSCAR or CONTCAR file. Species are read from the
+// VASP5 species line, or from the comment line of VASP4 files. The lattice
+// matrix is kept as given, and selective dynamics flags fix the fractional
+// coordinates along the lattice vectors they refer to. Velocities and
+// predictor-corrector blocks of a CONTCAR are ignored.
+func (p *POSCARParser) ParseFromString(content string) (*types.CIFFile, error) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if len(lines) < 8 {
+		return nil, fmt.Errorf("POSCAR content is too short")
+	}
+
+	comment := strings.TrimSpace(lines[0])
+
+	lattice, err := p.parseLattice(lines[1:5])
+	if err != nil {
+		return nil, err
+	}
+
+	// VASP5 files have a species line before the counts
+	line := 5
+	species := strings.Fields(lines[line])
+	if len(species) == 0 {
+		return nil, fmt.Errorf("line %d: expected species or atom counts", line+1)
+	}
+	if _, err := strconv.Atoi(species[0]); err == nil {
+		species = strings.Fields(comment)
+	} else {
+		line++
+	}
+
+	countFields := strings.Fields(lines[line])
+	counts := make([]int, len(countFields))
+	total := 0
+	for i, field := range countFields {
+		count, err := strconv.Atoi(field)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("line %d: invalid atom count %q", line+1, field)
+		}
+		counts[i] = count
+		total += count
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("line %d: no atoms", line+1)
+	}
+	if len(species) < len(counts) {
+		return nil, fmt.Errorf("line %d: %d atom counts but only %d species names; VASP4 files need the species on the comment line", line+1, len(counts), len(species))
+	}
+	line++
+
+	selective := false
+	if line < len(lines) && strings.HasPrefix(strings.ToLower(strings.TrimSpace(lines[line])), "s") {
+		selective = true
+		line++
+	}
+
+	if line >= len(lines) {
+		return nil, fmt.Errorf("missing coordinate mode line")
+	}
+	mode := strings.ToLower(strings.TrimSpace(lines[line]))
+	cartesian := strings.HasPrefix(mode, "c") || strings.HasPrefix(mode, "k")
+	if !cartesian && !strings.HasPrefix(mode, "d") {
+		return nil, fmt.Errorf("line %d: expected Direct or Cartesian, got %q", line+1, strings.TrimSpace(lines[line]))
+	}
+	line++
+
+	if line+total > len(lines) {
+		return nil, fmt.Errorf("expected %d atom lines, file ends early", total)
+	}
+
+	dataBlock := &types.CIFDataBlock{
+		Name:     sanitizeBlockName(comment),
+		Metadata: make(map[string]string),
+	}
+	if dataBlock.Name == "" {
+		dataBlock.Name = "poscar"
+	}
+	if comment != "" {
+		dataBlock.Metadata["_vasp_comment"] = comment
+		dataBlock.MetadataOrder = append(dataBlock.MetadataOrder, "_vasp_comment")
+	}
+
+	labels := make(map[string]int)
+	positions := make([][3]float64, 0, total)
+	atom := 0
+	for i, count := range counts {
+		element, err := elements.NormalizeTypeSymbol(species[i])
+		if err != nil {
+			return nil, fmt.Errorf("species %s: %v", species[i], err)
+		}
+
+		for n := 0; n < count; n++ {
+			fields := strings.Fields(lines[line+atom])
+			if len(fields) < 3 || selective && len(fields) < 6 {
+				return nil, fmt.Errorf("line %d: too few columns", line+atom+1)
+			}
+
+			var pos [3]float64
+			for k := 0; k < 3; k++ {
+				val, err := strconv.ParseFloat(fields[k], 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid coordinate %q", line+atom+1, fields[k])
+				}
+				pos[k] = val
+			}
+
+			site := types.AtomSite{TypeSymbol: element, Element: element, Occupancy: 1.0}
+			labels[element]++
+			site.Label = fmt.Sprintf("%s%d", element, labels[element])
+
+			if selective {
+				for k := 0; k < 3; k++ {
+					switch strings.ToUpper(fields[3+k]) {
+					case "T":
+					case "F":
+						site.FixedLatticeAxes[k] = true
+					default:
+						return nil, fmt.Errorf("line %d: invalid selective dynamics flag %q", line+atom+1, fields[3+k])
+					}
+				}
+			}
+
+			if cartesian {
+				pos = [3]float64{pos[0] * lattice.scale[0], pos[1] * lattice.scale[1], pos[2] * lattice.scale[2]}
+			} else {
+				pos = FractionalToCartesian(lattice.vectors, pos)
+			}
+
+			dataBlock.AtomSites = append(dataBlock.AtomSites, site)
+			positions = append(positions, pos)
+			atom++
+		}
+	}
+
+	if err := SetStructureFromCartesian(dataBlock, &lattice.vectors, positions); err != nil {
+		return nil, fmt.Errorf("invalid lattice: %v", err)
+	}
+
+	return &types.CIFFile{
+		DataBlock:  *dataBlock,
+		DataBlocks: []types.CIFDataBlock{*dataBlock},
+	}, nil
+}
+
+// poscarLattice is the scaled lattice of a POSCAR file together with the
+// per-axis scale factors applied to Cartesian coordinates
+type poscarLattice struct {
+	vectors [3][3]float64
+	scale   [3]float64
+}
+
+// parseLattice reads the scaling line and the three lattice vectors. A
+// negative scale gives the cell volume; three scales stretch each axis.
+func (p *POSCARParser) parseLattice(lines []string) (*poscarLattice, error) {
+	scaleFields := strings.Fields(lines[0])
+	if len(scaleFields) != 1 && len(scaleFields) != 3 {
+		return nil, fmt.Errorf("line 2: expected one or three scale factors")
+	}
+	scales := make([]float64, len(scaleFields))
+	for i, field := range scaleFields {
+		val, err := strconv.ParseFloat(field, 64)
+		if err != nil || val == 0 {
+			return nil, fmt.Errorf("line 2: invalid scale factor %q", field)
+		}
+		scales[i] = val
+	}
+
+	var raw [3][3]float64
+	for i := 0; i < 3; i++ {
+		fields := strings.Fields(lines[1+i])
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected a lattice vector", i+3)
+		}
+		for k := 0; k < 3; k++ {
+			val, err := strconv.ParseFloat(fields[k], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid lattice component %q", i+3, fields[k])
+			}
+			raw[i][k] = val
+		}
+	}
+
+	lattice := &poscarLattice{vectors: raw}
+	switch {
+	case len(scales) == 3:
+		if scales[0] < 0 || scales[1] < 0 || scales[2] < 0 {
+			return nil, fmt.Errorf("line 2: per-axis scale factors must be positive")
+		}
+		copy(lattice.scale[:], scales)
+	case scales[0] < 0:
+		volume := math.Abs(LatticeVolume(raw))
+		if volume < 1e-12 {
+			return nil, fmt.Errorf("lattice vectors are linearly dependent")
+		}
+		scale := math.Cbrt(-scales[0] / volume)
+		lattice.scale = [3]float64{scale, scale, scale}
+	default:
+		lattice.scale = [3]float64{scales[0], scales[0], scales[0]}
+	}
+
+	for i := 0; i < 3; i++ {
+		for k := 0; k < 3; k++ {
+			lattice.vectors[i][k] *= lattice.scale[k]
+		}
+	}
+
+	return lattice, nil
+}
+
+// POSCARWriter serializes structures as VASP5 POSCAR files
+type POSCARWriter struct{}
+
+// NewPOSCARWriter creates a new POSCAR writer instance
+func NewPOSCARWriter() *POSCARWriter {
+	return &POSCARWriter{}
+}
+
+// Write serializes the selected data block of a CIF as a VASP5 POSCAR with
+// direct coordinates. Atoms are grouped by species in order of first
+// appearance, and selective dynamics is written when any axis is fixed.
+// Selective dynamics refers to the lattice vectors, so a fixed Cartesian
+// axis is only written when it fixes a fractional coordinate, or when the
+// atom is fixed along every axis.
+func (w *POSCARWriter) Write(cif *types.CIFFile, comment string) (string, error) {
+	if cif == nil {
+		return "", fmt.Errorf("invalid CIF file")
+	}
+
+	lattice, err := LatticeFromDataBlock(&cif.DataBlock)
+	if err != nil {
+		return "", fmt.Errorf("invalid cell parameters: %v", err)
+	}
+
+	inverse, err := InvertLattice(lattice)
+	if err != nil {
+		return "", fmt.Errorf("invalid lattice: %v", err)
+	}
+
+	var species []string
+	groups := make(map[string][]types.AtomSite)
+	flags := make(map[string][][3]bool)
+	selective := false
+	for _, site := range cif.DataBlock.AtomSites {
+		if site.Element == "" {
+			return "", fmt.Errorf("atom site %s has no known element", site.Label)
+		}
+		if _, ok := groups[site.Element]; !ok {
+			species = append(species, site.Element)
+		}
+		fixed := selectiveFlags(inverse, site)
+		groups[site.Element] = append(groups[site.Element], site)
+		flags[site.Element] = append(flags[site.Element], fixed)
+		selective = selective || fixed != [3]bool{}
+	}
+
+	if comment == "" {
+		comment = cif.DataBlock.Name
+	}
+
+	var content strings.Builder
+	content.WriteString(strings.ReplaceAll(comment, "\n", " ") + "\n")
+	content.WriteString("1.0\n")
+	for _, vector := range lattice {
+		content.WriteString(fmt.Sprintf("  %16.10f %16.10f %16.10f\n", vector[0], vector[1], vector[2]))
+	}
+
+	counts := make([]string, len(species))
+	for i, element := range species {
+		counts[i] = strconv.Itoa(len(groups[element]))
+	}
+	content.WriteString("  " + strings.Join(species, "  ") + "\n")
+	content.WriteString("  " + strings.Join(counts, "  ") + "\n")
+
+	if selective {
+		content.WriteString("Selective dynamics\n")
+	}
+	content.WriteString("Direct\n")
+
+	for _, element := range species {
+		for i, site := range groups[element] {
+			line := fmt.Sprintf("  %14.10f %14.10f %14.10f", site.FractX, site.FractY, site.FractZ)
+			if selective {
+				for _, fixed := range flags[element][i] {
+					if fixed {
+						line += " F"
+					} else {
+						line += " T"
+					}
+				}
+			}
+			content.WriteString(line + "\n")
+		}
+	}
+
+	return content.String(), nil
+}
+
+// selectiveFlags returns the fractional coordinates of an atom that its
+// fixed lattice and Cartesian axes keep from changing
+func selectiveFlags(inverse [3][3]float64, site types.AtomSite) [3]bool {
+	if site.FixedAxes == [3]bool{true, true, true} {
+		return site.FixedAxes
+	}
+
+	fixed := site.FixedLatticeAxes
+	for k := 0; k < 3; k++ {
+		// Fixing Cartesian axis k fixes fractional coordinate k only when
+		// the reciprocal vector of k points along that axis
+		if site.FixedAxes[k] && math.Abs(ReciprocalDirection(inverse, k)[k]) > 1-1e-9 {
+			fixed[k] = true
+		}
+	}
+	return fixed
+}
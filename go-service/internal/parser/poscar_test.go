@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// rotatedPOSCAR is a primitive rock-salt cell whose first lattice vector
+// does not lie along x
+const rotatedPOSCAR = `rotated rock salt
+1.0
+  0.0 2.1 2.1
+  2.1 0.0 2.1
+  2.1 2.1 0.0
+  Mg O
+  1 1
+Selective dynamics
+Direct
+  0.0 0.0 0.0 F F F
+  0.5 0.5 0.5 T T F
+`
+
+func TestPOSCARParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		lattice [3][3]float64
+		labels  []string
+		fract   [][3]float64
+		fixed   [][3]bool
+	}{
+		{
+			name:    "selective dynamics in a rotated cell",
+			content: rotatedPOSCAR,
+			lattice: [3][3]float64{{0, 2.1, 2.1}, {2.1, 0, 2.1}, {2.1, 2.1, 0}},
+			labels:  []string{"Mg1", "O1"},
+			fract:   [][3]float64{{0, 0, 0}, {0.5, 0.5, 0.5}},
+			fixed:   [][3]bool{{true, true, true}, {false, false, true}},
+		},
+		{
+			name:    "scaled Cartesian coordinates",
+			content: "scaled\n2.0\n1 0 0\n0 1 0\n0 0 1.5\nH\n2\nCartesian\n0.5 0.5 0.75\n0 0 0\n",
+			lattice: [3][3]float64{{2, 0, 0}, {0, 2, 0}, {0, 0, 3}},
+			labels:  []string{"H1", "H2"},
+			fract:   [][3]float64{{0.5, 0.5, 0.5}, {0, 0, 0}},
+			fixed:   [][3]bool{{}, {}},
+		},
+		{
+			name:    "volume scale",
+			content: "volume\n-27\n1 0 0\n0 1 0\n0 0 1\nSi\n1\nDirect\n0.25 0.25 0.25\n",
+			lattice: [3][3]float64{{3, 0, 0}, {0, 3, 0}, {0, 0, 3}},
+			labels:  []string{"Si1"},
+			fract:   [][3]float64{{0.25, 0.25, 0.25}},
+			fixed:   [][3]bool{{}},
+		},
+		{
+			name:    "VASP4 species on the comment line",
+			content: "Si O\n1.0\n4 0 0\n0 4 0\n0 0 4\n1 2\nd\n0 0 0\n0.5 0 0\n0 0.5 0\n",
+			lattice: [3][3]float64{{4, 0, 0}, {0, 4, 0}, {0, 0, 4}},
+			labels:  []string{"Si1", "O1", "O2"},
+			fract:   [][3]float64{{0, 0, 0}, {0.5, 0, 0}, {0, 0.5, 0}},
+			fixed:   [][3]bool{{}, {}, {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cif, err := NewPOSCARParser().ParseFromString(tt.content)
+			if err != nil {
+				t.Fatalf("ParseFromString: %v", err)
+			}
+			block := cif.DataBlock
+			if block.NonPeriodic {
+				t.Errorf("POSCAR structure read as non-periodic")
+			}
+
+			lattice, err := LatticeFromDataBlock(&block)
+			if err != nil {
+				t.Fatalf("LatticeFromDataBlock: %v", err)
+			}
+			for i := 0; i < 3; i++ {
+				for j := 0; j < 3; j++ {
+					if !approxEqual(lattice[i][j], tt.lattice[i][j], 1e-9) {
+						t.Fatalf("lattice: got %v, want %v", lattice, tt.lattice)
+					}
+				}
+			}
+
+			if len(block.AtomSites) != len(tt.labels) {
+				t.Fatalf("got %d atoms, want %d", len(block.AtomSites), len(tt.labels))
+			}
+			for i, site := range block.AtomSites {
+				fract := [3]float64{site.FractX, site.FractY, site.FractZ}
+				for k := 0; k < 3; k++ {
+					if !approxEqual(fract[k], tt.fract[i][k], 1e-9) {
+						t.Errorf("atom %d: got fractional coordinates %v, want %v", i+1, fract, tt.fract[i])
+						break
+					}
+				}
+				if site.Label != tt.labels[i] || site.FixedLatticeAxes != tt.fixed[i] || site.FixedAxes != [3]bool{} {
+					t.Errorf("atom %d: got %s with fixed lattice axes %v and Cartesian axes %v, want %s with %v",
+						i+1, site.Label, site.FixedLatticeAxes, site.FixedAxes, tt.labels[i], tt.fixed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPOSCARParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"too short", "x\n1.0\n", "too short"},
+		{"invalid scale", "x\n0\n1 0 0\n0 1 0\n0 0 1\nH\n1\nDirect\n0 0 0\n", "invalid scale factor"},
+		{"missing species", "x\n1.0\n1 0 0\n0 1 0\n0 0 1\n1 1\nDirect\n0 0 0\n0 0 0\n", "need the species on the comment line"},
+		{"invalid mode", "x\n1.0\n1 0 0\n0 1 0\n0 0 1\nH\n1\nReciprocal\n0 0 0\n", "expected Direct or Cartesian"},
+		{"missing atoms", "x\n1.0\n1 0 0\n0 1 0\n0 0 1\nH\n3\nDirect\n0 0 0\n", "file ends early"},
+		{"missing flags", "x\n1.0\n1 0 0\n0 1 0\n0 0 1\nH\n1\nSelective\nDirect\n0 0 0\n", "too few columns"},
+		{"invalid flag", "x\n1.0\n1 0 0\n0 1 0\n0 0 1\nH\n1\nSelective\nDirect\n0 0 0 T X T\n", "invalid selective dynamics flag"},
+		{"singular lattice", "x\n1.0\n1 0 0\n2 0 0\n0 0 1\nH\n1\nDirect\n0 0 0\n", "invalid lattice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPOSCARParser().ParseFromString(tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPOSCARRoundTrip(t *testing.T) {
+	cif, err := NewPOSCARParser().ParseFromString(rotatedPOSCAR)
+	if err != nil {
+		t.Fatalf("ParseFromString: %v", err)
+	}
+	content, err := NewPOSCARWriter().Write(cif, "")
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	again, err := NewPOSCARParser().ParseFromString(content)
+	if err != nil {
+		t.Fatalf("failed to read the written POSCAR: %v\n%s", err, content)
+	}
+
+	want, _ := LatticeFromDataBlock(&cif.DataBlock)
+	got, _ := LatticeFromDataBlock(&again.DataBlock)
+	if got != want {
+		t.Errorf("lattice not kept: got %v, want %v\n%s", got, want, content)
+	}
+	for i, site := range again.DataBlock.AtomSites {
+		original := cif.DataBlock.AtomSites[i]
+		if site.Label != original.Label || site.FractX != original.FractX || site.FractY != original.FractY || site.FractZ != original.FractZ || site.FixedLatticeAxes != original.FixedLatticeAxes {
+			t.Errorf("atom %d: got %+v, want %+v", i+1, site, original)
+		}
+	}
+}
+
+func TestPOSCARWriteCartesianConstraints(t *testing.T) {
+	hexagonal := types.CIFDataBlock{
+		Name:       "hexagonal",
+		CellLength: map[string]float64{"_cell_length_a": 2, "_cell_length_b": 2, "_cell_length_c": 5},
+		CellAngle:  map[string]float64{"_cell_angle_alpha": 90, "_cell_angle_beta": 90, "_cell_angle_gamma": 120},
+	}
+	tests := []struct {
+		name  string
+		block types.CIFDataBlock
+		fixed [3]bool
+		flags string
+	}{
+		{"cubic", cubicBlock(4, nil), [3]bool{true, false, false}, "F T T"},
+		// x is not normal to b and c, so fixing it fixes no fractional coordinate
+		{"hexagonal x", hexagonal, [3]bool{true, false, false}, "T T T"},
+		// y and z are normal to the other lattice vectors
+		{"hexagonal y and z", hexagonal, [3]bool{false, true, true}, "T F F"},
+		{"hexagonal frozen", hexagonal, [3]bool{true, true, true}, "F F F"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := tt.block
+			block.AtomSites = []types.AtomSite{
+				{Label: "C1", Element: "C", FixedAxes: tt.fixed},
+				{Label: "C2", Element: "C", FractZ: 0.5},
+			}
+			content, err := NewPOSCARWriter().Write(&types.CIFFile{DataBlock: block}, "")
+			if err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			var atomLines []string
+			for _, line := range strings.Split(content, "\n") {
+				if fields := strings.Fields(line); len(fields) == 6 {
+					atomLines = append(atomLines, strings.Join(fields[3:], " "))
+				}
+			}
+			if tt.flags == "T T T" {
+				if strings.Contains(content, "Selective") {
+					t.Errorf("selective dynamics written without a fixed fractional coordinate:\n%s", content)
+				}
+				return
+			}
+			if len(atomLines) != 2 || atomLines[0] != tt.flags || atomLines[1] != "T T T" {
+				t.Errorf("got flags %q, want %q:\n%s", atomLines, tt.flags, content)
+			}
+		})
+	}
+}
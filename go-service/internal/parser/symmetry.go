@@ -0,0 +1,314 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+// symmetryMergeTolerance is the distance in Angstrom below which two images
+// of the same site are treated as one atom
+const symmetryMergeTolerance = 0.05
+
+// spaceGroupTags are the metadata tags that describe the original space group
+// and no longer apply once a structure has been expanded to P1
+var spaceGroupTags = []string{
+	"_symmetry_space_group_name_h-m",
+	"_symmetry_space_group_name_hall",
+	"_symmetry_int_tables_number",
+	"_space_group_name_h-m_alt",
+	"_space_group_name_hall",
+	"_space_group_it_number",
+}
+
+// symOp is a parsed symmetry operation acting on fractional coordinates
+type symOp struct {
+	rotation    [3][3]float64
+	translation [3]float64
+}
+
+// apply transforms a fractional position with the operation
+func (op *symOp) apply(frac [3]float64) [3]float64 {
+	var out [3]float64
+	for i := 0; i < 3; i++ {
+		out[i] = op.translation[i]
+		for j := 0; j < 3; j++ {
+			out[i] += op.rotation[i][j] * frac[j]
+		}
+	}
+	return out
+}
+
+// isIdentity reports whether the operation leaves positions unchanged
+func (op *symOp) isIdentity() bool {
+	for i := 0; i < 3; i++ {
+		if op.translation[i] != 0 {
+			return false
+		}
+		for j := 0; j < 3; j++ {
+			if i == j && op.rotation[i][j] != 1 || i != j && op.rotation[i][j] != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ParseSymmetryOperationString splits an operation such as "-x, y+1/2, -z"
+// into its three components
+func ParseSymmetryOperationString(value string) (types.SymmetryOperation, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return types.SymmetryOperation{}, fmt.Errorf("symmetry operation %q does not have three components", value)
+	}
+
+	return types.SymmetryOperation{
+		X: strings.TrimSpace(parts[0]),
+		Y: strings.TrimSpace(parts[1]),
+		Z: strings.TrimSpace(parts[2]),
+	}, nil
+}
+
+// parseSymmetryOperation converts the component expressions of an operation
+// into a rotation matrix and translation vector
+func parseSymmetryOperation(op types.SymmetryOperation) (*symOp, error) {
+	parsed := &symOp{}
+
+	for i, expr := range []string{op.X, op.Y, op.Z} {
+		row, shift, err := parseSymmetryExpression(expr)
+		if err != nil {
+			return nil, fmt.Errorf("symmetry operation '%s,%s,%s': %v", op.X, op.Y, op.Z, err)
+		}
+		parsed.rotation[i] = row
+		parsed.translation[i] = shift
+	}
+
+	return parsed, nil
+}
+
+// parseSymmetryExpression parses a single component such as "x-y+1/2" into
+// its coefficients on x, y and z and its constant shift
+func parseSymmetryExpression(expr string) ([3]float64, float64, error) {
+	var row [3]float64
+	var shift float64
+
+	s := strings.ToLower(strings.ReplaceAll(expr, " ", ""))
+	if s == "" {
+		return row, shift, fmt.Errorf("empty expression")
+	}
+
+	for pos := 0; pos < len(s); {
+		sign := 1.0
+		if s[pos] == '+' || s[pos] == '-' {
+			if s[pos] == '-' {
+				sign = -1.0
+			}
+			pos++
+		}
+
+		start := pos
+		for pos < len(s) && (s[pos] >= '0' && s[pos] <= '9' || s[pos] == '.' || s[pos] == '/') {
+			pos++
+		}
+		number := s[start:pos]
+
+		if pos < len(s) && s[pos] == '*' {
+			pos++
+		}
+
+		axis := -1
+		if pos < len(s) && s[pos] >= 'x' && s[pos] <= 'z' {
+			axis = int(s[pos] - 'x')
+			pos++
+		}
+
+		if number == "" && axis < 0 {
+			return row, shift, fmt.Errorf("unexpected character in %q", expr)
+		}
+
+		coeff := 1.0
+		if number != "" {
+			val, err := parseFraction(number)
+			if err != nil {
+				return row, shift, fmt.Errorf("invalid number %q in %q", number, expr)
+			}
+			coeff = val
+		}
+
+		if axis >= 0 {
+			row[axis] += sign * coeff
+		} else {
+			shift += sign * coeff
+		}
+	}
+
+	return row, shift, nil
+}
+
+// parseFraction parses a decimal or a fraction such as "1/2"
+func parseFraction(s string) (float64, error) {
+	num, den, isFraction := strings.Cut(s, "/")
+	if !isFraction {
+		return strconv.ParseFloat(s, 64)
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0, fmt.Errorf("invalid denominator")
+	}
+
+	return n / d, nil
+}
+
+// ExpandSymmetry applies the symmetry operations of the data block to the
+// asymmetric unit and returns a copy of the CIF describing the full P1 cell.
+// Images of a site that coincide under periodic boundary conditions are
+// merged, so atoms on special positions appear once. Copies are labelled
+// <label>_<n> with n chosen so that no two sites share a label, and record
+// the label of their site as Parent.
+func (p *CIFParser) ExpandSymmetry(cif *types.CIFFile) (*types.CIFFile, error) {
+	if cif == nil {
+		return nil, fmt.Errorf("invalid CIF file")
+	}
+
+	if len(cif.DataBlock.Symmetry) == 0 {
+		return cif, nil
+	}
+
+	ops := make([]*symOp, 0, len(cif.DataBlock.Symmetry))
+	for _, op := range cif.DataBlock.Symmetry {
+		parsed, err := parseSymmetryOperation(op)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, parsed)
+	}
+
+	lattice, err := LatticeFromDataBlock(&cif.DataBlock)
+	if err != nil {
+		return nil, err
+	}
+	metric := latticeMetric(lattice)
+
+	inverse, err := InvertLattice(lattice)
+	if err != nil {
+		return nil, err
+	}
+	reciprocal := reciprocalLengths(inverse)
+
+	// Anisotropic ADPs are expanded along with their sites
+	aniso := findAnisoLoop(&cif.DataBlock)
+	var anisoRows map[string][]string
+	var expandedADPs [][]string
+	if aniso != nil {
+		anisoRows = aniso.rows(&cif.DataBlock)
+	}
+
+	// Labels of the asymmetric unit are taken before any copy is named
+	used := make(map[string]bool, len(cif.DataBlock.AtomSites))
+	for _, site := range cif.DataBlock.AtomSites {
+		used[site.Label] = true
+	}
+
+	expanded := &types.CIFFile{DataBlock: cif.DataBlock}
+	expanded.DataBlock.AtomSites = nil
+	expanded.DataBlock.Symmetry = []types.SymmetryOperation{{X: "x", Y: "y", Z: "z"}}
+
+	for _, site := range cif.DataBlock.AtomSites {
+		var images [][3]float64
+
+		for _, op := range ops {
+			image := op.apply([3]float64{site.FractX, site.FractY, site.FractZ})
+			for k := range image {
+				image[k] -= math.Floor(image[k])
+			}
+
+			duplicate := false
+			for _, existing := range images {
+				if periodicDistance(metric, image, existing) < symmetryMergeTolerance {
+					duplicate = true
+					break
+				}
+			}
+			if duplicate {
+				continue
+			}
+
+			images = append(images, image)
+
+			atom := site
+			if len(images) > 1 {
+				n := len(images)
+				for used[fmt.Sprintf("%s_%d", site.Label, n)] {
+					n++
+				}
+				atom.Label = fmt.Sprintf("%s_%d", site.Label, n)
+				atom.Parent = site.Label
+				used[atom.Label] = true
+			}
+			atom.FractX, atom.FractY, atom.FractZ = image[0], image[1], image[2]
+			expanded.DataBlock.AtomSites = append(expanded.DataBlock.AtomSites, atom)
+
+			if row, ok := anisoRows[site.Label]; ok {
+				expandedADPs = append(expandedADPs, aniso.transform(row, atom.Label, op, reciprocal))
+			}
+		}
+	}
+
+	if aniso != nil {
+		expanded.DataBlock.Loops = append([]types.CIFLoop(nil), cif.DataBlock.Loops...)
+		expanded.DataBlock.Loops[aniso.index] = types.CIFLoop{
+			Tags: cif.DataBlock.Loops[aniso.index].Tags,
+			Rows: expandedADPs,
+		}
+	}
+
+	// The expanded structure is described in P1
+	expanded.DataBlock.Metadata = make(map[string]string)
+	for tag, value := range cif.DataBlock.Metadata {
+		if !containsFold(spaceGroupTags, normalizeTag(tag)) {
+			expanded.DataBlock.Metadata[tag] = value
+		}
+	}
+	expanded.DataBlock.Metadata["_symmetry_space_group_name_H-M"] = "P 1"
+	expanded.DataBlock.Metadata["_symmetry_Int_Tables_number"] = "1"
+	expanded.DataBlocks = []types.CIFDataBlock{expanded.DataBlock}
+
+	return expanded, nil
+}
+
+// periodicDistance returns the minimum-image distance between two fractional
+// positions using the cell metric tensor
+func periodicDistance(metric [3][3]float64, a, b [3]float64) float64 {
+	var d [3]float64
+	for k := range d {
+		d[k] = a[k] - b[k]
+		d[k] -= math.Round(d[k])
+	}
+
+	var sq float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			sq += d[i] * metric[i][j] * d[j]
+		}
+	}
+
+	return math.Sqrt(math.Max(sq, 0))
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"dftbopt-mcp/go-service/internal/types"
+)
+
+func TestParseSymmetryExpression(t *testing.T) {
+	tests := []struct {
+		expr  string
+		row   [3]float64
+		shift float64
+		err   bool
+	}{
+		{"x", [3]float64{1, 0, 0}, 0, false},
+		{"-y", [3]float64{0, -1, 0}, 0, false},
+		{"z+1/2", [3]float64{0, 0, 1}, 0.5, false},
+		{"1/2+Z", [3]float64{0, 0, 1}, 0.5, false},
+		{"x-y", [3]float64{1, -1, 0}, 0, false},
+		{"-x + 3/4", [3]float64{-1, 0, 0}, 0.75, false},
+		{"2*x", [3]float64{2, 0, 0}, 0, false},
+		{"y+0.25", [3]float64{0, 1, 0}, 0.25, false},
+		{"-1/3-x+y", [3]float64{-1, 1, 0}, -1.0 / 3, false},
+		{"", [3]float64{}, 0, true},
+		{"x+a", [3]float64{}, 0, true},
+		{"x+1/0", [3]float64{}, 0, true},
+	}
+	for _, tt := range tests {
+		row, shift, err := parseSymmetryExpression(tt.expr)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: error %v, want error %v", tt.expr, err, tt.err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if row != tt.row || !approxEqual(shift, tt.shift, 1e-12) {
+			t.Errorf("%q: got %v %+v, want %v %+v", tt.expr, row, shift, tt.row, tt.shift)
+		}
+	}
+}
+
+func TestParseSymmetryOperationString(t *testing.T) {
+	tests := []struct {
+		value string
+		want  types.SymmetryOperation
+		err   bool
+	}{
+		{"x,y,z", types.SymmetryOperation{X: "x", Y: "y", Z: "z"}, false},
+		{" -x, y+1/2 ,-z ", types.SymmetryOperation{X: "-x", Y: "y+1/2", Z: "-z"}, false},
+		{"x,y", types.SymmetryOperation{}, true},
+		{"x,y,z,x", types.SymmetryOperation{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSymmetryOperationString(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: error %v, want error %v", tt.value, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExpandSymmetry(t *testing.T) {
+	inversion := []types.SymmetryOperation{{X: "x", Y: "y", Z: "z"}, {X: "-x", Y: "-y", Z: "-z"}}
+	tests := []struct {
+		name    string
+		sites   []types.AtomSite
+		labels  []string
+		parents []string
+	}{
+		{
+			name:    "general position",
+			sites:   []types.AtomSite{{Label: "C1", FractX: 0.1, FractY: 0.2, FractZ: 0.3}},
+			labels:  []string{"C1", "C1_2"},
+			parents: []string{"", "C1"},
+		},
+		{
+			// The copy of O1 must not take the label of the site O1_2
+			name: "copy label taken by another site",
+			sites: []types.AtomSite{
+				{Label: "O1", FractX: 0.1, FractY: 0.2, FractZ: 0.3},
+				{Label: "O1_2", FractX: 0.3, FractY: 0.2, FractZ: 0.1},
+			},
+			labels:  []string{"O1", "O1_3", "O1_2", "O1_2_2"},
+			parents: []string{"", "O1", "", "O1_2"},
+		},
+		{
+			name:   "inversion centre",
+			sites:  []types.AtomSite{{Label: "Na1", FractX: 0, FractY: 0, FractZ: 0}},
+			labels: []string{"Na1"},
+		},
+		{
+			name:   "special position on the cell face",
+			sites:  []types.AtomSite{{Label: "Cl1", FractX: 0.5, FractY: 0, FractZ: 0.5}},
+			labels: []string{"Cl1"},
+		},
+		{
+			name:   "images within the merge tolerance across the boundary",
+			sites:  []types.AtomSite{{Label: "O1", FractX: 0.001, FractY: 0.5, FractZ: 0}},
+			labels: []string{"O1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := cubicBlock(10, tt.sites)
+			block.Symmetry = inversion
+			block.Metadata = map[string]string{"_symmetry_space_group_name_H-M": "P -1", "_journal_year": "2020"}
+			expanded, err := NewCIFParser().ExpandSymmetry(&types.CIFFile{DataBlock: block})
+			if err != nil {
+				t.Fatalf("ExpandSymmetry: %v", err)
+			}
+
+			var labels, parents []string
+			for _, site := range expanded.DataBlock.AtomSites {
+				labels = append(labels, site.Label)
+				parents = append(parents, site.Parent)
+				for _, frac := range []float64{site.FractX, site.FractY, site.FractZ} {
+					if frac < 0 || frac >= 1 {
+						t.Errorf("site %s not wrapped into the cell: %+v", site.Label, site)
+					}
+				}
+			}
+			if strings.Join(labels, " ") != strings.Join(tt.labels, " ") {
+				t.Errorf("got sites %v, want %v", labels, tt.labels)
+			}
+			if tt.parents == nil {
+				tt.parents = make([]string, len(tt.labels))
+			}
+			if !reflect.DeepEqual(parents, tt.parents) {
+				t.Errorf("got parents %q, want %q", parents, tt.parents)
+			}
+			if got := expanded.DataBlock.Metadata["_symmetry_space_group_name_H-M"]; got != "P 1" {
+				t.Errorf("space group after expansion is %q, want P 1", got)
+			}
+			if expanded.DataBlock.Metadata["_journal_year"] != "2020" {
+				t.Errorf("unrelated metadata dropped")
+			}
+			if len(expanded.DataBlock.Symmetry) != 1 {
+				t.Errorf("expected only the identity operation, got %v", expanded.DataBlock.Symmetry)
+			}
+		})
+	}
+}
+
+func TestExpandSymmetryInvalidOperation(t *testing.T) {
+	block := cubicBlock(5, []types.AtomSite{{Label: "C1"}})
+	block.Symmetry = []types.SymmetryOperation{{X: "x", Y: "y", Z: "w"}}
+	if _, err := NewCIFParser().ExpandSymmetry(&types.CIFFile{DataBlock: block}); err == nil {
+		t.Errorf("expected an error for an invalid operation")
+	}
+}
+
+// cubicBlock returns a data block with a cubic cell of edge a
+func cubicBlock(a float64, sites []types.AtomSite) types.CIFDataBlock {
+	return types.CIFDataBlock{
+		Name:       "test",
+		CellLength: map[string]float64{"_cell_length_a": a, "_cell_length_b": a, "_cell_length_c": a},
+		CellAngle:  map[string]float64{"_cell_angle_alpha": 90, "_cell_angle_beta": 90, "_cell_angle_gamma": 90},
+		AtomSites:  sites,
+	}
+}
@@ -0,0 +1,395 @@
+// Package skparams knows the Slater-Koster parameter sets available to the
+// SK-based DFTB methods, the elements each set covers and their per-element
+// settings
+package skparams
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SK-based methods
+const (
+	MethodDFTB  = "DFTB"  // Second-order SCC-DFTB
+	MethodDFTB3 = "DFTB3" // Third-order DFTB
+)
+
+// RegistryFile is an optional file in the parameter root that declares
+// additional parameter sets or overrides built-in ones
+const RegistryFile = "registry.json"
+
+// ElementParameters holds the per-element settings of a parameter set
+type ElementParameters struct {
+	MaxAngularMomentum string   `json:"max_angular_momentum"`         // "s", "p", "d" or "f"
+	HubbardDerivative  *float64 `json:"hubbard_derivative,omitempty"` // Atomic units; required by DFTB3
+}
+
+// ParameterSet describes a set of Slater-Koster files
+type ParameterSet struct {
+	Name           string                       `json:"name"`
+	Aliases        []string                     `json:"aliases,omitempty"`
+	Directory      string                       `json:"directory,omitempty"` // Relative to the parameter root; the name when empty
+	Separator      string                       `json:"separator,omitempty"` // Between the element names of a file; "-" when empty
+	Suffix         string                       `json:"suffix,omitempty"`    // ".skf" when empty
+	DampXHExponent float64                      `json:"damp_xh_exponent,omitempty"`
+	Elements       map[string]ElementParameters `json:"elements"`
+}
+
+// builtinSets are the parameter sets distributed by dftb.org whose element
+// settings are known without reading the files
+var builtinSets = []ParameterSet{
+	{
+		Name:    "mio-1-1",
+		Aliases: []string{"mio"},
+		Elements: map[string]ElementParameters{
+			"H": {MaxAngularMomentum: "s"},
+			"C": {MaxAngularMomentum: "p"},
+			"N": {MaxAngularMomentum: "p"},
+			"O": {MaxAngularMomentum: "p"},
+			"P": {MaxAngularMomentum: "d"},
+			"S": {MaxAngularMomentum: "d"},
+		},
+	},
+	{
+		Name:           "3ob-3-1",
+		Aliases:        []string{"3ob"},
+		DampXHExponent: 4.00,
+		Elements: map[string]ElementParameters{
+			"Br": {MaxAngularMomentum: "d", HubbardDerivative: hubbard(-0.0573)},
+			"C":  {MaxAngularMomentum: "p", HubbardDerivative: hubbard(-0.1492)},
+			"Ca": {MaxAngularMomentum: "p", HubbardDerivative: hubbard(-0.0340)},
+			"Cl": {MaxAngularMomentum: "d", HubbardDerivative: hubbard(-0.0697)},
+			"F":  {MaxAngularMomentum: "p", HubbardDerivative: hubbard(-0.1623)},
+			"H":  {MaxAngularMomentum: "s", HubbardDerivative: hubbard(-0.1857)},
+			"I":  {MaxAngularMomentum: "d", HubbardDerivative: hubbard(-0.0433)},
+			"K":  {MaxAngularMomentum: "p", HubbardDerivative: hubbard(-0.0339)},
+			"Mg": {MaxAngularMomentum: "p", HubbardDerivative: hubbard(-0.02)},
+			"N":  {MaxAngularMomentum: "p", HubbardDerivative: hubbard(-0.1535)},
+			"Na": {MaxAngularMomentum: "p", HubbardDerivative: hubbard(-0.0454)},
+			"O":  {MaxAngularMomentum: "p", HubbardDerivative: hubbard(-0.1575)},
+			"P":  {MaxAngularMomentum: "d", HubbardDerivative: hubbard(-0.14)},
+			"S":  {MaxAngularMomentum: "d", HubbardDerivative: hubbard(-0.11)},
+			"Zn": {MaxAngularMomentum: "d", HubbardDerivative: hubbard(-0.03)},
+		},
+	},
+}
+
+// hubbard returns a pointer to a Hubbard derivative
+func hubbard(value float64) *float64 {
+	return &value
+}
+
+// defaultSets are the parameter sets used when a request names none
+var defaultSets = map[string]string{
+	MethodDFTB:  "mio-1-1",
+	MethodDFTB3: "3ob-3-1",
+}
+
+// IsSKMethod reports whether a method needs Slater-Koster files
+func IsSKMethod(method string) bool {
+	return method == MethodDFTB || method == MethodDFTB3
+}
+
+// DefaultSet returns the parameter set used by a method when none is given
+func DefaultSet(method string) string {
+	return defaultSets[method]
+}
+
+// Registry resolves parameter set names below a parameter root directory
+type Registry struct {
+	root string
+	sets map[string]*ParameterSet
+}
+
+// NewRegistry creates a registry of the built-in parameter sets, the sets
+// declared in the registry file of the root and, for every other
+// subdirectory of the root, a set discovered from its homonuclear files.
+// A relative root is made absolute, since DFTB+ runs in the job directory.
+func NewRegistry(root string) (*Registry, error) {
+	registry := &Registry{sets: make(map[string]*ParameterSet)}
+	for i := range builtinSets {
+		set := builtinSets[i]
+		registry.add(&set)
+	}
+	if root == "" {
+		return registry, nil
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameter root: %v", err)
+	}
+	registry.root = root
+
+	content, err := os.ReadFile(filepath.Join(root, RegistryFile))
+	switch {
+	case err == nil:
+		var declared []ParameterSet
+		if err := json.Unmarshal(content, &declared); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", RegistryFile, err)
+		}
+		for i := range declared {
+			set := declared[i]
+			if set.Name == "" {
+				return nil, fmt.Errorf("invalid %s: parameter set %d has no name", RegistryFile, i+1)
+			}
+			registry.add(&set)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read %s: %v", RegistryFile, err)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parameter root: %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || registry.sets[strings.ToLower(entry.Name())] != nil {
+			continue
+		}
+		if set := discoverSet(filepath.Join(root, entry.Name()), entry.Name()); set != nil {
+			registry.add(set)
+		}
+	}
+
+	return registry, nil
+}
+
+// add registers a set under its name and aliases, replacing earlier sets
+func (r *Registry) add(set *ParameterSet) {
+	if set.Directory == "" {
+		set.Directory = set.Name
+	}
+	if set.Separator == "" {
+		set.Separator = "-"
+	}
+	if set.Suffix == "" {
+		set.Suffix = ".skf"
+	}
+	r.sets[strings.ToLower(set.Name)] = set
+	for _, alias := range set.Aliases {
+		r.sets[strings.ToLower(alias)] = set
+	}
+}
+
+// Lookup returns a parameter set by name or alias
+func (r *Registry) Lookup(name string) (*ParameterSet, bool) {
+	set, ok := r.sets[strings.ToLower(name)]
+	return set, ok
+}
+
+// Names returns the names of the registered parameter sets
+func (r *Registry) Names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, set := range r.sets {
+		if !seen[set.Name] {
+			seen[set.Name] = true
+			names = append(names, set.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Directory returns the absolute directory holding the files of a set
+func (r *Registry) Directory(set *ParameterSet) string {
+	if filepath.IsAbs(set.Directory) {
+		return set.Directory
+	}
+	return filepath.Join(r.root, set.Directory)
+}
+
+// Resolve checks that a parameter set covers every element, supports the
+// method and is installed, and returns it
+func (r *Registry) Resolve(name, method string, elementList []string) (*ParameterSet, error) {
+	if name == "" {
+		name = DefaultSet(method)
+	}
+	set, ok := r.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter set %q; available sets: %s", name, strings.Join(r.Names(), ", "))
+	}
+
+	var missing, noDerivative []string
+	for _, element := range elementList {
+		params, ok := set.Elements[element]
+		if !ok {
+			missing = append(missing, element)
+			continue
+		}
+		if method == MethodDFTB3 && params.HubbardDerivative == nil {
+			noDerivative = append(noDerivative, element)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("parameter set %s does not cover %s", set.Name, strings.Join(missing, ", "))
+	}
+	if len(noDerivative) > 0 {
+		return nil, fmt.Errorf("parameter set %s has no Hubbard derivatives for %s, which %s requires", set.Name, strings.Join(noDerivative, ", "), MethodDFTB3)
+	}
+
+	if r.root == "" && !filepath.IsAbs(set.Directory) {
+		return nil, fmt.Errorf("no Slater-Koster parameter directory is configured")
+	}
+	dir := r.Directory(set)
+	for _, a := range elementList {
+		for _, b := range elementList {
+			path := filepath.Join(dir, a+set.Separator+b+set.Suffix)
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("parameter set %s is missing %s", set.Name, filepath.Base(path))
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// homonuclearFile matches Slater-Koster files such as "C-C.skf"
+var homonuclearFile = regexp.MustCompile(`^([A-Z][a-z]?)-([A-Z][a-z]?)\.skf$`)
+
+// discoverSet builds a set from the homonuclear files of a directory, reading
+// the maximal angular momentum of every element from its file. Directories
+// without such files are not parameter sets.
+func discoverSet(dir, name string) *ParameterSet {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	set := &ParameterSet{Name: name, Elements: make(map[string]ElementParameters)}
+	for _, entry := range entries {
+		match := homonuclearFile.FindStringSubmatch(entry.Name())
+		if match == nil || match[1] != match[2] {
+			continue
+		}
+		momentum, err := ReadMaxAngularMomentum(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		set.Elements[match[1]] = ElementParameters{MaxAngularMomentum: momentum}
+	}
+	if len(set.Elements) == 0 {
+		return nil
+	}
+
+	return set
+}
+
+// skfShellColumns lists, for each shell from s upwards, the integral columns
+// of the Hamiltonian (and, in the same position after them, the overlap)
+// table of a homonuclear Slater-Koster file that involve that shell as the
+// highest one. The simple format orders the ten columns as Hdd0 Hdd1 Hdd2
+// Hpd0 Hpd1 Hpp0 Hpp1 Hsd0 Hsp0 Hss0; the extended format has twenty, from
+// Hff0 down to Hss0.
+var skfShellColumns = map[bool][][]int{
+	false: {{9}, {5, 6, 8}, {0, 1, 2, 3, 4, 7}},
+	true:  {{19}, {14, 15, 18}, {7, 8, 9, 12, 13, 17}, {0, 1, 2, 3, 4, 5, 6, 10, 11, 16}},
+}
+
+// ReadMaxAngularMomentum reads the highest shell of the basis of a
+// homonuclear Slater-Koster file: the highest shell with a non-zero
+// Hamiltonian or overlap integral. The occupations cannot be used, since
+// elements such as P, S, Si and Cl carry empty polarization d shells.
+// Extended format files, marked by a leading '@', include f shells.
+func ReadMaxAngularMomentum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	name := filepath.Base(path)
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return "", fmt.Errorf("%s is empty", name)
+	}
+	extended := strings.HasPrefix(scanner.Text(), "@")
+	if extended {
+		// The first line only marks the format
+		if !scanner.Scan() {
+			return "", fmt.Errorf("%s is too short", name)
+		}
+	}
+
+	grid, err := skfFields(scanner.Text())
+	if err != nil || len(grid) < 2 || grid[1] < 1 {
+		return "", fmt.Errorf("%s: expected the grid distance and number of grid points", name)
+	}
+	points := int(grid[1])
+
+	// Skip the on-site energies and the mass line
+	for i := 0; i < 2; i++ {
+		if !scanner.Scan() {
+			return "", fmt.Errorf("%s is too short", name)
+		}
+	}
+
+	shells := skfShellColumns[extended]
+	columns := 20
+	if extended {
+		columns = 40
+	}
+	present := make([]bool, len(shells))
+	for row := 0; row < points && scanner.Scan(); row++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(strings.ToLower(line), "spline") {
+			break
+		}
+		values, err := skfFields(line)
+		if err != nil {
+			return "", fmt.Errorf("%s: integral table row %d: %v", name, row+1, err)
+		}
+		if len(values) != columns {
+			return "", fmt.Errorf("%s: integral table row %d has %d values, expected %d", name, row+1, len(values), columns)
+		}
+		for l, indices := range shells {
+			for _, i := range indices {
+				if values[i] != 0 || values[i+columns/2] != 0 {
+					present[l] = true
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", name, err)
+	}
+
+	for l := len(present) - 1; l >= 0; l-- {
+		if present[l] {
+			return string("spdf"[l]), nil
+		}
+	}
+	return "", fmt.Errorf("%s: no non-zero integrals", name)
+}
+
+// skfFields parses the numbers of a Slater-Koster file line. Values may be
+// separated by commas and repeated with the Fortran "n*value" notation.
+func skfFields(line string) ([]float64, error) {
+	var values []float64
+	for _, field := range strings.Fields(strings.ReplaceAll(line, ",", " ")) {
+		count := 1
+		if repeat, value, ok := strings.Cut(field, "*"); ok {
+			n, err := strconv.Atoi(repeat)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid repeat %q", field)
+			}
+			count, field = n, value
+		}
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", field)
+		}
+		for i := 0; i < count; i++ {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,195 @@
+package skparams
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadMaxAngularMomentum(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		// S has an empty d shell in its occupations but d integrals
+		{"S-S.skf", "d"},
+		{"H-H.skf", "s"},
+	}
+	for _, tt := range tests {
+		got, err := ReadMaxAngularMomentum(filepath.Join("testdata", "matsci-0-3", tt.file))
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestReadMaxAngularMomentumFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		err     string
+	}{
+		{
+			name:    "p shell",
+			content: "0.02 2\n0 -0.2 -0.5 0 0 0.4 0.5 0 2 2\n12.0 19*0\n20*0.0\n5*0 -0.1 0.2 0 0.3 -0.4 5*0 0.1 -0.2 0 -0.3 0.4\n",
+			want:    "p",
+		},
+		{
+			name: "extended format with f shell",
+			content: "@ extended format\n0.02 1\n" +
+				"-0.1 -0.2 -0.3 -0.4 0 0.1 0.2 0.3 0.4 1 2 6 2\n140.1 19*0\n" +
+				"0.01 39*0.0\n",
+			want: "f",
+		},
+		{
+			name: "extended format with d shell",
+			content: "@\n0.02 1\n" +
+				"0 -0.2 -0.3 -0.4 0 0 0.2 0.3 0.4 0 2 6 2\n48.0 19*0\n" +
+				"7*0 0.05 11*0 -0.3 7*0 0.02 11*0 0.9\n",
+			want: "d",
+		},
+		{
+			name:    "short row",
+			content: "0.02 1\n0 0 -0.2 0 0 0 0.4 0 0 1\n1.0 19*0\n0.1 0.2\n",
+			err:     "has 2 values, expected 20",
+		},
+		{
+			name:    "no integrals",
+			content: "0.02 1\n0 0 -0.2 0 0 0 0.4 0 0 1\n1.0 19*0\n20*0.0\n",
+			err:     "no non-zero integrals",
+		},
+		{
+			name:    "invalid repeat",
+			content: "0.02 1\n0 0 -0.2 0 0 0 0.4 0 0 1\n1.0 19*0\nx*0.0\n",
+			err:     "invalid repeat",
+		},
+		{
+			name:    "missing grid",
+			content: "0.02\n",
+			err:     "number of grid points",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "X-X.skf")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadMaxAngularMomentum(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %q, error %v, want an error containing %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadMaxAngularMomentum: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRegistryDiscovery(t *testing.T) {
+	registry, err := NewRegistry("testdata")
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	set, ok := registry.Lookup("matsci-0-3")
+	if !ok {
+		t.Fatalf("set not discovered; registered sets: %v", registry.Names())
+	}
+	if got := set.Elements["S"].MaxAngularMomentum; got != "d" {
+		t.Errorf("S: got %q, want d", got)
+	}
+	if got := set.Elements["H"].MaxAngularMomentum; got != "s" {
+		t.Errorf("H: got %q, want s", got)
+	}
+
+	if _, err := registry.Resolve("matsci-0-3", MethodDFTB, []string{"H", "S"}); err == nil || !strings.Contains(err.Error(), "missing H-S.skf") {
+		t.Errorf("expected the missing heteronuclear file to be reported, got %v", err)
+	}
+	if _, err := registry.Resolve("matsci-0-3", MethodDFTB3, []string{"S"}); err == nil || !strings.Contains(err.Error(), "no Hubbard derivatives") {
+		t.Errorf("expected DFTB3 to require Hubbard derivatives, got %v", err)
+	}
+}
+
+func TestRegistryRelativeRoot(t *testing.T) {
+	registry, err := NewRegistry("testdata")
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	set, err := registry.Resolve("matsci-0-3", MethodDFTB, []string{"S"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	// DFTB+ runs in the job directory, so the prefix must not depend on the
+	// working directory of the server
+	want, err := filepath.Abs(filepath.Join("testdata", "matsci-0-3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir := registry.Directory(set); dir != want {
+		t.Errorf("got directory %q, want %q", dir, want)
+	}
+}
+
+func TestNewRegistryFile(t *testing.T) {
+	root := t.TempDir()
+	registry := `[{"name": "custom", "aliases": ["c"], "directory": "files", "elements": {"S": {"max_angular_momentum": "d", "hubbard_derivative": -0.11}}}]`
+	if err := os.WriteFile(filepath.Join(root, RegistryFile), []byte(registry), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "files"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "files", "S-S.skf"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := NewRegistry(root)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	set, err := reg.Resolve("C", MethodDFTB3, []string{"S"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if set.Name != "custom" || set.Separator != "-" || set.Suffix != ".skf" || set.Elements["S"].MaxAngularMomentum != "d" {
+		t.Errorf("declared set resolved as %+v", set)
+	}
+	if _, ok := reg.Lookup("files"); ok {
+		t.Errorf("the directory of a declared set was also discovered as a set")
+	}
+}
+
+func TestResolveBuiltinSets(t *testing.T) {
+	registry, err := NewRegistry("")
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	tests := []struct {
+		name, method string
+		elements     []string
+		err          string
+	}{
+		{"", MethodDFTB, []string{"Zn"}, "mio-1-1 does not cover Zn"},
+		{"unknown", MethodDFTB, []string{"H"}, "unknown parameter set"},
+		{"3ob", MethodDFTB3, []string{"H", "O"}, "no Slater-Koster parameter directory"},
+	}
+	for _, tt := range tests {
+		if _, err := registry.Resolve(tt.name, tt.method, tt.elements); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Resolve(%q, %s, %v): got %v, want an error containing %q", tt.name, tt.method, tt.elements, err, tt.err)
+		}
+	}
+}
@@ -2,47 +2,249 @@ package types
 
 // OptimizationRequest represents the request for DFTB+ optimization
 type OptimizationRequest struct {
-	RequestID       string  `json:"request_id" binding:"required"`
-	StructureFile   string  `json:"structure_file" binding:"required"`   // Base64 encoded CIF content
-	Method          string  `json:"method" binding:"required"`           // "GFN1-xTB" or "GFN2-xTB"
-	Fmax            float64 `json:"fmax" binding:"required,min=0.001"`   // Force convergence threshold
-	OriginalFilename string `json:"original_filename,omitempty"`         // Optional original filename
+	RequestID            string           `json:"request_id" binding:"required"`
+	StructureFile        string           `json:"structure_file" binding:"required"` // Base64 encoded structure file content
+	InputFormat          string           `json:"input_format,omitempty"`            // "cif" (default), "extxyz" or "poscar"
+	OutputFormat         string           `json:"output_format,omitempty"`           // Additional output format besides CIF: "extxyz" or "poscar"
+	Method               string           `json:"method" binding:"required"`         // "GFN1-xTB", "GFN2-xTB", "DFTB" or "DFTB3"
+	ParameterSet         string           `json:"parameter_set,omitempty"`           // Slater-Koster set of DFTB and DFTB3; mio-1-1 and 3ob-3-1 by default
+	ThirdOrderFull       *bool            `json:"third_order_full,omitempty"`        // DFTB3 only; full third-order expansion, on by default
+	DampXH               *bool            `json:"damp_xh,omitempty"`                 // DFTB3 only; X-H damping, on by default when the set defines an exponent
+	LatticeOpt           bool             `json:"lattice_opt,omitempty"`             // Relax the cell along with the atoms; periodic structures only
+	LatticeMode          string           `json:"lattice_mode,omitempty"`            // "full" (default), "isotropic" or "fixed_angles"; requires lattice_opt
+	PressureGPa          float64          `json:"pressure_gpa,omitempty"`            // External pressure in GPa; requires lattice_opt
+	Constraints          []AtomConstraint `json:"constraints,omitempty"`             // Atoms or axes kept fixed during the optimization
+	KPoints              *KPointSettings  `json:"kpoints,omitempty"`                 // K-point sampling of periodic systems; a Monkhorst-Pack grid at 0.3 1/Angstrom by default
+	Fmax                 float64          `json:"fmax" binding:"required,min=0.001"` // Force convergence threshold
+	OriginalFilename     string           `json:"original_filename,omitempty"`       // Optional original filename
+	DataBlock            string           `json:"data_block,omitempty"`              // Optional name of the CIF data block to optimize
+	DataBlockIndex       *int             `json:"data_block_index,omitempty"`        // Optional zero-based index of the CIF data block to optimize
+	Batch                bool             `json:"batch,omitempty"`                   // Optimize every data block as its own job
+	DisorderPolicy       string           `json:"disorder_policy,omitempty"`         // "reject", "highest_occupancy" or "group"; server default when empty
+	DisorderGroup        string           `json:"disorder_group,omitempty"`          // Disorder group to keep with the "group" policy
+	IncludeCIFProperties bool             `json:"include_cif_properties,omitempty"`  // Add computed properties to the optimized CIF as custom loops
+	IncludeCIFCharges    bool             `json:"include_cif_charges,omitempty"`     // Add Mulliken charges to the optimized CIF as _atom_site_charge
+	DOS                  bool             `json:"dos,omitempty"`                     // Return a Gaussian-broadened density of states
+	DOSBroadening        float64          `json:"dos_broadening,omitempty"`          // Gaussian width in eV; 0.1 eV when not set
+}
+
+// AtomConstraint fixes a selection of atoms along some or all Cartesian
+// axes. Atoms must match every selector given; within a list any entry
+// matches.
+type AtomConstraint struct {
+	Indices  []int             `json:"indices,omitempty"`  // 1-based indices in the expanded (P1) structure
+	Labels   []string          `json:"labels,omitempty"`   // Atom site labels; symmetry copies of a site are included
+	Elements []string          `json:"elements,omitempty"` // Element symbols
+	Region   *ConstraintRegion `json:"region,omitempty"`   // Spatial selection
+	Axes     []string          `json:"axes,omitempty"`     // Fixed axes "x", "y" and "z"; all when empty
+}
+
+// ConstraintRegion selects atoms by Cartesian coordinate, either inside a
+// range or in the outermost layers of a slab
+type ConstraintRegion struct {
+	Axis           string   `json:"axis"`                      // "x", "y" or "z"
+	Min            *float64 `json:"min,omitempty"`             // Lower bound in Angstrom
+	Max            *float64 `json:"max,omitempty"`             // Upper bound in Angstrom
+	Layers         int      `json:"layers,omitempty"`          // Number of atomic layers, instead of min/max
+	From           string   `json:"from,omitempty"`            // "bottom" (default) or "top"
+	LayerTolerance float64  `json:"layer_tolerance,omitempty"` // Largest coordinate gap within a layer; 0.5 Angstrom by default
+}
+
+// KPointSettings overrides the automatic k-point sampling of a request
+type KPointSettings struct {
+	Scheme  string      `json:"scheme,omitempty"`  // "monkhorst_pack" (default), "supercell_folding" or "gamma"
+	Spacing float64     `json:"spacing,omitempty"` // Target spacing in 1/Angstrom, including 2π
+	Grid    *[3]int     `json:"grid,omitempty"`    // Explicit grid, instead of one derived from the spacing
+	Shift   *[3]float64 `json:"shift,omitempty"`   // Fractional grid shift; supercell_folding only
+}
+
+// KPointSampling represents the k-point grid used by a calculation
+type KPointSampling struct {
+	Scheme      string     `json:"scheme"`
+	Grid        [3]int     `json:"grid"`
+	Shift       [3]float64 `json:"shift"`
+	SpacingPerA float64    `json:"spacing_per_A,omitempty"` // Spacing the grid was derived from, if any
 }
 
 // OptimizationResponse represents the response from DFTB+ optimization
 type OptimizationResponse struct {
-	Status        string                 `json:"status"`                   // "success" or "error"
-	RequestID     string                 `json:"request_id"`
-	ParsedData    map[string]interface{} `json:"parsed_data,omitempty"`    // Parsed DFTB+ output
-	OutputCIFPath string                 `json:"output_cif_path,omitempty"` // Path to optimized CIF file (base64 encoded)
-	ErrorMessage  string                 `json:"error_message,omitempty"`   // Error message if failed
+	Status              string                 `json:"status"` // "success", "partial" (batch only) or "error"
+	RequestID           string                 `json:"request_id"`
+	DataBlock           string                 `json:"data_block,omitempty"`           // Name of the optimized CIF data block
+	ParsedData          *DFTBOutput            `json:"parsed_data,omitempty"`          // Parsed DFTB+ output
+	OutputCIFPath       string                 `json:"output_cif_path,omitempty"`      // Path to optimized CIF file (base64 encoded)
+	OutputFormat        string                 `json:"output_format,omitempty"`        // Format of OutputStructure
+	OutputStructure     string                 `json:"output_structure,omitempty"`     // Optimized structure in the requested output format (base64 encoded)
+	ConnectivityChanged bool                   `json:"connectivity_changed,omitempty"` // Bonds were formed or broken during the optimization
+	ErrorMessage        string                 `json:"error_message,omitempty"`        // Error message if failed
+	ErrorCode           string                 `json:"error_code,omitempty"`           // Machine-readable DFTB+ failure class
+	RemediationHint     string                 `json:"remediation_hint,omitempty"`     // Suggested fix for ErrorCode
+	Results             []OptimizationResponse `json:"results,omitempty"`              // Per-block results in batch mode
 }
 
 // DFTBOutput represents the parsed output from DFTB+ calculation
 type DFTBOutput struct {
 	Summary struct {
-		Warnings           []string `json:"warnings"`
-		ConvergenceStatus  string   `json:"convergence_status"`
-		CalculationStatus  string   `json:"calculation_status"`
-		Error              string   `json:"error,omitempty"`
+		Warnings          []string `json:"warnings"`
+		ConvergenceStatus string   `json:"convergence_status"` // "converged", "not_converged" or "scc_not_converged"
+		CalculationStatus string   `json:"calculation_status"`
+		Error             string   `json:"error,omitempty"`
 	} `json:"summary"`
-	
+
 	ConvergenceInfo struct {
-		SCCConverged bool `json:"scc_converged"`
+		SCCConverged      bool    `json:"scc_converged"`
+		GeometryConverged bool    `json:"geometry_converged"`  // Driver reached the force criterion
+		MaxStepsReached   bool    `json:"max_steps_reached"`   // Driver stopped at MaxSteps
+		GeometrySteps     int     `json:"geometry_steps"`      // Number of geometry steps taken, including the initial one
+		MaxSteps          int     `json:"max_steps,omitempty"` // Geometry step limit of the driver
+		ForceCriterionEVA float64 `json:"force_criterion_eV_A,omitempty"`
 	} `json:"convergence_info"`
-	
+
 	ElectronicProperties struct {
 		FermiLevelEV      float64 `json:"fermi_level_eV,omitempty"`
 		TotalCharge       float64 `json:"total_charge,omitempty"`
+		NumberOfElectrons float64 `json:"number_of_electrons,omitempty"`
 		DipoleMomentDebye struct {
 			X float64 `json:"x"`
 			Y float64 `json:"y"`
 			Z float64 `json:"z"`
 		} `json:"dipole_moment_debye,omitempty"`
 	} `json:"electronic_properties,omitempty"`
-	
-	EnergiesEV     map[string]float64 `json:"energies_eV"`
+
+	EnergiesEV      map[string]float64 `json:"energies_eV"`
 	EnergiesHartree map[string]float64 `json:"energies_hartree"`
+
+	Forces struct {
+		MaxForceEVA     float64 `json:"max_force_eV_A"`     // Largest atomic force norm
+		RMSForceEVA     float64 `json:"rms_force_eV_A"`     // Root mean square of the atomic force norms
+		MaxComponentEVA float64 `json:"max_component_eV_A"` // Largest force component, the DFTB+ convergence measure
+	} `json:"forces"`
+
+	Atoms []AtomResult `json:"atoms,omitempty"` // Per-atom results in atom site order
+
+	ElectronicStructure *ElectronicStructure `json:"electronic_structure,omitempty"` // Eigenvalue spectrum from band.out
+
+	Stress     *Stress         `json:"stress,omitempty"`      // Periodic systems only
+	CellChange *CellChange     `json:"cell_change,omitempty"` // Periodic systems only
+	KPoints    *KPointSampling `json:"kpoints,omitempty"`     // Periodic systems only
+
+	StructureComparison *StructureComparison `json:"structure_comparison,omitempty"` // Input versus optimized geometry
+}
+
+// StructureComparison compares the input and optimized geometries
+type StructureComparison struct {
+	RMSDA               float64            `json:"rmsd_A"`
+	MaxDisplacementA    float64            `json:"max_displacement_A"`
+	MaxDisplacementAtom string             `json:"max_displacement_atom,omitempty"`
+	ConnectivityChanged bool               `json:"connectivity_changed"`
+	BondsFormed         []BondChange       `json:"bonds_formed"`
+	BondsBroken         []BondChange       `json:"bonds_broken"`
+	Displacements       []AtomDisplacement `json:"displacements"` // Minimum-image displacements in atom site order
+}
+
+// AtomDisplacement represents how far one atom moved during an optimization
+type AtomDisplacement struct {
+	Label     string     `json:"label"`
+	Element   string     `json:"element"`
+	VectorA   [3]float64 `json:"vector_A"`
+	DistanceA float64    `json:"distance_A"`
+}
+
+// BondChange represents a bond formed or broken during an optimization,
+// judged from covalent radii
+type BondChange struct {
+	Atom1          string  `json:"atom1"`
+	Atom2          string  `json:"atom2"`
+	Index1         int     `json:"index1"`          // 1-based atom index
+	Index2         int     `json:"index2"`          // 1-based atom index
+	Image          *[3]int `json:"image,omitempty"` // Lattice translation of atom2, if not in the same cell
+	InitialLengthA float64 `json:"initial_length_A"`
+	FinalLengthA   float64 `json:"final_length_A"`
+}
+
+// Stress represents the stress tensor and pressure of a periodic calculation
+// at the final geometry
+type Stress struct {
+	TensorGPa   [][]float64 `json:"tensor_GPa,omitempty"` // 3x3, Cartesian axes
+	PressureGPa float64     `json:"pressure_GPa"`
+}
+
+// LatticeParameters represents the cell lengths, angles and volume of a lattice
+type LatticeParameters struct {
+	A        float64 `json:"a"`
+	B        float64 `json:"b"`
+	C        float64 `json:"c"`
+	Alpha    float64 `json:"alpha"`
+	Beta     float64 `json:"beta"`
+	Gamma    float64 `json:"gamma"`
+	VolumeA3 float64 `json:"volume_A3"`
+}
+
+// CellChange summarizes how the cell changed during an optimization
+type CellChange struct {
+	Initial             LatticeParameters `json:"initial"`
+	Final               LatticeParameters `json:"final"`
+	VolumeChangeA3      float64           `json:"volume_change_A3"`
+	VolumeChangePercent float64           `json:"volume_change_percent"`
+	StrainTensor        [][]float64       `json:"strain_tensor"` // Green-Lagrange strain, 3x3, Cartesian axes
+}
+
+// ElectronicStructure represents the eigenvalue spectrum of a calculation
+type ElectronicStructure struct {
+	HOMOEV      float64             `json:"homo_eV"`
+	LUMOEV      float64             `json:"lumo_eV"`
+	BandGapEV   float64             `json:"band_gap_eV"`   // Fundamental gap, 0 for metals
+	DirectGapEV float64             `json:"direct_gap_eV"` // Smallest gap at a single k-point and spin
+	GapType     string              `json:"gap_type"`      // "direct", "indirect", "metallic" or "undefined"
+	HOMOKPoint  int                 `json:"homo_kpoint"`   // 1-based k-point of the HOMO
+	LUMOKPoint  int                 `json:"lumo_kpoint"`   // 1-based k-point of the LUMO
+	HOMOSpin    int                 `json:"homo_spin"`     // 1-based spin channel of the HOMO
+	LUMOSpin    int                 `json:"lumo_spin"`     // 1-based spin channel of the LUMO
+	KPoints     []KPointEigenvalues `json:"kpoints"`
+	DOS         *DensityOfStates    `json:"dos,omitempty"`
+}
+
+// KPointEigenvalues represents the eigenvalues and occupations of one k-point
+// and spin channel
+type KPointEigenvalues struct {
+	KPoint        int       `json:"kpoint"` // 1-based
+	Spin          int       `json:"spin"`   // 1-based
+	Weight        float64   `json:"weight"`
+	EigenvaluesEV []float64 `json:"eigenvalues_eV"`
+	Occupations   []float64 `json:"occupations"`
+}
+
+// DensityOfStates represents a Gaussian-broadened density of states
+type DensityOfStates struct {
+	BroadeningEV float64   `json:"broadening_eV"`
+	EnergiesEV   []float64 `json:"energies_eV"`
+	States       []float64 `json:"states_per_eV"`
+}
+
+// AtomResult represents the per-atom results of a DFTB+ calculation
+type AtomResult struct {
+	Label          string     `json:"label"`
+	Element        string     `json:"element"`
+	MullikenCharge float64    `json:"mulliken_charge"` // Net atomic charge in e
+	ForceEVA       [3]float64 `json:"force_eV_A"`
+}
+
+// TrajectoryFrame represents a single geometry step of an optimization
+type TrajectoryFrame struct {
+	Step           int            `json:"step"`
+	EnergyEV       float64        `json:"energy_eV"`
+	MaxForceEVA    float64        `json:"max_force_eV_A"`            // Largest force component in eV/Angstrom
+	Elements       []string       `json:"elements,omitempty"`        // Per-atom elements
+	Coordinates    [][]float64    `json:"coordinates,omitempty"`     // Cartesian coordinates in Angstrom
+	LatticeVectors *[3][3]float64 `json:"lattice_vectors,omitempty"` // Cell of the step; nil when DFTB+ did not report it
+}
+
+// Trajectory represents the geometry steps of an optimization job
+type Trajectory struct {
+	RequestID      string            `json:"request_id"`
+	Periodic       bool              `json:"periodic"`
+	LatticeVectors [3][3]float64     `json:"lattice_vectors"` // Input lattice; frames carry the cell of each step
+	Frames         []TrajectoryFrame `json:"frames"`
 }
 
 // HealthResponse represents the health check response
@@ -61,34 +263,63 @@ type ServiceInfo struct {
 
 // ServerConfig represents the server configuration
 type ServerConfig struct {
-	Port         int    `json:"port"`
-	WorkDir      string `json:"work_dir"`
-	DFTBPath     string `json:"dftb_path"`
-	MaxRequests  int    `json:"max_requests"`
-	Timeout      int    `json:"timeout"` // in seconds
+	Port           int    `json:"port"`
+	WorkDir        string `json:"work_dir"`
+	DFTBPath       string `json:"dftb_path"`
+	MaxRequests    int    `json:"max_requests"`
+	Timeout        int    `json:"timeout"`         // in seconds
+	DisorderPolicy string `json:"disorder_policy"` // Default disorder policy for requests that do not set one
+	SKDir          string `json:"sk_dir"`          // Root directory of the Slater-Koster parameter sets
 }
 
 // CIFFile represents a parsed CIF file structure
 type CIFFile struct {
-	DataBlock struct {
-		Name        string                 `json:"name"`
-		CellLength  map[string]float64     `json:"cell_length"`
-		CellAngle   map[string]float64     `json:"cell_angle"`
-		AtomSites   []AtomSite            `json:"atom_sites"`
-		Symmetry    []SymmetryOperation   `json:"symmetry,omitempty"`
-		Metadata    map[string]string     `json:"metadata,omitempty"`
-	} `json:"data_block"`
+	DataBlock  CIFDataBlock   `json:"data_block"`            // Selected data block (the first one by default)
+	DataBlocks []CIFDataBlock `json:"data_blocks,omitempty"` // All data blocks in file order
+}
+
+// CIFDataBlock represents a single data_ block of a CIF file
+type CIFDataBlock struct {
+	Name           string              `json:"name"`
+	CellLength     map[string]float64  `json:"cell_length"`
+	CellAngle      map[string]float64  `json:"cell_angle"`
+	AtomSites      []AtomSite          `json:"atom_sites"`
+	Symmetry       []SymmetryOperation `json:"symmetry,omitempty"`
+	Metadata       map[string]string   `json:"metadata,omitempty"`
+	MetadataOrder  []string            `json:"metadata_order,omitempty"`  // Metadata tags in file order
+	Uncertainties  map[string]float64  `json:"uncertainties,omitempty"`   // Standard uncertainties of cell parameters, keyed by tag
+	Loops          []CIFLoop           `json:"loops,omitempty"`           // Loops not mapped onto atom sites or symmetry, e.g. anisotropic ADPs
+	AtomSiteTags   []string            `json:"atom_site_tags,omitempty"`  // Tags of the extra atom site columns in file order
+	NonPeriodic    bool                `json:"non_periodic,omitempty"`    // Molecule read from a non-periodic format; the cell is a bounding box
+	LatticeVectors *[3][3]float64      `json:"lattice_vectors,omitempty"` // Lattice matrix in the input orientation; nil when only cell parameters are known
+	Origin         [3]float64          `json:"origin"`                    // Cartesian position of the cell origin in the input frame; non-zero for molecules placed in a box
+}
+
+// CIFLoop represents a loop_ construct kept verbatim
+type CIFLoop struct {
+	Tags []string   `json:"tags"`
+	Rows [][]string `json:"rows"`
 }
 
 // AtomSite represents an atomic site in CIF format
 type AtomSite struct {
-	Label        string  `json:"label"`
-	TypeSymbol   string  `json:"type_symbol"`
-	FractX       float64 `json:"fract_x"`
-	FractY       float64 `json:"fract_y"`
-	FractZ       float64 `json:"fract_z"`
-	UIsoOrEquiv  float64 `json:"u_iso_or_equiv,omitempty"`
-	AdpType      string  `json:"adp_type,omitempty"`
+	Label            string             `json:"label"`
+	Parent           string             `json:"parent,omitempty"` // Label of the asymmetric-unit site a symmetry copy was generated from
+	TypeSymbol       string             `json:"type_symbol"`
+	Element          string             `json:"element,omitempty"` // Element symbol normalised from TypeSymbol or Label
+	FractX           float64            `json:"fract_x"`
+	FractY           float64            `json:"fract_y"`
+	FractZ           float64            `json:"fract_z"`
+	UIsoOrEquiv      float64            `json:"u_iso_or_equiv,omitempty"`
+	AdpType          string             `json:"adp_type,omitempty"`
+	Occupancy        float64            `json:"occupancy"` // Site occupancy, 1 when not given
+	DisorderGroup    string             `json:"disorder_group,omitempty"`
+	DisorderAssembly string             `json:"disorder_assembly,omitempty"`
+	Uncertainties    map[string]float64 `json:"uncertainties,omitempty"` // Standard uncertainties keyed by tag
+	FixedAxes        [3]bool            `json:"fixed_axes"`              // Cartesian axes along which the atom must not move
+	FixedLatticeAxes [3]bool            `json:"fixed_lattice_axes"`      // Lattice-vector components that must not change, as in VASP selective dynamics
+	Charge           *float64           `json:"charge,omitempty"`        // Computed atomic charge, written as _atom_site_charge
+	Extra            map[string]string  `json:"extra,omitempty"`         // Atom site columns not read into other fields, keyed by tag
 }
 
 // SymmetryOperation represents a symmetry operation in CIF format
@@ -98,24 +329,46 @@ type SymmetryOperation struct {
 	Z string `json:"z"`
 }
 
+// DFTBGeometry represents a DFTB+ geometry
+type DFTBGeometry struct {
+	Periodic         bool          `json:"periodic"`
+	Origin           [3]float64    `json:"origin"` // Cell origin in Angstrom, written to periodic gen files
+	LatticeVectors   [3][3]float64 `json:"lattice_vectors"`
+	Elements         []string      `json:"elements"`                     // Distinct elements in order of first appearance
+	Species          []int         `json:"species"`                      // Per-atom zero-based index into Elements
+	Coordinates      [][]float64   `json:"coordinates"`                  // Cartesian coordinates in Angstrom
+	FixedAxes        [][3]bool     `json:"fixed_axes,omitempty"`         // Per-atom fixed Cartesian axes; nil when every atom moves freely
+	FixedLatticeAxes [][3]bool     `json:"fixed_lattice_axes,omitempty"` // Per-atom fixed lattice-vector components; nil when every atom moves freely
+}
+
 // DFTBInput represents the input for DFTB+ calculation
 type DFTBInput struct {
-	Geometry struct {
-		Periodic      bool     `json:"periodic"`
-		LatticeVectors [3][3]float64 `json:"lattice_vectors"`
-		Elements      []string `json:"elements"`
-		Coordinates   [][]float64 `json:"coordinates"`
-	} `json:"geometry"`
-	
+	Geometry DFTBGeometry `json:"geometry"`
+
 	Hamiltonian struct {
-		Method string `json:"method"` // "GFN1-xTB" or "GFN2-xTB"
+		Method                string             `json:"method"`                         // "GFN1-xTB", "GFN2-xTB", "DFTB" or "DFTB3"
+		ParameterSet          string             `json:"parameter_set,omitempty"`        // SK methods only
+		SlaterKosterPrefix    string             `json:"slater_koster_prefix,omitempty"` // Directory of the SK files, with a trailing separator
+		SlaterKosterSeparator string             `json:"slater_koster_separator,omitempty"`
+		SlaterKosterSuffix    string             `json:"slater_koster_suffix,omitempty"`
+		MaxAngularMomentum    map[string]string  `json:"max_angular_momentum,omitempty"`
+		HubbardDerivs         map[string]float64 `json:"hubbard_derivs,omitempty"` // DFTB3 only, atomic units
+		ThirdOrderFull        bool               `json:"third_order_full,omitempty"`
+		DampXH                bool               `json:"damp_xh,omitempty"`
+		DampXHExponent        float64            `json:"damp_xh_exponent,omitempty"`
 	} `json:"hamiltonian"`
-	
+
+	KPoints *KPointSampling `json:"kpoints,omitempty"` // Periodic systems only
+
 	Analysis struct {
 		Forces bool `json:"forces"`
 	} `json:"analysis"`
-	
+
 	Options struct {
-		Fmax float64 `json:"fmax"` // Force convergence threshold
+		Fmax        float64 `json:"fmax"`                   // Force convergence threshold
+		MaxSteps    int     `json:"max_steps"`              // Geometry step limit of the driver
+		LatticeOpt  bool    `json:"lattice_opt,omitempty"`  // Variable-cell optimization
+		LatticeMode string  `json:"lattice_mode,omitempty"` // "full", "isotropic" or "fixed_angles"
+		PressureGPa float64 `json:"pressure_gpa,omitempty"` // External pressure
 	} `json:"options"`
 }